@@ -2,28 +2,26 @@ package rockhopper
 
 import (
 	"context"
-
-	log "github.com/sirupsen/logrus"
 )
 
+// Align moves the package of the migrations to versionID, rolling back the
+// applied migrations above it or applying the pending ones up to it. The
+// migrations must belong to a single package, see AlignPackage.
 func Align(ctx context.Context, db *DB, versionID int64, migrations MigrationSlice) error {
-	_, lastAppliedMigration, err := db.FindLastAppliedMigration(ctx, migrations)
-	if err != nil {
-		return err
-	}
-
-	if lastAppliedMigration == nil {
-		return Up(ctx, db, migrations.Head(), versionID)
-	}
+	return AlignPackage(ctx, db, migrations, "", versionID)
+}
 
-	if versionID < lastAppliedMigration.Version {
-		return Down(ctx, db, lastAppliedMigration, versionID)
+// AlignPackage moves package pkgName to versionID. An empty pkgName selects
+// the only package of the migrations, see MigrationSlice.ForPackage.
+func AlignPackage(ctx context.Context, db *DB, migrations MigrationSlice, pkgName string, versionID int64) error {
+	if len(migrations) == 0 {
+		return nil
 	}
 
-	if versionID > lastAppliedMigration.Version {
-		return Up(ctx, db, lastAppliedMigration.Next, versionID)
+	plan, err := NewPlanner(db, migrations).PlanAlign(ctx, pkgName, versionID)
+	if err != nil {
+		return err
 	}
 
-	log.Infof("the migration version is already aligned to %d", versionID)
-	return nil
+	return db.ExecutePlan(ctx, plan)
 }
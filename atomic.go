@@ -0,0 +1,141 @@
+package rockhopper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// AtomicUnsupportedError is returned by an atomic run that could not be
+// rolled back as a whole: the database commits DDL statements implicitly, or
+// a migration runs without a transaction.
+type AtomicUnsupportedError struct {
+	// Migration is the '-- !txn' migration, nil when the database is the
+	// reason.
+	Migration *Migration
+	Reason    string
+}
+
+func (e *AtomicUnsupportedError) Error() string {
+	if e.Migration != nil {
+		return fmt.Sprintf("can not run atomically: migration %s %s", e.Migration.location(), e.Reason)
+	}
+
+	return "can not run atomically: " + e.Reason
+}
+
+// SetAtomic makes ExecutePlan, and Upgrade which runs a plan, apply every step
+// and its version record in one transaction, so a failed step leaves the
+// database as it was. It returns AtomicUnsupportedError without running
+// anything when the database does not roll back DDL statements, only
+// PostgreSQL and SQLite do, or when a step is a '-- !txn' migration.
+func (db *DB) SetAtomic(atomic bool) {
+	db.atomic = atomic
+}
+
+// checkAtomic checks that the migrations can run in one transaction.
+func (db *DB) checkAtomic(migrations ...*Migration) error {
+	switch db.driverName {
+	case DialectPostgres, DialectSQLite3:
+	default:
+		return &AtomicUnsupportedError{Reason: fmt.Sprintf("DDL statements commit implicitly on %s", db.driverName)}
+	}
+
+	for _, m := range migrations {
+		if !m.UseTx {
+			return &AtomicUnsupportedError{Migration: m, Reason: "is a '-- !txn' migration"}
+		}
+	}
+
+	return nil
+}
+
+// atomicRun is the transaction every migration of an atomic run executes in.
+type atomicRun struct {
+	tx *sql.Tx
+
+	// attempts are written to the migration log when the transaction ends.
+	attempts []migrationAttempt
+}
+
+// migrationAttempt is an attempt of an atomic run to apply or roll back a
+// migration, see appendMigrationLog.
+type migrationAttempt struct {
+	m          *Migration
+	direction  Direction
+	duration   time.Duration
+	statements int
+	err        error
+}
+
+// execute is the statementExecutorFunc of the migrations of an atomic run. It
+// runs the callbacks in the transaction of the run, which commits or rolls
+// them back with the other migrations.
+func (run *atomicRun) execute(ctx context.Context, _ *sql.DB, callbacks ...TransactionHandler) error {
+	for _, cb := range callbacks {
+		if err := cb(ctx, run.tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stmtExecutor returns how the statements of m run: in the transaction of the
+// atomic run in progress, or in a transaction of their own unless m is a
+// '-- !txn' migration.
+func (db *DB) stmtExecutor(m *Migration) statementExecutorFunc {
+	if db.atomicRun != nil {
+		return db.atomicRun.execute
+	}
+
+	return m.getStmtExecutor()
+}
+
+// queryRowContext runs a query of the migration runner, in the transaction of
+// the atomic run in progress if any, so it sees the changes of the run.
+func (db *DB) queryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if db.atomicRun != nil {
+		return db.atomicRun.tx.QueryRowContext(ctx, query, args...)
+	}
+
+	return db.QueryRowContext(ctx, query, args...)
+}
+
+// runAtomic runs fn with every migration executed in one transaction, which
+// is committed when fn succeeds and rolled back otherwise.
+func (db *DB) runAtomic(ctx context.Context, fn func() error) error {
+	// database/sql would roll the transaction back by itself when ctx is
+	// cancelled, it is rolled back below instead
+	tx, err := db.BeginTx(context.WithoutCancel(ctx), nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin the transaction of the atomic run")
+	}
+
+	run := &atomicRun{tx: tx}
+	db.atomicRun = run
+	err = fn()
+	db.atomicRun = nil
+
+	if err != nil {
+		err = rollbackAndLogErr(err, tx, "")
+		log.Warn("the atomic run is rolled back, none of its migrations is applied")
+	} else if err = tx.Commit(); err != nil {
+		err = errors.Wrap(err, "failed to commit the atomic run")
+	}
+
+	for _, a := range run.attempts {
+		attemptErr := a.err
+		if err != nil && attemptErr == nil {
+			attemptErr = errors.New("rolled back with the atomic run")
+		}
+
+		db.appendMigrationLog(ctx, a.m, a.direction, a.duration, a.statements, attemptErr)
+	}
+
+	return err
+}
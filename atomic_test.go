@@ -0,0 +1,93 @@
+package rockhopper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgrade_Atomic(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	db.SetAtomic(true)
+
+	migrations := loadRequiresTestMigrations(t, map[string]string{
+		"20240101120000_create_users.sql": "-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n",
+		"20240102120000_create_posts.sql": "-- +up\nCREATE TABLE posts (id INT);\n-- +down\nDROP TABLE posts;\n",
+		"20240103120000_seed_posts.sql":   "-- +up\nINSERT INTO missing (id) VALUES (1);\n-- +down\nDELETE FROM posts;\n",
+	})
+
+	assert.ErrorContains(t, Upgrade(ctx, db, migrations), "no such table: missing")
+
+	for _, table := range []string{"users", "posts"} {
+		_, err := db.Exec("SELECT COUNT(*) FROM " + table)
+		assert.Error(t, err, "%s is rolled back", table)
+	}
+
+	require.NoError(t, db.LoadMigrations(ctx, migrations))
+	for _, m := range migrations {
+		assert.Nil(t, m.Record, "%d has no version record", m.Version)
+	}
+
+	entries, err := db.LoadMigrationLog(ctx, MigrationLogFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	for _, e := range entries {
+		assert.Equal(t, MigrationLogFailed, e.Outcome)
+	}
+
+	assert.Equal(t, "rolled back with the atomic run", entries[1].Error)
+	assert.Contains(t, entries[0].Error, "no such table: missing")
+
+	// once the failed migration is fixed, the whole run is applied
+	require.NoError(t, Upgrade(ctx, db, migrations[:2]))
+	require.NoError(t, db.LoadMigrations(ctx, migrations))
+	assert.True(t, migrations[1].Record.IsApplied)
+}
+
+func TestUpgrade_AtomicUnsupported(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	db.SetAtomic(true)
+
+	migrations := loadRequiresTestMigrations(t, map[string]string{
+		"20240101120000_create_users.sql": "-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n",
+		"20240102120000_index_users.sql":  "-- !txn\n-- +up\nCREATE INDEX users_id_idx ON users (id);\n-- +down\nDROP INDEX users_id_idx;\n",
+	})
+
+	var unsupported *AtomicUnsupportedError
+	err := Upgrade(ctx, db, migrations)
+	require.ErrorAs(t, err, &unsupported)
+	assert.Equal(t, int64(20240102120000), unsupported.Migration.Version)
+
+	_, err = db.Exec("SELECT COUNT(*) FROM users")
+	assert.Error(t, err, "nothing runs")
+
+	err = (&DB{driverName: DialectMySQL}).checkAtomic(migrations[0])
+	assert.EqualError(t, err, "can not run atomically: DDL statements commit implicitly on mysql")
+}
+
+func TestRedo_Atomic(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	migrations := loadRequiresTestMigrations(t, map[string]string{
+		"20240101120000_create_users.sql": "-- +up\nCREATE TABLE users (id INT);\nINSERT INTO users (id) VALUES (1);\n-- +down\nDROP TABLE users;\n",
+	})
+	require.NoError(t, Upgrade(ctx, db, migrations))
+
+	// the up of the redo fails after the down dropped the table
+	m := migrations[0]
+	m.UpStatements = append(m.UpStatements, Statement{Direction: DirectionUp, SQL: "INSERT INTO missing (id) VALUES (1);"})
+	assert.ErrorContains(t, Redo(ctx, db, m), "no such table: missing")
+
+	var n int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n))
+	assert.Equal(t, 1, n, "the down is rolled back with the up")
+
+	_, err := db.LoadMigration(ctx, m)
+	require.NoError(t, err)
+	assert.True(t, m.Record.IsApplied)
+}
@@ -0,0 +1,186 @@
+package rockhopper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/c9s/rockhopper/v2/pkg/dialect"
+)
+
+// ToolVersion is the rockhopper version recorded with every applied
+// migration. The CLI sets it to its build version.
+var ToolVersion = "dev"
+
+// AuditInfo is recorded with every applied migration, so that an audit can
+// tell who applied it, from where and with which binaries.
+type AuditInfo struct {
+	// AppliedBy is the configured actor, or the OS user.
+	AppliedBy string
+
+	Hostname string
+
+	// RockhopperVersion defaults to ToolVersion.
+	RockhopperVersion string
+
+	// BuildID identifies the build of the application, e.g. a git commit.
+	BuildID string
+}
+
+// newAuditInfo collects the audit info of the current process.
+func newAuditInfo() AuditInfo {
+	info := AuditInfo{RockhopperVersion: ToolVersion}
+
+	if u, err := user.Current(); err == nil {
+		info.AppliedBy = u.Username
+	} else {
+		info.AppliedBy = os.Getenv("USER")
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		info.Hostname = hostname
+	}
+
+	return info
+}
+
+// AuditInfo returns the audit info recorded with applied migrations.
+func (db *DB) AuditInfo() AuditInfo {
+	return db.audit
+}
+
+// SetAuditInfo sets the audit info recorded with applied migrations.
+func (db *DB) SetAuditInfo(info AuditInfo) {
+	db.audit = info
+}
+
+// versionAuditColumns are added to the version table by the V3 core upgrade.
+func versionAuditColumns() []dialect.Column {
+	return []dialect.Column{
+		{Name: "applied_by", Type: dialect.ColVarchar, Size: 128, NotNull: true, Default: "''"},
+		{Name: "hostname", Type: dialect.ColVarchar, Size: 255, NotNull: true, Default: "''"},
+		{Name: "rockhopper_version", Type: dialect.ColVarchar, Size: 64, NotNull: true, Default: "''"},
+		{Name: "build_id", Type: dialect.ColVarchar, Size: 128, NotNull: true, Default: "''"},
+		{Name: "duration_ms", Type: dialect.ColBigInt, NotNull: true, Default: "0"},
+		{Name: "checksum", Type: dialect.ColVarchar, Size: 64, NotNull: true, Default: "''"},
+	}
+}
+
+// addAuditColumns is the VersionRockhopperV3 core upgrade. Dialects that can
+// not add columns skip it, and record the migrations without the audit info.
+func (db *DB) addAuditColumns(ctx context.Context) error {
+	if !db.canAddAuditColumns() {
+		log.Debugf("dialect %s can not add columns, skipping the audit columns of the version table", db.driverName)
+		return nil
+	}
+
+	for _, c := range versionAuditColumns() {
+		q, _ := db.dialect.AddColumn(db.tableName, c)
+
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			return errors.Wrapf(err, "failed to add column %s", c.Name)
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) canAddAuditColumns() bool {
+	_, supported := db.dialect.AddColumn(db.tableName, versionAuditColumns()[0])
+	return supported
+}
+
+// hasAuditColumns reports whether the version table has the audit columns. A
+// DB that was not touched, like the one of a read-only command, may read a
+// version table older than VersionRockhopperV3.
+func (db *DB) hasAuditColumns(ctx context.Context) (bool, error) {
+	if !db.canAddAuditColumns() {
+		return false, nil
+	}
+
+	db.touchedMu.Lock()
+	touched := db.touched
+	db.touchedMu.Unlock()
+
+	if touched {
+		return true, nil
+	}
+
+	version, err := db.queryLatestVersion(ctx, CorePackageName)
+	if err != nil {
+		return false, err
+	}
+
+	return version >= VersionRockhopperV3, nil
+}
+
+// auditColumnNames are the names of versionAuditColumns.
+var auditColumnNames = []string{"applied_by", "hostname", "rockhopper_version", "build_id", "duration_ms", "checksum"}
+
+// auditDests are the scan destinations of auditColumnNames.
+func (r *MigrationRecord) auditDests(durationMs *int64) []any {
+	return []any{&r.AppliedBy, &r.Hostname, &r.RockhopperVersion, &r.BuildID, durationMs, &r.Checksum}
+}
+
+// insertAppliedVersion records an applied migration with the audit info.
+func (db *DB) insertAppliedVersion(ctx context.Context, exec SQLExecutor, m *Migration, duration time.Duration) error {
+	audit, err := db.hasAuditColumns(ctx)
+	if err != nil {
+		return err
+	}
+
+	cols := []dialect.Col{
+		{Name: "package", Val: m.Package},
+		{Name: "source_file", Val: m.Source},
+		{Name: "version_id", Val: m.Version},
+		{Name: "is_applied", Val: true},
+	}
+
+	if audit {
+		cols = append(cols,
+			dialect.Col{Name: "applied_by", Val: db.audit.AppliedBy},
+			dialect.Col{Name: "hostname", Val: db.audit.Hostname},
+			dialect.Col{Name: "rockhopper_version", Val: db.audit.RockhopperVersion},
+			dialect.Col{Name: "build_id", Val: db.audit.BuildID},
+			dialect.Col{Name: "duration_ms", Val: duration.Milliseconds()},
+			dialect.Col{Name: "checksum", Val: m.Checksum()},
+		)
+	}
+
+	q, args := db.dialect.Insert(db.tableName, cols)
+	if _, err := exec.ExecContext(ctx, q, args...); err != nil {
+		return errors.Wrap(err, "failed to insert new migration record")
+	}
+
+	return nil
+}
+
+// Checksum returns the SHA-256 of the up and down statements, or "" for a Go
+// migration.
+func (m *Migration) Checksum() string {
+	if m.checksum != "" {
+		return m.checksum
+	}
+
+	if len(m.UpStatements) == 0 && len(m.DownStatements) == 0 {
+		return ""
+	}
+
+	h := sha256.New()
+	for _, stmts := range [][]Statement{m.UpStatements, m.DownStatements} {
+		for _, stmt := range stmts {
+			h.Write([]byte(stmt.SQL))
+			h.Write([]byte{0})
+		}
+
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,138 @@
+package rockhopper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/c9s/rockhopper/v2/pkg/dialect"
+)
+
+func TestMigration_AuditColumns(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	db.SetAuditInfo(AuditInfo{
+		AppliedBy:         "deploy-bot",
+		Hostname:          "ci-runner-1",
+		RockhopperVersion: "v2.1.0",
+		BuildID:           "abc123",
+	})
+
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_create_users.sql", "-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n")
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+	require.NoError(t, Up(ctx, db, migrations.Tail(), 0))
+
+	m := migrations[0]
+	m.Record = nil
+	_, err = db.LoadMigration(ctx, m)
+	require.NoError(t, err)
+	require.NotNil(t, m.Record)
+
+	assert.Equal(t, "deploy-bot", m.Record.AppliedBy)
+	assert.Equal(t, "ci-runner-1", m.Record.Hostname)
+	assert.Equal(t, "v2.1.0", m.Record.RockhopperVersion)
+	assert.Equal(t, "abc123", m.Record.BuildID)
+	assert.GreaterOrEqual(t, int64(m.Record.Duration), int64(0))
+	assert.Equal(t, m.Checksum(), m.Record.Checksum)
+	assert.Len(t, m.Record.Checksum, 64)
+}
+
+func TestMigration_Checksum(t *testing.T) {
+	a := &Migration{UpStatements: []Statement{{SQL: "CREATE TABLE a (id INT);"}}}
+	b := &Migration{UpStatements: []Statement{{SQL: "CREATE TABLE a (id BIGINT);"}}}
+	c := &Migration{DownStatements: []Statement{{SQL: "CREATE TABLE a (id INT);"}}}
+
+	assert.NotEqual(t, a.Checksum(), b.Checksum())
+	assert.NotEqual(t, a.Checksum(), c.Checksum(), "up and down statements are told apart")
+	assert.Empty(t, (&Migration{}).Checksum(), "a go migration has no checksum")
+}
+
+func TestCoreMigration_AuditColumnsUpgrade(t *testing.T) {
+	ctx := context.Background()
+
+	// a version table written before the audit columns existed
+	db := openGolangMigrateTestDB(t)
+	require.NoError(t, db.createVersionTable(ctx, db, VersionRockhopperV1))
+	require.NoError(t, db.createProgressTable(ctx))
+	require.NoError(t, db.insertVersion(ctx, db, CorePackageName, "", VersionRockhopperV2, true))
+	require.NoError(t, db.insertVersion(ctx, db, DefaultPackageName, "20240101120000_init.sql", 20240101120000, true))
+
+	require.NoError(t, db.Touch(ctx))
+
+	version, err := db.queryLatestVersion(ctx, CorePackageName)
+	require.NoError(t, err)
+	assert.Equal(t, coreMigrations[len(coreMigrations)-1].Version, version)
+
+	m := &Migration{Package: DefaultPackageName, Version: 20240101120000}
+	_, err = db.LoadMigration(ctx, m)
+	require.NoError(t, err)
+	if assert.NotNil(t, m.Record) {
+		assert.True(t, m.Record.IsApplied)
+		assert.Empty(t, m.Record.AppliedBy, "records written before the upgrade have no audit info")
+		assert.Empty(t, m.Record.Checksum)
+	}
+}
+
+func TestDB_LoadMigration_BeforeAuditColumns(t *testing.T) {
+	ctx := context.Background()
+
+	// a version table written before the audit columns existed, read by a DB
+	// that is not touched, like the one of a read-only command
+	db := openGolangMigrateTestDB(t)
+	db.SetMaxOpenConns(1)
+	require.NoError(t, db.createVersionTable(ctx, db, VersionRockhopperV1))
+	require.NoError(t, db.insertVersion(ctx, db, DefaultPackageName, "20240101120000_init.sql", 20240101120000, true))
+
+	m := &Migration{Package: DefaultPackageName, Version: 20240101120000}
+	_, err := db.LoadMigration(ctx, m)
+	require.NoError(t, err)
+	require.NotNil(t, m.Record)
+	assert.True(t, m.Record.IsApplied)
+
+	migrations := MigrationSlice{{Package: DefaultPackageName, Version: 20240101120000}}
+	require.NoError(t, db.LoadMigrations(ctx, migrations))
+	require.NotNil(t, migrations[0].Record)
+	assert.True(t, migrations[0].Record.IsApplied)
+}
+
+// noAddColumnDialect is a dialect that can not add columns.
+type noAddColumnDialect struct {
+	SQLDialect
+}
+
+func (noAddColumnDialect) AddColumn(string, dialect.Column) (string, bool) {
+	return "", false
+}
+
+func TestCoreMigration_AuditColumnsUnsupported(t *testing.T) {
+	ctx := context.Background()
+
+	sqlite, err := LoadDialect("sqlite3")
+	require.NoError(t, err)
+
+	db, err := Open("sqlite3", noAddColumnDialect{sqlite}, ":memory:", TableName)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	db.SetMaxOpenConns(1)
+
+	require.NoError(t, db.Touch(ctx), "the audit columns are skipped")
+
+	migrations := loadRequiresTestMigrations(t, map[string]string{
+		"20240101120000_create_users.sql": "-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n",
+	})
+	require.NoError(t, Upgrade(ctx, db, migrations))
+
+	m := migrations[0]
+	_, err = db.LoadMigration(ctx, m)
+	require.NoError(t, err)
+	require.NotNil(t, m.Record)
+	assert.True(t, m.Record.IsApplied)
+	assert.Empty(t, m.Record.Checksum, "recorded without the audit info")
+}
@@ -0,0 +1,294 @@
+package rockhopper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/c9s/rockhopper/v2/pkg/driver"
+)
+
+// BatchStatements sends the statements of the migration to the database in
+// batches of size statements, like the "-- +batch size" annotation.
+func BatchStatements(size int) MigrationOption {
+	return func(m *Migration) {
+		m.BatchSize = size
+	}
+}
+
+// warnTrackedBatch warns that the '-- +batch' annotation of a '-- !txn'
+// migration does not batch its up statements: they run one by one, so that
+// the progress of every statement is recorded, see runUpTracked. Its down
+// statements are batched.
+func (m *Migration) warnTrackedBatch() {
+	if m.BatchSize > 0 && !m.UseTx {
+		log.Warnf("%s: '-- +batch' has no effect on the up statements of a '-- !txn' migration, they run one by one to record their progress",
+			filepath.Base(m.Source))
+	}
+}
+
+// batchConn returns the connection pool the statements of m run on and the
+// batch size the driver allows. PostgreSQL runs a query without arguments with
+// the simple query protocol and SQLite executes every statement of the query,
+// so both batch on the DB itself. MySQL needs multiStatements=true, which the
+// DB keeps off, so the batches run on a dedicated connection. The size is zero
+// when the statements run one by one.
+func (db *DB) batchConn(m *Migration) (*sql.DB, int) {
+	if m.BatchSize <= 1 {
+		return db.DB, 0
+	}
+
+	switch db.driverName {
+	case DialectPostgres, DialectSQLite3:
+		return db.DB, m.BatchSize
+
+	case DialectMySQL:
+		conn, err := db.openBatchDB()
+		if err != nil {
+			log.WithError(err).Warnf("can not batch the statements of %s, running them one by one", m.location())
+			return db.DB, 0
+		}
+
+		return conn, m.BatchSize
+	}
+
+	log.Warnf("driver %s can not batch the statements of %s, running them one by one", db.driverName, m.location())
+	return db.DB, 0
+}
+
+// openBatchDB opens the MySQL connection with multiStatements=true on the
+// first batch.
+func (db *DB) openBatchDB() (*sql.DB, error) {
+	db.batchDBMu.Lock()
+	defer db.batchDBMu.Unlock()
+
+	if db.batchDB != nil {
+		return db.batchDB, nil
+	}
+
+	if db.dsn == "" {
+		return nil, errors.New("the DSN of the database is unknown")
+	}
+
+	if driver.EnableMySQLMultiStatements == nil {
+		return nil, errors.New("the mysql driver is not built in")
+	}
+
+	dsn, err := driver.EnableMySQLMultiStatements(db.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mysql dsn: %q: %w", maskDsnPassword(db.dsn), err)
+	}
+
+	conn, err := sql.Open(db.driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database connection with dsn: %q: %w", maskDsnPassword(dsn), err)
+	}
+
+	conn.SetMaxOpenConns(1)
+	db.batchDB = conn
+	return conn, nil
+}
+
+// Close closes the database and the connection of the MySQL statement
+// batches.
+func (db *DB) Close() error {
+	db.batchDBMu.Lock()
+	batchDB := db.batchDB
+	db.batchDB = nil
+	db.batchDBMu.Unlock()
+
+	if batchDB != nil {
+		if err := batchDB.Close(); err != nil {
+			log.WithError(err).Error("failed to close the batch connection")
+		}
+	}
+
+	return db.DB.Close()
+}
+
+// errorPosition returns the function that finds the position of an error in
+// its query, nil when the driver does not report it.
+func (db *DB) errorPosition() func(err error) (int, bool) {
+	if db.driverName == DialectPostgres {
+		return driver.PostgresErrorPosition
+	}
+
+	return nil
+}
+
+// statementBatch is consecutive statements sent in one query.
+type statementBatch struct {
+	stmts []Statement
+
+	// indexes are the indexes of the statements in their block.
+	indexes []int
+
+	// offsets are the character offsets the statements start at in the query.
+	offsets []int
+
+	query strings.Builder
+	runes int
+}
+
+func (b *statementBatch) add(i int, stmt Statement) {
+	if b.query.Len() > 0 {
+		b.query.WriteString("\n")
+		b.runes++
+	}
+
+	sql := strings.TrimSpace(stmt.SQL)
+	if !strings.HasSuffix(sql, ";") {
+		sql += ";"
+	}
+
+	b.stmts = append(b.stmts, stmt)
+	b.indexes = append(b.indexes, i)
+	b.offsets = append(b.offsets, b.runes)
+	b.query.WriteString(sql)
+	b.runes += utf8.RuneCountInString(sql)
+}
+
+func (b *statementBatch) reset() {
+	b.stmts, b.indexes, b.offsets = b.stmts[:0], b.indexes[:0], b.offsets[:0]
+	b.query.Reset()
+	b.runes = 0
+}
+
+// describe names the statements of the batch in error messages, e.g.
+// "statements #3-#7 at migrations/20240101000000_users.sql:42".
+func (b *statementBatch) describe() string {
+	desc := fmt.Sprintf("statements #%d-#%d", b.indexes[0]+1, b.indexes[len(b.indexes)-1]+1)
+	if loc := b.stmts[0].location(); loc != "" {
+		desc += " at " + loc
+	}
+
+	return desc
+}
+
+// failed returns the index in the batch of the statement an error points at,
+// when the driver reports the 1-based character position of the error in the
+// query.
+func (b *statementBatch) failed(err error, errorPosition func(err error) (int, bool)) (int, bool) {
+	if errorPosition == nil {
+		return 0, false
+	}
+
+	position, ok := errorPosition(err)
+	if !ok || position < 1 {
+		return 0, false
+	}
+
+	k := sort.Search(len(b.offsets), func(i int) bool { return b.offsets[i] >= position }) - 1
+	return k, k >= 0
+}
+
+// executeStatementBatches executes the statements in batches of size
+// statements, each one sent in a single query. It returns the number of
+// statements of the batches executed successfully. A size below 2 executes
+// the statements one by one.
+func executeStatementBatches(ctx context.Context, e SQLExecutor, stmts iter.Seq2[Statement, error], size int, errorPosition func(err error) (int, bool)) (int, error) {
+	if size <= 1 {
+		return executeStatementSeq(ctx, e, stmts)
+	}
+
+	batch := &statementBatch{}
+	executed := 0
+	flush := func() error {
+		if len(batch.stmts) == 0 {
+			return nil
+		}
+
+		if err := executeBatch(ctx, e, batch, errorPosition); err != nil {
+			return err
+		}
+
+		executed += len(batch.stmts)
+		batch.reset()
+		return nil
+	}
+
+	i := 0
+	for stmt, err := range stmts {
+		if err != nil {
+			return executed, err
+		}
+
+		if isNoOpSQL(stmt.SQL) {
+			log.Debugf("skipping empty SQL statement #%d", i+1)
+			i++
+			continue
+		}
+
+		batch.add(i, stmt)
+		i++
+
+		if len(batch.stmts) >= size {
+			if err := flush(); err != nil {
+				return executed, err
+			}
+		}
+	}
+
+	return executed, flush()
+}
+
+func executeBatch(ctx context.Context, e SQLExecutor, b *statementBatch, errorPosition func(err error) (int, bool)) error {
+	query := b.query.String()
+	summary := fmt.Sprintf("batch of %d statements #%d-#%d", len(b.stmts), b.indexes[0]+1, b.indexes[len(b.indexes)-1]+1)
+
+	pretty := log.GetLevel() != log.DebugLevel
+	if pretty {
+		fmt.Print(text.Colors{text.FgGreen}.Sprint("EXECUTING: "))
+		fmt.Print(text.Colors{text.FgHiWhite}.Sprint(summary), " ")
+	} else {
+		log.Debugf("%s:\n%s", summary, query)
+	}
+
+	startTime := time.Now()
+	_, err := e.ExecContext(ctx, query)
+	duration := time.Since(startTime)
+
+	if err == nil {
+		if pretty {
+			fmt.Printf("[  %s  ]", text.Colors{text.FgHiGreen}.Sprint("OK"))
+			fmt.Printf(" ---- %s", text.Colors{text.FgWhite, text.BgBlack}.Sprint(duration.String()))
+			fmt.Print("\n")
+		}
+
+		return nil
+	}
+
+	if pretty {
+		fmt.Printf("[  %s  ]", text.Colors{text.FgHiRed}.Sprint("FAILED"))
+		fmt.Print("\n")
+	}
+
+	if interruptErr := interrupted(ctx, b.indexes[0], b.describe()); interruptErr != nil {
+		return interruptErr
+	}
+
+	log.Error(err.Error())
+
+	if k, ok := b.failed(err, errorPosition); ok {
+		stmt := b.stmts[k]
+		if loc := stmt.location(); loc != "" {
+			log.Errorf("%s: %s", loc, stmt.SQL)
+		} else {
+			log.Error(stmt.SQL)
+		}
+
+		return errors.Wrapf(err, "%s: failed to execute SQL query %q in a batch of %d statements", stmt.describe(b.indexes[k]), cleanSQL(stmt.SQL), len(b.stmts))
+	}
+
+	return errors.Wrapf(err, "%s: failed to execute a batch of %d statements", b.describe(), len(b.stmts))
+}
@@ -0,0 +1,143 @@
+package rockhopper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationParser_Batch(t *testing.T) {
+	chunk, err := (&MigrationParser{}).ParseString("-- +batch\n-- +up\nINSERT INTO t VALUES (1);\n")
+	require.NoError(t, err)
+	assert.Equal(t, defaultBatchSize, chunk.BatchSize)
+
+	chunk, err = (&MigrationParser{}).ParseString("-- +batch 500\n-- +up\nINSERT INTO t VALUES (1);\n")
+	require.NoError(t, err)
+	assert.Equal(t, 500, chunk.BatchSize)
+
+	header, err := (&MigrationParser{}).ParseHeader(strings.NewReader("-- +batch 20"))
+	require.NoError(t, err)
+	assert.Equal(t, 20, header.BatchSize)
+
+	_, err = (&MigrationParser{}).ParseString("-- +batch 0\n-- +up\nINSERT INTO t VALUES (1);\n")
+	assert.ErrorContains(t, err, "invalid batch size")
+
+	_, err = (&MigrationParser{}).ParseString("-- +up\nINSERT INTO t VALUES (1);\n-- +batch\n")
+	assert.ErrorContains(t, err, "'-- +batch' must come before the first statement")
+}
+
+func TestBatchMigration(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeStreamTestMigration(t, dir, 25, "-- +batch 10\n")
+
+	migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Scan(dir)
+	require.NoError(t, err)
+
+	m := migrations[0]
+	assert.Equal(t, 10, m.BatchSize)
+
+	db := openTestDB(t)
+	plan, err := NewPlanner(db, migrations).PlanUp(ctx, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, plan.Steps, 1)
+	assert.Equal(t, 10, plan.Steps[0].BatchSize)
+
+	var buf bytes.Buffer
+	require.NoError(t, plan.Encode(&buf))
+	decoded, err := DecodePlan(&buf)
+	require.NoError(t, err)
+
+	step, err := decoded.Steps[0].Migration()
+	require.NoError(t, err)
+	assert.Equal(t, 10, step.BatchSize)
+
+	require.NoError(t, db.ExecutePlan(ctx, decoded))
+	assert.Equal(t, 25, countSeeds(t, db))
+
+	_, err = db.LoadMigration(ctx, m)
+	require.NoError(t, err)
+	assert.True(t, m.Record.IsApplied)
+
+	require.NoError(t, m.Down(ctx, db))
+	_, err = db.Exec("SELECT COUNT(*) FROM seeds")
+	assert.Error(t, err, "rolled back")
+}
+
+func TestBatchMigration_Failed(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_seed.sql",
+		"-- +batch 2\n-- +up\nCREATE TABLE seeds (id INT);\nINSERT INTO seeds (id) VALUES (1);\nINSERT INTO missing (id) VALUES (2);\nINSERT INTO seeds (id) VALUES (3);\n")
+
+	migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Load(dir)
+	require.NoError(t, err)
+
+	db := openTestDB(t)
+	err = migrations[0].Up(ctx, db)
+	assert.ErrorContains(t, err, "statements #3-#4 at ")
+	assert.ErrorContains(t, err, "20240101120000_seed.sql:5: failed to execute a batch of 2 statements")
+
+	_, err = db.Exec("SELECT COUNT(*) FROM seeds")
+	assert.Error(t, err, "the transaction is rolled back")
+}
+
+func TestStatementBatch_Failed(t *testing.T) {
+	b := &statementBatch{}
+	b.add(4, Statement{SQL: "INSERT INTO t VALUES ('é');", File: "a.sql", Line: 10})
+	b.add(5, Statement{SQL: "INSERT INTO t VALUES (2)", File: "a.sql", Line: 11})
+	b.add(6, Statement{SQL: "INSERT INTO u VALUES (3);", File: "a.sql", Line: 12})
+
+	assert.Equal(t, "INSERT INTO t VALUES ('é');\nINSERT INTO t VALUES (2);\nINSERT INTO u VALUES (3);", b.query.String())
+	assert.Equal(t, "statements #5-#7 at a.sql:10", b.describe())
+
+	// the position is 1-based and counts characters, not bytes
+	query := b.query.String()
+	position := utf8.RuneCountInString(query[:strings.Index(query, "u VALUES")]) + 1
+	errorPosition := func(err error) (int, bool) {
+		return position, err != nil
+	}
+
+	k, ok := b.failed(errors.New("relation \"u\" does not exist"), errorPosition)
+	require.True(t, ok)
+	assert.Equal(t, 2, k)
+
+	position = 1
+	k, ok = b.failed(errors.New("syntax error"), errorPosition)
+	require.True(t, ok)
+	assert.Equal(t, 0, k)
+
+	_, ok = b.failed(errors.New("unique violation"), nil)
+	assert.False(t, ok)
+}
+
+func TestBatchMigration_WithoutTransaction(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeStreamTestMigration(t, dir, 25, "-- !txn\n-- +batch 10\n")
+
+	migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Scan(dir)
+	require.NoError(t, err)
+	require.NoError(t, migrations.Parse())
+
+	var warned bool
+	for _, entry := range hook.AllEntries() {
+		warned = warned || entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "'-- +batch' has no effect on the up statements of a '-- !txn' migration")
+	}
+	assert.True(t, warned, "the batch size is reported as ignored")
+
+	db := openTestDB(t)
+	require.NoError(t, migrations[0].Up(ctx, db), "the statements run one by one")
+	assert.Equal(t, 25, countSeeds(t, db))
+}
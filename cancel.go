@@ -0,0 +1,138 @@
+package rockhopper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// serverCancelTimeout bounds the query that cancels a statement on the server.
+const serverCancelTimeout = 10 * time.Second
+
+// InterruptedError is returned when the context of a migration is cancelled
+// while its statements run, e.g. by Ctrl-C. The running statement is
+// cancelled on the server, see withServerCancel.
+type InterruptedError struct {
+	// Statement is the 1-based index of the statement that did not complete,
+	// the first one of a batch.
+	Statement int
+
+	// At names the statement, e.g. "statement #3 at migrations/x.sql:42".
+	At string
+
+	Err error
+}
+
+func (e *InterruptedError) Error() string {
+	return "interrupted at " + e.At
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// interrupted returns InterruptedError when a statement failed because ctx was
+// cancelled, nil otherwise.
+func interrupted(ctx context.Context, i int, at string) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+
+	return &InterruptedError{Statement: i + 1, At: at, Err: context.Cause(ctx)}
+}
+
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// serverCancelQueries returns the query of the server id of a connection and
+// the format of the query that cancels the statement it runs, empty for
+// SQLite, whose driver interrupts the statement itself.
+func (db *DB) serverCancelQueries() (idQuery, cancelQuery string) {
+	switch db.driverName {
+	case DialectMySQL:
+		return "SELECT CONNECTION_ID()", "KILL QUERY %d"
+	case DialectPostgres:
+		return "SELECT pg_backend_pid()", "SELECT pg_cancel_backend(%d)"
+	}
+
+	return "", ""
+}
+
+// withServerCancel runs fn with an executor whose running statement is
+// cancelled on the server when ctx is cancelled. The drivers stop waiting for
+// a cancelled statement, but the MySQL server keeps running it, holding its
+// locks. The server id of the connection is captured before fn runs, and the
+// cancellation is sent over another connection of the pool. A *sql.DB is
+// narrowed to one of its connections, so the statements run on the
+// connection the cancellation targets. A pool limited to one connection has
+// none left to send the cancellation over, so fn runs without it.
+func (db *DB) withServerCancel(ctx context.Context, exec SQLExecutor, fn func(exec SQLExecutor) error) error {
+	idQuery, cancelQuery := db.serverCancelQueries()
+	if idQuery == "" {
+		return fn(exec)
+	}
+
+	if db.Stats().MaxOpenConnections == 1 {
+		log.Debug("the connection pool is limited to one connection, an interrupted statement will not be cancelled on the server")
+		return fn(exec)
+	}
+
+	if pool, ok := exec.(*sql.DB); ok {
+		conn, err := pool.Conn(ctx)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if err := conn.Close(); err != nil {
+				log.WithError(err).Debug("failed to release the migration connection")
+			}
+		}()
+
+		exec = conn
+	}
+
+	querier, ok := exec.(rowQuerier)
+	if !ok {
+		return fn(exec)
+	}
+
+	var id int64
+	if err := querier.QueryRowContext(ctx, idQuery).Scan(&id); err != nil {
+		log.WithError(err).Warn("unable to query the connection id, an interrupted statement will keep running on the server")
+		return fn(exec)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			db.cancelServerQuery(context.WithoutCancel(ctx), fmt.Sprintf(cancelQuery, id))
+		case <-done:
+		}
+	}()
+
+	err := fn(exec)
+	close(done)
+
+	// the bookkeeping after an interrupted statement waits for its cancellation
+	<-stopped
+	return err
+}
+
+func (db *DB) cancelServerQuery(ctx context.Context, query string) {
+	ctx, cancel := context.WithTimeout(ctx, serverCancelTimeout)
+	defer cancel()
+
+	log.Warnf("cancelling the running statement on the server: %s", query)
+	if _, err := db.DB.ExecContext(ctx, query); err != nil {
+		log.WithError(err).Errorf("unable to cancel the running statement, it may still run on the server")
+	}
+}
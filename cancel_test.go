@@ -0,0 +1,141 @@
+package rockhopper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// endlessQuery runs until it is interrupted.
+const endlessQuery = "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT COUNT(*) FROM c;"
+
+func loadInterruptTestMigration(t *testing.T, header string) *Migration {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_seed.sql", header+"-- +up\n"+
+		"CREATE TABLE seeds (id INT);\n"+
+		"INSERT INTO seeds (id) VALUES (1);\n"+
+		endlessQuery+"\n"+
+		"INSERT INTO seeds (id) VALUES (2);\n"+
+		"-- +down\nDROP TABLE seeds;\n")
+
+	migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Load(dir)
+	require.NoError(t, err)
+	return migrations[0]
+}
+
+func TestMigration_Interrupted(t *testing.T) {
+	db := openTestDB(t)
+	m := loadInterruptTestMigration(t, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := m.Up(ctx, db)
+	var interruptErr *InterruptedError
+	require.ErrorAs(t, err, &interruptErr)
+	assert.Equal(t, 3, interruptErr.Statement)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "interrupted at statement #3 at ")
+
+	bg := context.Background()
+	_, err = db.Exec("SELECT COUNT(*) FROM seeds")
+	assert.Error(t, err, "the transaction is rolled back")
+
+	_, err = db.LoadMigration(bg, m)
+	require.NoError(t, err)
+	assert.Nil(t, m.Record)
+
+	entries, err := db.LoadMigrationLog(bg, MigrationLogFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, MigrationLogFailed, entries[0].Outcome)
+	assert.Contains(t, entries[0].Error, "interrupted at statement #3")
+}
+
+func TestMigration_InterruptedWithoutTransaction(t *testing.T) {
+	db := openTestDB(t)
+	m := loadInterruptTestMigration(t, "-- !txn\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var interruptErr *InterruptedError
+	require.ErrorAs(t, m.Up(ctx, db), &interruptErr)
+
+	bg := context.Background()
+	progress, err := db.LoadMigrationProgress(bg, m.Package, m.Version)
+	require.NoError(t, err)
+	require.NotNil(t, progress, "the interrupted statement is recorded")
+	assert.Equal(t, ProgressDirty, progress.Status)
+	assert.Equal(t, 2, progress.StatementIndex)
+	assert.Contains(t, progress.Error, "interrupted at statement #3")
+	assert.Equal(t, 1, countSeeds(t, db), "the statements before it stay applied")
+}
+
+func Test_executeStatementSeq_Interrupted(t *testing.T) {
+	db := openTestDB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stmts := []Statement{
+		{SQL: "CREATE TABLE seeds (id INT);"},
+		{SQL: "INSERT INTO seeds (id) VALUES (1);"},
+		{SQL: "INSERT INTO seeds (id) VALUES (2);"},
+	}
+
+	// the interrupt arrives while the second statement runs
+	seq := func(yield func(Statement, error) bool) {
+		for i, stmt := range stmts {
+			if i == 2 {
+				cancel()
+			}
+
+			if !yield(stmt, nil) {
+				return
+			}
+		}
+	}
+
+	executed, err := executeStatementSeq(ctx, db.DB, seq)
+	assert.Equal(t, 2, executed)
+	assert.EqualError(t, err, "interrupted at statement #3")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestMigration_UpSingleConnection(t *testing.T) {
+	for name, header := range map[string]string{"transaction": "", "no transaction": "-- !txn\n"} {
+		t.Run(name, func(t *testing.T) {
+			db := openTestDB(t)
+			db.SetMaxOpenConns(1)
+
+			// take the path of a server that cancels statements, the id query
+			// fails on SQLite
+			db.driverName = DialectPostgres
+
+			dir := t.TempDir()
+			writeTestMigrationFile(t, dir, "20240101120000_seed.sql", header+"-- +up\n"+
+				"CREATE TABLE seeds (id INT);\n"+
+				"INSERT INTO seeds (id) VALUES (1);\n"+
+				"-- +down\nDROP TABLE seeds;\n")
+
+			migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Load(dir)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			require.NoError(t, migrations[0].Up(ctx, db), "the bookkeeping does not wait for the held connection")
+			assert.Equal(t, 1, countSeeds(t, db))
+
+			_, err = db.LoadMigration(ctx, migrations[0])
+			require.NoError(t, err)
+			assert.NotNil(t, migrations[0].Record)
+		})
+	}
+}
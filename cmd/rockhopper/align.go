@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 
 	"github.com/spf13/cobra"
@@ -10,14 +11,18 @@ import (
 )
 
 func init() {
+	AlignCmd.Flags().Bool("force", false, "remove the version record of a migration without down statements instead of refusing to roll it back")
+	AlignCmd.Flags().String("plan", "", "write the plan to this file, - for stdout, instead of running it (see apply)")
+	AlignCmd.Flags().String("package", "", "align this package, required when several packages are configured")
+	addWaitForDBFlag(AlignCmd)
 	rootCmd.AddCommand(AlignCmd)
 }
 
 var AlignCmd = &cobra.Command{
-	Use:   "align",
+	Use:   "align [<package>] <version>",
 	Short: "align migration version",
 
-	Args: cobra.ExactArgs(2),
+	Args: cobra.RangeArgs(1, 2),
 
 	// SilenceUsage is an option to silence usage when an error occurs.
 	SilenceUsage: true,
@@ -25,14 +30,35 @@ var AlignCmd = &cobra.Command{
 }
 
 func align(cmd *cobra.Command, args []string) error {
-	packageName := args[0]
-	versionStr := args[1]
-	versionID, err := strconv.ParseInt(versionStr, 10, 64)
+	packageName, err := cmd.Flags().GetString("package")
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	if len(args) == 2 {
+		if packageName != "" && packageName != args[0] {
+			return fmt.Errorf("the package argument %q conflicts with --package %q", args[0], packageName)
+		}
+
+		packageName, args = args[0], args[1:]
+	}
+
+	versionID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	planFile, err := cmd.Flags().GetString("plan")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 
 	db, err := rockhopper.OpenWithConfig(config)
@@ -42,13 +68,15 @@ func align(cmd *cobra.Command, args []string) error {
 
 	defer db.Close()
 
+	db.SetForceIrreversible(force)
+
 	if err := db.Touch(ctx); err != nil {
 		return err
 	}
 
 	loader := rockhopper.NewSqlMigrationLoader(config)
 
-	migrations, err := loader.Load(config.MigrationsDirs...)
+	migrations, err := loader.Scan(config.MigrationsDirs...)
 	if err != nil {
 		return err
 	}
@@ -58,7 +86,14 @@ func align(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	migrations = migrations.FilterPackage([]string{packageName})
-	migrations = migrations.SortAndConnect()
-	return rockhopper.Align(ctx, db, versionID, migrations)
+	if packageName, err = selectPackage(migrations, packageName); err != nil {
+		return err
+	}
+
+	plan, err := rockhopper.NewPlanner(db, migrations).PlanAlign(ctx, packageName, versionID)
+	if err != nil {
+		return err
+	}
+
+	return runPlan(ctx, db, plan, planFile)
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
+)
+
+func init() {
+	addWaitForDBFlag(ApplyCmd)
+	rootCmd.AddCommand(ApplyCmd)
+}
+
+var ApplyCmd = &cobra.Command{
+	Use:   "apply <plan-file>",
+	Short: "run a plan written by up, down or align with --plan",
+	Long: "run exactly the steps of a plan file written by up, down or align with --plan.\n\n" +
+		"The plan carries its statements, so it runs without the migration files. It is refused\n" +
+		"when the database changed since the plan was computed.",
+
+	Args: cobra.ExactArgs(1),
+
+	// SilenceUsage is an option to silence usage when an error occurs.
+	SilenceUsage: true,
+	RunE:         apply,
+	PostRunE:     writeConfigSchemaFile,
+}
+
+func apply(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	plan, err := rockhopper.DecodePlan(f)
+	if err != nil {
+		return err
+	}
+
+	db, err := rockhopper.OpenWithConfig(config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if err := db.Touch(ctx); err != nil {
+		return err
+	}
+
+	return db.ExecutePlan(ctx, plan)
+}
+
+// runPlan runs the plan, or writes it to planFile when one is given.
+func runPlan(ctx context.Context, db *rockhopper.DB, plan *rockhopper.Plan, planFile string) error {
+	if planFile == "" {
+		if len(plan.Steps) == 0 {
+			log.Infof("no migrations to run")
+			return nil
+		}
+
+		return db.ExecutePlan(ctx, plan)
+	}
+
+	if planFile == "-" {
+		return plan.Encode(os.Stdout)
+	}
+
+	f, err := os.Create(planFile)
+	if err != nil {
+		return err
+	}
+
+	if err := plan.Encode(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	printPlan(plan)
+	log.Infof("plan written to %s, run it with: rockhopper apply %s", planFile, planFile)
+	return nil
+}
+
+func printPlan(plan *rockhopper.Plan) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Direction", "Package", "Version ID", "Source File", "Statements", "Reason"})
+	for _, s := range plan.Steps {
+		statements := fmt.Sprint(len(s.Statements))
+		if s.GoMigration {
+			statements = "go"
+		} else if s.Stream {
+			statements = "stream"
+		}
+
+		if s.BatchSize > 0 {
+			statements += fmt.Sprintf(" (batch %d)", s.BatchSize)
+		}
+
+		t.AppendRow(table.Row{s.Direction.String(), s.Package, s.Version, s.Source, statements, s.Reason})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", "Steps", len(plan.Steps)})
+	t.Render()
+}
+
+// planMigrations returns the migrations of the plan steps.
+func planMigrations(plan *rockhopper.Plan) (rockhopper.MigrationSlice, error) {
+	var migrations rockhopper.MigrationSlice
+	for i := range plan.Steps {
+		m, err := plan.Steps[i].Migration()
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, m)
+	}
+
+	return migrations, nil
+}
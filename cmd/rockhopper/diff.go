@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
+)
+
+func init() {
+	DiffCmd.Flags().String("target-dsn", "", "compare against a second database instead of a desired schema file")
+	DiffCmd.Flags().String("scratch-dsn", "", "empty database the desired schema file is applied to (defaults to an in-memory database for sqlite3)")
+	DiffCmd.Flags().String("name", rockhopper.DefaultSchemaDiffName, "descriptive name of the generated migration file")
+	DiffCmd.Flags().StringP("output", "o", "", "output directory")
+	DiffCmd.Flags().Bool("dry-run", false, "print the generated migration instead of writing it")
+	addWaitForDBFlag(DiffCmd)
+	rootCmd.AddCommand(DiffCmd)
+}
+
+var DiffCmd = &cobra.Command{
+	Use:   "diff [desired.sql]",
+	Short: "generate a migration from the schema difference to a desired state",
+	Long: "compare the schema of the configured database with a desired state and generate a migration\n" +
+		"that brings the database to it, with a computed down migration.\n\n" +
+		"The desired state is either a .sql file of DDL statements, which is applied to a scratch\n" +
+		"database first, or a second database given with --target-dsn.",
+	Args: cobra.MaximumNArgs(1),
+
+	// SilenceUsage is an option to silence usage when an error occurs.
+	SilenceUsage: true,
+	RunE:         diff,
+}
+
+func diff(cmd *cobra.Command, args []string) error {
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+
+	targetDSN, err := cmd.Flags().GetString("target-dsn")
+	if err != nil {
+		return err
+	}
+
+	scratchDSN, err := cmd.Flags().GetString("scratch-dsn")
+	if err != nil {
+		return err
+	}
+
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+
+	outputDir, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	if (len(args) == 0) == (targetDSN == "") {
+		return errors.New("either a desired schema file or --target-dsn is required")
+	}
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	db, err := rockhopper.OpenWithConfig(config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if err := db.WaitForDB(ctx); err != nil {
+		return err
+	}
+
+	current, err := db.InspectSchema(ctx)
+	if err != nil {
+		return err
+	}
+
+	dsn := targetDSN
+	if dsn == "" {
+		dsn = scratchDSN
+	}
+
+	if dsn == "" {
+		if config.Driver != rockhopper.DialectSQLite3 {
+			return fmt.Errorf("--scratch-dsn is required to apply a desired schema file on %s", config.Driver)
+		}
+
+		dsn = ":memory:"
+	}
+
+	targetConfig := *config
+	targetConfig.DSN = dsn
+
+	target, err := rockhopper.OpenWithConfig(&targetConfig)
+	if err != nil {
+		return err
+	}
+
+	defer target.Close()
+
+	if err := target.WaitForDB(ctx); err != nil {
+		return err
+	}
+
+	if len(args) > 0 {
+		// an in-memory database only lives as long as its connection
+		target.SetMaxOpenConns(1)
+
+		if err := target.ExecSchemaFile(ctx, args[0]); err != nil {
+			return err
+		}
+	}
+
+	desired, err := target.InspectSchema(ctx)
+	if err != nil {
+		return err
+	}
+
+	schemaDiff, err := rockhopper.DiffSchema(db.Dialect(), current, desired)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range schemaDiff.Warnings {
+		log.Warn(w)
+	}
+
+	if schemaDiff.Empty() {
+		log.Infof("no schema changes found")
+		return nil
+	}
+
+	if dryRun {
+		return schemaDiff.Template().Execute(os.Stdout, nil)
+	}
+
+	if outputDir == "" {
+		outputDir = defaultMigrationsDir(config)
+	}
+
+	if !dirExists(outputDir) {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	return rockhopper.CreateWithTemplate(outputDir, schemaDiff.Template(), name, "sql")
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
 
 	"github.com/spf13/cobra"
 
@@ -13,6 +12,10 @@ func init() {
 	DownCmd.Flags().Int64("to", 0, "downgrade to a specific version")
 	DownCmd.Flags().Bool("all", false, "downgrade all")
 	DownCmd.Flags().Int("steps", 0, "downgrade by steps")
+	DownCmd.Flags().String("package", "", "roll back the migrations of this package, required when several packages are configured")
+	DownCmd.Flags().Bool("force", false, "remove the version record of a migration without down statements instead of refusing to roll it back")
+	DownCmd.Flags().String("plan", "", "write the plan to this file, - for stdout, instead of running it (see apply)")
+	addWaitForDBFlag(DownCmd)
 	rootCmd.AddCommand(DownCmd)
 }
 
@@ -23,10 +26,11 @@ var DownCmd = &cobra.Command{
 	// SilenceUsage is an option to silence usage when an error occurs.
 	SilenceUsage: true,
 	RunE:         down,
+	PostRunE:     writeConfigSchemaFile,
 }
 
 func down(cmd *cobra.Command, args []string) error {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 
 	if err := checkConfig(config); err != nil {
@@ -48,6 +52,21 @@ func down(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	pkgName, err := cmd.Flags().GetString("package")
+	if err != nil {
+		return err
+	}
+
+	planFile, err := cmd.Flags().GetString("plan")
+	if err != nil {
+		return err
+	}
+
 	db, err := rockhopper.OpenWithConfig(config)
 	if err != nil {
 		return err
@@ -55,13 +74,15 @@ func down(cmd *cobra.Command, args []string) error {
 
 	defer db.Close()
 
+	db.SetForceIrreversible(force)
+
 	if err := db.Touch(ctx); err != nil {
 		return err
 	}
 
 	loader := rockhopper.NewSqlMigrationLoader(config)
 
-	allMigrations, err := loader.Load(config.MigrationsDirs...)
+	allMigrations, err := loader.Scan(config.MigrationsDirs...)
 	if err != nil {
 		return err
 	}
@@ -73,54 +94,50 @@ func down(cmd *cobra.Command, args []string) error {
 
 	debugMigrations(allMigrations)
 
+	var plan *rockhopper.Plan
 	if downgradeAll {
-		migrationMap := allMigrations.MapByPackage()
-
-		if len(config.IncludePackages) > 0 {
-			migrationMap = migrationMap.FilterPackage(config.IncludePackages)
+		migrations := allMigrations
+		if pkgName != "" {
+			migrations = migrations.FilterPackage([]string{pkgName})
+		} else if len(config.IncludePackages) > 0 {
+			migrations = migrations.FilterPackage(config.IncludePackages)
 		}
 
-		migrationMap = migrationMap.SortAndConnect()
-
-		for _, migrations := range migrationMap {
-			_, lastAppliedMigration, err := db.FindLastAppliedMigration(ctx, migrations)
-			if err != nil {
-				return err
-			}
-
-			err = rockhopper.Down(ctx, db, lastAppliedMigration, 0, func(m *rockhopper.Migration) {
-				log.Infof("migration %v is applied for downgrade", m.Version)
-			})
-			if err != nil {
-				return err
-			}
+		plan, err = rockhopper.NewPlanner(db, migrations).PlanDownAll(ctx)
+	} else {
+		if pkgName, err = selectPackage(allMigrations, pkgName); err != nil {
+			return err
 		}
 
-		return nil
+		plan, err = rockhopper.NewPlanner(db, allMigrations).PlanDown(ctx, pkgName, steps, to)
 	}
 
-	allMigrations = allMigrations.SortAndConnect()
-
-	_, lastAppliedMigration, err := db.FindLastAppliedMigration(ctx, allMigrations)
 	if err != nil {
 		return err
 	}
 
-	if lastAppliedMigration == nil {
-		return errors.New("last applied migration not found")
+	return runPlan(ctx, db, plan, planFile)
+}
+
+// selectPackage returns the package a rollback is scoped to: the given one, or
+// else the only package of the migrations included by the config.
+func selectPackage(migrations rockhopper.MigrationSlice, pkgName string) (string, error) {
+	if pkgName != "" {
+		return pkgName, nil
+	}
+
+	if len(config.IncludePackages) > 0 {
+		migrations = migrations.FilterPackage(config.IncludePackages)
 	}
 
-	if to > 0 {
-		return rockhopper.Down(ctx, db, lastAppliedMigration, to, func(m *rockhopper.Migration) {
-			log.Infof("migration %v is applied for downgrade", m.Version)
-		})
+	packages := migrations.Packages()
+	if len(packages) > 1 {
+		return "", &rockhopper.PackageRequiredError{Packages: packages}
 	}
 
-	if steps == 0 {
-		steps = 1
+	if len(packages) == 0 {
+		return "", nil
 	}
 
-	return rockhopper.DownBySteps(ctx, db, lastAppliedMigration, steps, func(m *rockhopper.Migration) {
-		log.Infof("migration %v is applied for downgrade", m.Version)
-	})
+	return packages[0], nil
 }
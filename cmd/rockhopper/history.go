@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
+)
+
+func init() {
+	HistoryCmd.Flags().String("package", "", "only show the migrations of this package")
+	HistoryCmd.Flags().Int64("version", 0, "only show this migration version")
+	HistoryCmd.Flags().String("since", "", "only show attempts at or after this time, e.g. 2024-01-02, 2024-01-02T15:04:05Z or 24h ago as 24h")
+	HistoryCmd.Flags().String("until", "", "only show attempts before this time, in the format of --since")
+	HistoryCmd.Flags().Int("limit", 50, "show at most this many attempts, 0 for all")
+	addWaitForDBFlag(HistoryCmd)
+	rootCmd.AddCommand(HistoryCmd)
+}
+
+var HistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "show every attempt to apply or roll back a migration",
+	Long: "show the migration log, the most recent attempt first.\n\n" +
+		"Unlike status, the log keeps the rollbacks and the failed attempts too.",
+
+	// SilenceUsage is an option to silence usage when an error occurs.
+	SilenceUsage: true,
+	RunE:         history,
+}
+
+func history(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+
+	var filter rockhopper.MigrationLogFilter
+	var err error
+
+	if filter.Package, err = cmd.Flags().GetString("package"); err != nil {
+		return err
+	}
+
+	if filter.Version, err = cmd.Flags().GetInt64("version"); err != nil {
+		return err
+	}
+
+	if filter.Limit, err = cmd.Flags().GetInt("limit"); err != nil {
+		return err
+	}
+
+	since, err := cmd.Flags().GetString("since")
+	if err != nil {
+		return err
+	}
+
+	if filter.Since, err = parseHistoryTime(since, time.Now()); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+
+	until, err := cmd.Flags().GetString("until")
+	if err != nil {
+		return err
+	}
+
+	if filter.Until, err = parseHistoryTime(until, time.Now()); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+
+	db, err := rockhopper.OpenWithConfig(config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if err := db.Touch(ctx); err != nil {
+		return err
+	}
+
+	entries, err := db.LoadMigrationLog(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Time", "Package", "Version ID", "Direction", "Outcome", "Duration", "Statements", "Applied By", "Host", "Error"})
+	for _, e := range entries {
+		t.AppendRow(table.Row{
+			e.Time.Format(time.ANSIC), e.Package, e.Version, e.Direction.String(), e.Outcome, e.Duration, e.Statements, e.AppliedBy, e.Hostname, firstLine(e.Error),
+		})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", "", "", "", "", "Attempts", len(entries)})
+	t.Render()
+
+	return nil
+}
+
+// historyTimeLayouts are the absolute time formats accepted by --since and
+// --until. A time without a zone is local time.
+var historyTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseHistoryTime parses an absolute time, or a duration counted back from
+// now. An empty string is the zero time.
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	for _, layout := range historyTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%q is neither a time like 2024-01-02 15:04:05 nor a duration like 24h", s)
+}
+
+// firstLine keeps table rows on a single line.
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " ..."
+	}
+
+	return s
+}
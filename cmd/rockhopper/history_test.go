@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHistoryTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	t.Run("empty is the zero time", func(t *testing.T) {
+		v, err := parseHistoryTime("", now)
+		require.NoError(t, err)
+		assert.True(t, v.IsZero())
+	})
+
+	t.Run("duration counts back from now", func(t *testing.T) {
+		v, err := parseHistoryTime("24h", now)
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(-24*time.Hour), v)
+	})
+
+	t.Run("absolute times", func(t *testing.T) {
+		v, err := parseHistoryTime("2024-01-01T10:00:00Z", now)
+		require.NoError(t, err)
+		assert.True(t, v.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)))
+
+		v, err = parseHistoryTime("2024-01-01", now)
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), v)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseHistoryTime("yesterday", now)
+		assert.Error(t, err)
+	})
+}
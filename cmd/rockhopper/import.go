@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
+)
+
+func init() {
+	ImportCmd.Flags().Bool("dry-run", false, "print how the history table maps to rockhopper versions without changing the database")
+	ImportCmd.Flags().Bool("keep-legacy-table", false, "keep the history table of the other tool instead of dropping it")
+	addWaitForDBFlag(ImportCmd)
+	rootCmd.AddCommand(ImportCmd)
+}
+
+var ImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "import the migration history of another tool",
+	Long: "import the history table of golang-migrate, Flyway, sqlx, Liquibase or Atlas into the\n" +
+		"rockhopper version table.\n\n" +
+		"Every command imports it on the first run; use this command to review the mapping with\n" +
+		"--dry-run first, or to keep the legacy table while another service still uses it.",
+
+	// SilenceUsage is an option to silence usage when an error occurs.
+	SilenceUsage: true,
+	RunE:         importHistory,
+}
+
+func importHistory(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	keepLegacyTable, err := cmd.Flags().GetBool("keep-legacy-table")
+	if err != nil {
+		return err
+	}
+
+	db, err := rockhopper.OpenWithConfig(config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	plan, err := db.PlanHistoryImport(ctx)
+	if err != nil {
+		return err
+	}
+
+	if plan == nil {
+		log.Infof("no history table to import")
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle("%s: %s", plan.Importer.Name(), plan.Table)
+	t.AppendHeader(table.Row{"Package", "Version ID", "Source File", "Legacy Row", "Baseline"})
+	for _, v := range plan.Versions {
+		t.AppendRow(table.Row{v.Package, v.Version, v.SourceFile, v.Ref, baselineMark(v.Baseline)})
+	}
+	t.AppendFooter(table.Row{"", "", "Versions", len(plan.Versions)})
+	t.Render()
+
+	if dryRun {
+		return nil
+	}
+
+	if keepLegacyTable {
+		db.SetKeepLegacyTables(true)
+	}
+
+	if err := db.Touch(ctx); err != nil {
+		return err
+	}
+
+	log.Infof("imported %d versions from %s", len(plan.Versions), plan.Table)
+	return nil
+}
+
+func baselineMark(baseline bool) string {
+	if baseline {
+		return "*"
+	}
+	return "-"
+}
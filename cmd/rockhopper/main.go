@@ -45,6 +45,14 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
+		// the flag overrides the waitForDB of the config
+		if flag := cmd.Flags().Lookup("wait-for-db"); flag != nil && flag.Changed {
+			config.WaitForDB, err = cmd.Flags().GetDuration("wait-for-db")
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	},
 
@@ -71,8 +79,18 @@ func init() {
 	logrus.SetFormatter(&prefixed.TextFormatter{})
 }
 
+// addWaitForDBFlag adds the --wait-for-db flag to a command that connects to
+// the database.
+func addWaitForDBFlag(cmd *cobra.Command) {
+	cmd.Flags().Duration("wait-for-db", 0, "wait up to this long for the database to accept connections, e.g. 30s, failing fast on bad credentials or an unknown database")
+}
+
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := interruptContext()
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+
+	if err != nil {
 		logrus.WithError(err).Fatalf("cannot execute command")
 	}
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
 
 	"github.com/spf13/cobra"
 
@@ -10,7 +9,10 @@ import (
 )
 
 func init() {
-	// RedoCmd.Flags().String("","","...")
+	RedoCmd.Flags().Bool("force", false, "remove the version record of a migration without down statements instead of refusing to roll it back")
+	RedoCmd.Flags().Bool("atomic", false, "refuse to redo when the down and the up can not run in one transaction")
+	RedoCmd.Flags().String("package", "", "redo the last migration of this package, required when several packages are configured")
+	addWaitForDBFlag(RedoCmd)
 	rootCmd.AddCommand(RedoCmd)
 }
 
@@ -21,12 +23,28 @@ var RedoCmd = &cobra.Command{
 	// SilenceUsage is an option to silence usage when an error occurs.
 	SilenceUsage: true,
 	RunE:         redo,
+	PostRunE:     writeConfigSchemaFile,
 }
 
 func redo(cmd *cobra.Command, args []string) error {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	pkgName, err := cmd.Flags().GetString("package")
+	if err != nil {
+		return err
+	}
+
+	atomic, err := cmd.Flags().GetBool("atomic")
+	if err != nil {
+		return err
+	}
+
 	db, err := rockhopper.OpenWithConfig(config)
 	if err != nil {
 		return err
@@ -34,13 +52,16 @@ func redo(cmd *cobra.Command, args []string) error {
 
 	defer db.Close()
 
+	db.SetForceIrreversible(force)
+	db.SetAtomic(atomic)
+
 	if err := db.Touch(ctx); err != nil {
 		return err
 	}
 
 	loader := rockhopper.NewSqlMigrationLoader(config)
 
-	migrations, err := loader.Load(config.MigrationsDirs...)
+	migrations, err := loader.Scan(config.MigrationsDirs...)
 	if err != nil {
 		return err
 	}
@@ -50,14 +71,9 @@ func redo(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	_, lastAppliedMigration, err := db.FindLastAppliedMigration(ctx, migrations)
-	if err != nil {
+	if pkgName, err = selectPackage(migrations, pkgName); err != nil {
 		return err
 	}
 
-	if lastAppliedMigration == nil {
-		return errors.New("no migration has been applied yet")
-	}
-
-	return rockhopper.Redo(ctx, db, lastAppliedMigration)
+	return rockhopper.RedoPackage(ctx, db, migrations, pkgName)
 }
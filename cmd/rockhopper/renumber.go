@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
+)
+
+func init() {
+	RenumberCmd.Flags().Bool("dry-run", false, "print the renames as git mv commands without touching any file")
+	RenumberCmd.Flags().StringP("output", "o", "", "path to the compiled migrations package to rewrite along with the sql files")
+	addWaitForDBFlag(RenumberCmd)
+	rootCmd.AddCommand(RenumberCmd)
+}
+
+var RenumberCmd = &cobra.Command{
+	Use:   "renumber",
+	Short: "renumber out-of-order pending migrations above the highest applied version",
+	Long: "renumber the pending migrations whose version is lower than the highest applied version of\n" +
+		"their package (usually migrations merged in from another branch). They are given fresh\n" +
+		"timestamp versions above every known migration, keeping their relative order.\n\n" +
+		"The database is only read.",
+
+	// SilenceUsage is an option to silence usage when an error occurs.
+	SilenceUsage: true,
+	RunE:         renumber,
+}
+
+func renumber(cmd *cobra.Command, args []string) error {
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	outputDir, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	db, err := rockhopper.OpenWithConfig(config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if err := db.WaitForDB(ctx); err != nil {
+		return err
+	}
+
+	loader := rockhopper.NewSqlMigrationLoader(config)
+	allMigrations, err := loader.Load(config.MigrationsDirs...)
+	if err != nil {
+		return err
+	}
+
+	renames, err := rockhopper.PlanRenumber(ctx, db, allMigrations, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if len(renames) == 0 {
+		log.Infof("no out-of-order migrations found")
+		return nil
+	}
+
+	if dryRun {
+		for _, r := range renames {
+			fmt.Printf("git mv %s %s\n", r.OldSource, r.NewSource)
+			if r.OldDownSource != "" {
+				fmt.Printf("git mv %s %s\n", r.OldDownSource, r.NewDownSource)
+			}
+		}
+
+		return nil
+	}
+
+	var dumper *rockhopper.GoMigrationDumper
+	if outputDir != "" {
+		dumper = &rockhopper.GoMigrationDumper{Dir: outputDir}
+	}
+
+	if err := rockhopper.ApplyRenumber(renames, dumper); err != nil {
+		return err
+	}
+
+	for _, r := range renames {
+		fmt.Printf("renamed: %s -> %s\n", r.OldSource, r.NewSource)
+		if r.OldDownSource != "" {
+			fmt.Printf("renamed: %s -> %s\n", r.OldDownSource, r.NewDownSource)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
+)
+
+func init() {
+	RepairCmd.Flags().String("mark", rockhopper.ProgressClean, "mark the dirty migration \"clean\" (re-run from its first statement) or \"failed\" (refuse to resume)")
+	addWaitForDBFlag(RepairCmd)
+	rootCmd.AddCommand(RepairCmd)
+}
+
+var RepairCmd = &cobra.Command{
+	Use:   "repair <packageName> <versionID>",
+	Short: "mark a partially applied non-transactional migration clean or failed",
+
+	Args: cobra.ExactArgs(2),
+
+	// SilenceUsage is an option to silence usage when an error occurs.
+	SilenceUsage: true,
+	RunE:         repair,
+}
+
+func repair(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+
+	packageName := args[0]
+	versionID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	mark, err := cmd.Flags().GetString("mark")
+	if err != nil {
+		return err
+	}
+
+	db, err := rockhopper.OpenWithConfig(config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if err := db.Touch(ctx); err != nil {
+		return err
+	}
+
+	if err := db.RepairMigration(ctx, packageName, versionID, mark); err != nil {
+		return err
+	}
+
+	log.Infof("migration %s:%d is marked %s", packageName, versionID, mark)
+	return nil
+}
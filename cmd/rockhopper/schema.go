@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
+)
+
+func init() {
+	SchemaDumpCmd.Flags().StringP("output", "o", "", "schema file to write (defaults to schemaFile in the config, or stdout)")
+	SchemaDumpCmd.Flags().Bool("check", false, "fail when the schema file does not match the database instead of writing it")
+
+	addWaitForDBFlag(SchemaDumpCmd)
+	SchemaCmd.AddCommand(SchemaDumpCmd)
+	rootCmd.AddCommand(SchemaCmd)
+}
+
+var SchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "inspect the database schema",
+}
+
+var SchemaDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "dump the database schema as canonical DDL",
+	Long: "dump the schema of the database as deterministically ordered DDL.\n\n" +
+		"Commit the dump next to the migrations so that reviewers see the effective schema of\n" +
+		"every change. With schemaFile set in the config, up, down and redo rewrite it too.",
+
+	// SilenceUsage is an option to silence usage when an error occurs.
+	SilenceUsage: true,
+	RunE:         schemaDump,
+}
+
+func schemaDump(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	check, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		output = config.SchemaFile
+	}
+
+	db, err := rockhopper.OpenWithConfig(config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if err := db.WaitForDB(ctx); err != nil {
+		return err
+	}
+
+	if check {
+		if output == "" {
+			return errors.New("--check needs a schema file, set --output or schemaFile in the config")
+		}
+
+		if err := db.CheckSchemaFile(ctx, output); err != nil {
+			return err
+		}
+
+		log.Infof("schema file %s is up to date", output)
+		return nil
+	}
+
+	if output == "" {
+		dump, err := db.DumpSchema(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(dump)
+		return nil
+	}
+
+	if err := db.WriteSchemaFile(ctx, output); err != nil {
+		return err
+	}
+
+	log.Infof("schema dumped to %s", output)
+	return nil
+}
+
+// writeConfigSchemaFile rewrites the schemaFile of the config after a command
+// changed the schema. It is used as the PostRunE of up, down, redo, apply and
+// sync, which cobra only calls when the command succeeded. A command that only
+// wrote a plan with --plan or printed one with --dry-run changed nothing.
+func writeConfigSchemaFile(cmd *cobra.Command, args []string) error {
+	if config == nil || config.SchemaFile == "" {
+		return nil
+	}
+
+	if flag := cmd.Flags().Lookup("plan"); flag != nil && flag.Value.String() != "" {
+		return nil
+	}
+
+	if flag := cmd.Flags().Lookup("dry-run"); flag != nil && flag.Value.String() == "true" {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	db, err := rockhopper.OpenWithConfig(config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if err := db.WaitForDB(ctx); err != nil {
+		return err
+	}
+
+	if err := db.WriteSchemaFile(ctx, config.SchemaFile); err != nil {
+		return err
+	}
+
+	log.Infof("schema dumped to %s", config.SchemaFile)
+	return nil
+}
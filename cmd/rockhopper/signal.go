@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// interruptContext returns a context cancelled by the first SIGINT or
+// SIGTERM, which makes the running migration cancel its statement on the
+// server and record where it stopped. A second signal exits right away.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			// restore the default handler, so that the next signal exits
+			signal.Stop(signals)
+			log.Warnf("received %s, interrupting the migration; send it again to exit immediately", sig)
+			cancel()
+
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
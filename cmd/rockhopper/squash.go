@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
+)
+
+func init() {
+	SquashCmd.Flags().String("name", rockhopper.DefaultSquashName, "descriptive name of the squashed migration file")
+	SquashCmd.Flags().String("archive-dir", "", "directory the original migration files are moved to (defaults to an \"archive\" directory next to them)")
+	rootCmd.AddCommand(SquashCmd)
+}
+
+var SquashCmd = &cobra.Command{
+	Use:   "squash <packageName> <fromVersion> <toVersion>",
+	Short: "collapse a range of migrations into a single baseline migration",
+	Long: "collapse the migrations of a package in the inclusive version range into a single migration.\n\n" +
+		"The squashed migration takes the version of the last migration in the range, so databases\n" +
+		"that already applied the range treat it as applied. The original files are moved into the\n" +
+		"archive directory, which is not scanned for migrations.",
+
+	Args: cobra.ExactArgs(3),
+
+	// SilenceUsage is an option to silence usage when an error occurs.
+	SilenceUsage: true,
+	RunE:         squash,
+}
+
+func squash(cmd *cobra.Command, args []string) error {
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+
+	packageName := args[0]
+	from, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	to, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+
+	archiveDir, err := cmd.Flags().GetString("archive-dir")
+	if err != nil {
+		return err
+	}
+
+	loader := rockhopper.NewSqlMigrationLoader(config)
+
+	allMigrations, err := loader.Load(config.MigrationsDirs...)
+	if err != nil {
+		return err
+	}
+
+	squashed, originals, err := rockhopper.Squash(allMigrations, packageName, from, to)
+	if err != nil {
+		return err
+	}
+
+	squashed.Name = name
+
+	// the squashed file replaces the last migration of the range, in the same directory
+	dir := filepath.Dir(originals.Tail().Source)
+	if archiveDir == "" {
+		archiveDir = filepath.Join(dir, "archive")
+	}
+
+	archived, err := rockhopper.ArchiveMigrations(archiveDir, originals)
+	if err != nil {
+		return err
+	}
+
+	for i, p := range archived {
+		fmt.Printf("archived %s -> %s\n", originals[i].Source, p)
+	}
+
+	path, err := rockhopper.WriteSquashedMigration(dir, squashed)
+	if err != nil {
+		if err2 := rockhopper.RestoreArchivedMigrations(archiveDir, originals); err2 != nil {
+			log.WithError(err2).Error("unable to restore the archived migrations, move them back by hand")
+		} else {
+			log.Warnf("restored the archived migrations from %s", archiveDir)
+		}
+
+		return err
+	}
+
+	fmt.Printf("squashed %d migrations (%d-%d) into %s\n", len(originals), squashed.SquashedFrom, squashed.Version, path)
+	return nil
+}
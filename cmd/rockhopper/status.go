@@ -14,6 +14,8 @@ import (
 )
 
 func init() {
+	StatusCmd.Flags().BoolP("verbose", "v", false, "show who applied each migration, from which host and binaries, its duration and checksum")
+	addWaitForDBFlag(StatusCmd)
 	rootCmd.AddCommand(StatusCmd)
 }
 
@@ -39,13 +41,18 @@ func checkConfig(config *rockhopper.Config) error {
 }
 
 func status(cmd *cobra.Command, args []string) error {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 
 	if err := checkConfig(config); err != nil {
 		return err
 	}
 
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return err
+	}
+
 	db, err := rockhopper.OpenWithConfig(config)
 	if err != nil {
 		return err
@@ -59,7 +66,7 @@ func status(cmd *cobra.Command, args []string) error {
 
 	loader := rockhopper.NewSqlMigrationLoader(config)
 
-	allMigrations, err := loader.Load(config.MigrationsDirs...)
+	allMigrations, err := loader.Scan(config.MigrationsDirs...)
 	if err != nil {
 		return err
 	}
@@ -83,7 +90,11 @@ func status(cmd *cobra.Command, args []string) error {
 
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Package", "Version ID", "Source File", "Applied At", "Current"})
+	header := table.Row{"Package", "Version ID", "Source File", "Applied At", "Current"}
+	if verbose {
+		header = append(header, "Applied By", "Host", "Rockhopper", "Build", "Duration", "Checksum")
+	}
+	t.AppendHeader(header)
 
 	var pkgNames []string
 	for pkgName := range migrationMap {
@@ -105,15 +116,23 @@ func status(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
+		progress, err := db.LoadMigrationProgressByPackage(ctx, pkgName)
+		if err != nil {
+			return err
+		}
+
+		if err := db.LoadMigrations(ctx, migrations); err != nil {
+			return err
+		}
+
 		for _, migration := range migrations {
-			_, err := db.LoadMigration(ctx, migration)
-			if err != nil {
-				return err
+			row := table.Row{
+				migration.Package, migration.Version, migration.Source, formatAppliedAt(migration.Record, progress[migration.Version]), currentVersionMark(migration.Version, currentVersion),
 			}
-
-			t.AppendRow(table.Row{
-				migration.Package, migration.Version, migration.Source, formatAppliedAt(migration.Record), currentVersionMark(migration.Version, currentVersion),
-			})
+			if verbose {
+				row = append(row, auditColumns(migration.Record)...)
+			}
+			t.AppendRow(row)
 		}
 
 		t.AppendSeparator()
@@ -151,10 +170,34 @@ func currentVersionMark(migrationVersion, currentVersion int64) string {
 	return "-"
 }
 
-func formatAppliedAt(row *rockhopper.MigrationRecord) string {
+// auditColumns renders the audit columns of an applied migration. Records
+// written before the audit columns existed, or imported from another tool,
+// have them empty.
+func auditColumns(row *rockhopper.MigrationRecord) table.Row {
+	if row == nil || !row.IsApplied {
+		return table.Row{"", "", "", "", "", ""}
+	}
+
+	var duration string
+	if row.AppliedBy != "" {
+		duration = row.Duration.String()
+	}
+
+	// the first 12 hex digits are enough to tell checksums apart
+	checksum := row.Checksum
+	if len(checksum) > 12 {
+		checksum = checksum[:12]
+	}
+
+	return table.Row{row.AppliedBy, row.Hostname, row.RockhopperVersion, row.BuildID, duration, checksum}
+}
+
+func formatAppliedAt(row *rockhopper.MigrationRecord, progress *rockhopper.MigrationProgress) string {
 	var appliedAt = "Pending"
 	if row != nil && row.IsApplied {
 		appliedAt = row.Time.Format(time.ANSIC)
+	} else if progress.IsDirty() {
+		appliedAt = "Dirty (" + progress.String() + ")"
 	}
 
 	return appliedAt
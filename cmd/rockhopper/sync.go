@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
+)
+
+func init() {
+	SyncCmd.Flags().StringSlice("to", nil, "apply the migrations of a package at or below a version and roll back the others, as <package>:<version> (repeatable)")
+	SyncCmd.Flags().StringSlice("version", nil, "apply exactly these migrations of their packages and roll back the others, as <package>:<version> (repeatable)")
+	SyncCmd.Flags().Bool("dry-run", false, "print the plan without running it")
+	SyncCmd.Flags().Bool("force", false, "remove the version record of a migration without down statements instead of refusing to roll it back")
+	SyncCmd.Flags().String("plan", "", "write the plan to this file, - for stdout, instead of running it (see apply)")
+	addWaitForDBFlag(SyncCmd)
+	rootCmd.AddCommand(SyncCmd)
+}
+
+var SyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "converge the applied migrations to an exact set",
+	Long: "roll back the applied migrations outside the target, newest first, then apply the\n" +
+		"migrations of the target that are not applied, oldest first.\n\n" +
+		"Unlike align, sync also reconciles the gaps left by out-of-order migrations.\n" +
+		"A version without a package refers to the only configured package.",
+
+	// SilenceUsage is an option to silence usage when an error occurs.
+	SilenceUsage: true,
+	RunE:         syncMigrations,
+	PostRunE:     writeConfigSchemaFile,
+}
+
+func syncMigrations(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+
+	cutoffs, err := cmd.Flags().GetStringSlice("to")
+	if err != nil {
+		return err
+	}
+
+	versions, err := cmd.Flags().GetStringSlice("version")
+	if err != nil {
+		return err
+	}
+
+	if len(cutoffs) == 0 && len(versions) == 0 {
+		return errors.New("no sync target given, use --to or --version")
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	planFile, err := cmd.Flags().GetString("plan")
+	if err != nil {
+		return err
+	}
+
+	db, err := rockhopper.OpenWithConfig(config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	db.SetForceIrreversible(force)
+
+	if err := db.Touch(ctx); err != nil {
+		return err
+	}
+
+	loader := rockhopper.NewSqlMigrationLoader(config)
+
+	migrations, err := loader.Scan(config.MigrationsDirs...)
+	if err != nil {
+		return err
+	}
+
+	if len(migrations) == 0 {
+		log.Infof("no migrations found")
+		return nil
+	}
+
+	target := rockhopper.SyncTarget{Cutoffs: map[string]int64{}}
+	for _, s := range cutoffs {
+		ref, err := parseSyncRef(migrations, s)
+		if err != nil {
+			return err
+		}
+
+		target.Cutoffs[ref.Package] = ref.Version
+	}
+
+	for _, s := range versions {
+		ref, err := parseSyncRef(migrations, s)
+		if err != nil {
+			return err
+		}
+
+		target.Versions = append(target.Versions, ref)
+	}
+
+	plan, err := rockhopper.NewPlanner(db, migrations).PlanSync(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	if planFile != "" {
+		return runPlan(ctx, db, plan, planFile)
+	}
+
+	if len(plan.Steps) == 0 {
+		log.Infof("the applied migrations are in sync")
+		return nil
+	}
+
+	printPlan(plan)
+	if dryRun {
+		return nil
+	}
+
+	return db.ExecutePlan(ctx, plan)
+}
+
+// parseSyncRef parses a migration of the sync target; a bare version is in
+// the only package of the migrations.
+func parseSyncRef(migrations rockhopper.MigrationSlice, s string) (rockhopper.MigrationRef, error) {
+	ref, err := rockhopper.ParseMigrationRef(s)
+	if err != nil {
+		return ref, err
+	}
+
+	if ref.Package == "" {
+		ref.Package, err = selectPackage(migrations, "")
+	}
+
+	return ref, err
+}
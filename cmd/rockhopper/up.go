@@ -15,6 +15,10 @@ func init() {
 	UpCmd.Flags().Int64("to", 0, "up to a specific version")
 	UpCmd.Flags().Int("steps", 0, "run upgrade by steps")
 	UpCmd.Flags().Bool("allow-out-of-order", false, "apply pending migrations whose version is below an already-applied migration")
+	UpCmd.Flags().Bool("check", false, "lint the pending migrations and refuse to apply them when dangerous DDL is found (see validate)")
+	UpCmd.Flags().String("plan", "", "write the plan to this file, - for stdout, instead of applying it (see apply)")
+	UpCmd.Flags().Bool("atomic", false, "apply every migration in one transaction, refused on mysql and for '-- !txn' migrations")
+	addWaitForDBFlag(UpCmd)
 	rootCmd.AddCommand(UpCmd)
 }
 
@@ -25,10 +29,11 @@ var UpCmd = &cobra.Command{
 	// SilenceUsage is an option to silence usage when an error occurs.
 	SilenceUsage: true,
 	RunE:         up,
+	PostRunE:     writeConfigSchemaFile,
 }
 
 func up(cmd *cobra.Command, args []string) error {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 
 	if err := checkConfig(config); err != nil {
@@ -50,6 +55,21 @@ func up(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	check, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return err
+	}
+
+	planFile, err := cmd.Flags().GetString("plan")
+	if err != nil {
+		return err
+	}
+
+	atomic, err := cmd.Flags().GetBool("atomic")
+	if err != nil {
+		return err
+	}
+
 	db, err := rockhopper.OpenWithConfig(config)
 	if err != nil {
 		return err
@@ -57,13 +77,15 @@ func up(cmd *cobra.Command, args []string) error {
 
 	defer db.Close()
 
+	db.SetAtomic(atomic)
+
 	if err := db.Touch(ctx); err != nil {
 		return err
 	}
 
 	loader := rockhopper.NewSqlMigrationLoader(config)
 
-	allMigrations, err := loader.Load(config.MigrationsDirs...)
+	allMigrations, err := loader.Scan(config.MigrationsDirs...)
 	if err != nil {
 		return err
 	}
@@ -75,66 +97,29 @@ func up(cmd *cobra.Command, args []string) error {
 
 	debugMigrations(allMigrations)
 
-	migrationMap := allMigrations.MapByPackage()
-
 	if len(config.IncludePackages) > 0 {
-		migrationMap = migrationMap.FilterPackage(config.IncludePackages)
+		allMigrations = allMigrations.FilterPackage(config.IncludePackages)
 	}
 
-	migrationMap = migrationMap.SortAndConnect()
+	planner := rockhopper.NewPlanner(db, allMigrations)
+	planner.AllowOutOfOrder = allowOutOfOrder
 
-	for pkgName, migrations := range migrationMap {
-		status, err := db.InspectMigrations(ctx, migrations)
+	plan, err := planner.PlanUp(ctx, steps, to)
+	if err != nil {
+		return err
+	}
+
+	// lint everything that is about to run before applying anything
+	if check {
+		pending, err := planMigrations(plan)
 		if err != nil {
 			return err
 		}
 
-		if len(status.OutOfOrder) > 0 {
-			if !allowOutOfOrder {
-				return &rockhopper.OutOfOrderError{
-					Package:               pkgName,
-					HighestAppliedVersion: status.HighestAppliedVersion,
-					Migrations:            status.OutOfOrder,
-				}
-			}
-
-			for _, m := range status.OutOfOrder {
-				log.Warnf("applying out-of-order migration %d (%s); it is older than the already-applied version %d",
-					m.Version, m.Source, status.HighestAppliedVersion)
-			}
-		}
-
-		target := selectPending(status.Pending, steps, to)
-		if err := rockhopper.UpMigrations(ctx, db, target); err != nil {
+		if err := lintMigrations(pending); err != nil {
 			return err
 		}
 	}
 
-	return nil
-}
-
-// selectPending narrows the pending migrations down to those that should be applied
-// for this run. steps takes precedence over to: with steps > 0 it returns at most
-// that many migrations; otherwise with to > 0 it returns those at or below the
-// target version. The slice is assumed to be in ascending version order.
-func selectPending(pending rockhopper.MigrationSlice, steps int, to int64) rockhopper.MigrationSlice {
-	if steps > 0 {
-		if steps < len(pending) {
-			return pending[:steps]
-		}
-		return pending
-	}
-
-	if to > 0 {
-		var selected rockhopper.MigrationSlice
-		for _, m := range pending {
-			if m.Version > to {
-				break
-			}
-			selected = append(selected, m)
-		}
-		return selected
-	}
-
-	return pending
+	return runPlan(ctx, db, plan, planFile)
 }
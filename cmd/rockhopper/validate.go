@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
+)
+
+func init() {
+	rootCmd.AddCommand(ValidateCmd)
+}
+
+var ValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "check the migration files for dangerous DDL",
+	Long: "parse the migration files and check their statements for DDL footguns, such as a\n" +
+		"non-concurrent index build on PostgreSQL or a table-copying ALTER TABLE on MySQL.\n\n" +
+		"Suppress a finding with a '-- +lint-ignore <rule>' annotation before the statement,\n" +
+		"or before '-- +up' for the whole file. The database is not touched.",
+
+	// SilenceUsage is an option to silence usage when an error occurs.
+	SilenceUsage: true,
+	RunE:         validate,
+}
+
+func validate(cmd *cobra.Command, args []string) error {
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+
+	loader := rockhopper.NewSqlMigrationLoader(config)
+
+	allMigrations, err := loader.Load(config.MigrationsDirs...)
+	if err != nil {
+		return err
+	}
+
+	if err := lintMigrations(allMigrations); err != nil {
+		return err
+	}
+
+	log.Infof("%d migrations validated", len(allMigrations))
+	return nil
+}
+
+// lintMigrations runs the lint rules of the configured dialect and returns a
+// *rockhopper.LintError when any statement is flagged.
+func lintMigrations(migrations rockhopper.MigrationSlice) error {
+	dialectName := config.Dialect
+	if dialectName == "" {
+		dialectName = config.Driver
+	}
+
+	findings := rockhopper.LintMigrations(dialectName, migrations)
+	if len(findings) > 0 {
+		return &rockhopper.LintError{Findings: findings}
+	}
+
+	return nil
+}
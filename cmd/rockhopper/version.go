@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+
+	"github.com/c9s/rockhopper/v2"
 )
 
 // These variables are injected at build time via -ldflags "-X main.Version=...".
@@ -29,5 +31,8 @@ var versionCmd = &cobra.Command{
 }
 
 func init() {
+	// record the CLI version with every applied migration
+	rockhopper.ToolVersion = Version
+
 	rootCmd.AddCommand(versionCmd)
 }
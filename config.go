@@ -2,6 +2,7 @@ package rockhopper
 
 import (
 	"os"
+	"time"
 
 	"github.com/codingconcepts/env"
 	"gopkg.in/yaml.v3"
@@ -31,6 +32,33 @@ type Config struct {
 
 	// IncludePackages is used as a whitelist for the migration packages, optional
 	IncludePackages []string `json:"includePackages" yaml:"includePackages"`
+
+	// SchemaFile is the path of the schema dump written after up, down and redo,
+	// optional. Commit it so reviewers see the effective schema of a migration.
+	SchemaFile string `json:"schemaFile" yaml:"schemaFile" env:"ROCKHOPPER_SCHEMA_FILE"`
+
+	// KeepLegacyTables keeps the version table of goose, golang-migrate,
+	// Flyway, sqlx, Liquibase or Atlas after importing it, instead of dropping
+	// it. Useful while another service still runs the old tool.
+	KeepLegacyTables bool `json:"keepLegacyTables" yaml:"keepLegacyTables" env:"ROCKHOPPER_KEEP_LEGACY_TABLES"`
+
+	// StrictImplicitCommits fails a transactional migration that mixes DDL
+	// statements with other statements on MySQL and TiDB, where each DDL
+	// statement commits the transaction, instead of warning about it.
+	StrictImplicitCommits bool `json:"strictImplicitCommits" yaml:"strictImplicitCommits" env:"ROCKHOPPER_STRICT_IMPLICIT_COMMITS"`
+
+	// WaitForDB is how long to wait for the database to accept connections
+	// before migrating, e.g. 30s, for a migration job that may start before
+	// the database. Zero does not wait.
+	WaitForDB time.Duration `json:"waitForDB" yaml:"waitForDB" env:"ROCKHOPPER_WAIT_FOR_DB"`
+
+	// Actor is recorded as the user who applied a migration, e.g. the name of a
+	// CI job. Defaults to the OS user.
+	Actor string `json:"actor" yaml:"actor" env:"ROCKHOPPER_ACTOR"`
+
+	// BuildID identifies the build of the application, e.g. a git commit,
+	// recorded with every applied migration.
+	BuildID string `json:"buildId" yaml:"buildId" env:"ROCKHOPPER_BUILD_ID"`
 }
 
 func LoadConfig(configFile string) (*Config, error) {
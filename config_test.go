@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -103,3 +104,17 @@ func TestLoadConfig_ExpandsEnv(t *testing.T) {
 		}
 	})
 }
+
+func TestLoadConfig_WaitForDB(t *testing.T) {
+	path := writeTempConfig(t, "driver: mysql\nwaitForDB: 30s\n")
+	config, err := LoadConfig(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 30*time.Second, config.WaitForDB)
+	}
+
+	t.Setenv("ROCKHOPPER_WAIT_FOR_DB", "1m")
+	config, err = LoadConfig(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Minute, config.WaitForDB)
+	}
+}
@@ -1,8 +1,86 @@
 package rockhopper
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
+
+// IrreversibleMigrationError is returned when a down would roll back a
+// migration without down statements. Removing its version record would report
+// success while its changes stay in the database.
+type IrreversibleMigrationError struct {
+	Migration *Migration
+}
+
+func (e *IrreversibleMigrationError) Error() string {
+	reason := "it has no down statements"
+	if e.Migration.Irreversible {
+		reason = "it is marked irreversible"
+	}
+
+	return fmt.Sprintf("migration %s can not be rolled back: %s; re-run with --force to remove its version record without rolling it back",
+		e.Migration.location(), reason)
+}
+
+// SetForceIrreversible makes down remove the version record of a migration
+// that can not be rolled back, instead of returning IrreversibleMigrationError.
+func (db *DB) SetForceIrreversible(force bool) {
+	db.forceIrreversible = force
+}
+
+// checkReversible parses a scanned migration, whose down statements are not
+// known before, and returns IrreversibleMigrationError when it can not be
+// rolled back.
+func (db *DB) checkReversible(m *Migration) error {
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
+	if m.Reversible() || db.forceIrreversible {
+		return nil
+	}
+
+	return &IrreversibleMigrationError{Migration: m}
+}
+
+// DownPackage rolls back the applied migrations of package pkgName above
+// version to, or all of them when to is 0. An empty pkgName selects the only
+// package of the migrations, see MigrationSlice.ForPackage.
+func DownPackage(ctx context.Context, db *DB, migrations MigrationSlice, pkgName string, to int64, callbacks ...func(m *Migration)) error {
+	// without a version, every applied migration is one of the last steps
+	var steps int
+	if to == 0 {
+		steps = len(migrations)
+	}
+
+	plan, err := NewPlanner(db, migrations).PlanDown(ctx, pkgName, steps, to)
+	if err != nil {
+		return err
+	}
+
+	return db.ExecutePlan(ctx, plan, callbacks...)
+}
+
+// DownPackageBySteps rolls back the last steps applied migrations of package
+// pkgName, see DownPackage.
+func DownPackageBySteps(ctx context.Context, db *DB, migrations MigrationSlice, pkgName string, steps int, callbacks ...func(m *Migration)) error {
+	plan, err := NewPlanner(db, migrations).PlanDown(ctx, pkgName, steps, 0)
+	if err != nil {
+		return err
+	}
+
+	return db.ExecutePlan(ctx, plan, callbacks...)
+}
 
 func DownBySteps(ctx context.Context, db *DB, m *Migration, steps int, callbacks ...func(m *Migration)) error {
+	// check every migration first, so that none is rolled back when one of
+	// them can not be
+	for p, n := m, steps; p != nil && n > 0; p, n = p.Previous, n-1 {
+		if err := db.checkReversible(p); err != nil {
+			return err
+		}
+	}
+
 	for ; steps > 0; steps-- {
 		if err := m.Down(ctx, db); err != nil {
 			return err
@@ -23,6 +101,16 @@ func DownBySteps(ctx context.Context, db *DB, m *Migration, steps int, callbacks
 }
 
 func Down(ctx context.Context, db *DB, m *Migration, to int64, callbacks ...func(m *Migration)) error {
+	for p := m; p != nil; p = p.Previous {
+		if to > 0 && p.Version <= to {
+			break
+		}
+
+		if err := db.checkReversible(p); err != nil {
+			return err
+		}
+	}
+
 	for ; m != nil; m = m.Previous {
 		if to > 0 && m.Version <= to {
 			break
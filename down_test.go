@@ -0,0 +1,84 @@
+package rockhopper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDown_Irreversible(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_create_users.sql", "-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n")
+	writeTestMigrationFile(t, dir, "20240102120000_backfill.sql", "-- +irreversible\n-- +up\nINSERT INTO users (id) VALUES (1);\n")
+	writeTestMigrationFile(t, dir, "20240103120000_create_posts.sql", "-- +up\nCREATE TABLE posts (id INT);\n-- +down\nDROP TABLE posts;\n")
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+	require.True(t, migrations[1].Irreversible)
+
+	db := openTestDB(t)
+	require.NoError(t, Up(ctx, db, migrations.Head(), 0))
+
+	appliedVersions := func() (versions []int64) {
+		for _, m := range migrations {
+			m.Record = nil
+			_, err := db.LoadMigration(ctx, m)
+			require.NoError(t, err)
+			if m.Record != nil && m.Record.IsApplied {
+				versions = append(versions, m.Version)
+			}
+		}
+		return versions
+	}
+
+	var irreversibleErr *IrreversibleMigrationError
+
+	err = DownBySteps(ctx, db, migrations.Tail(), 2)
+	if assert.ErrorAs(t, err, &irreversibleErr) {
+		assert.Equal(t, migrations[1], irreversibleErr.Migration)
+	}
+	assert.Equal(t, []int64{20240101120000, 20240102120000, 20240103120000}, appliedVersions(), "nothing is rolled back")
+
+	assert.ErrorAs(t, Down(ctx, db, migrations.Tail(), 0), &irreversibleErr)
+	assert.ErrorAs(t, Align(ctx, db, 20240101120000, migrations), &irreversibleErr)
+	assert.ErrorAs(t, Redo(ctx, db, migrations[1]), &irreversibleErr)
+	assert.Equal(t, []int64{20240101120000, 20240102120000, 20240103120000}, appliedVersions())
+
+	db.SetForceIrreversible(true)
+	require.NoError(t, DownBySteps(ctx, db, migrations.Tail(), 2))
+	assert.Equal(t, []int64{20240101120000}, appliedVersions())
+}
+
+func TestDown_Scanned(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_create_a.sql", "-- +up\nCREATE TABLE a (id INT);\n-- +down\nDROP TABLE a;\n")
+	writeTestMigrationFile(t, dir, "20240102120000_create_b.sql", "-- +up\nCREATE TABLE b (id INT);\n-- +down\nDROP TABLE b;\n")
+
+	scan := func() MigrationSlice {
+		migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Scan(dir)
+		require.NoError(t, err)
+		return migrations
+	}
+
+	db := openTestDB(t)
+	require.NoError(t, Up(ctx, db, scan().Head(), 0))
+
+	// the down statements of a scanned migration are parsed on demand
+	require.NoError(t, DownBySteps(ctx, db, scan().Tail(), 1))
+	_, err := db.Exec("SELECT COUNT(*) FROM b")
+	assert.Error(t, err, "b is rolled back")
+
+	require.NoError(t, Down(ctx, db, scan().Head(), 0))
+	_, err = db.Exec("SELECT COUNT(*) FROM a")
+	assert.Error(t, err, "a is rolled back")
+
+	writeTestMigrationFile(t, dir, "20240102120000_create_b.sql", "-- +up\nCREATE TABLE b (id INT);\n-- +down\n-- +begin\nDROP TABLE b;\n")
+	assert.Error(t, Down(ctx, db, scan().Tail(), 0), "the parse error is returned")
+}
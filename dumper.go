@@ -2,6 +2,7 @@ package rockhopper
 
 import (
 	"bytes"
+	"fmt"
 	"go/format"
 	"os"
 	"path/filepath"
@@ -91,7 +92,7 @@ func Migrations() rockhopper.MigrationSlice {
 }
 
 // AddMigration adds a migration with its runtime caller information
-func AddMigration(packageName string, up, down rockhopper.TransactionHandler) {
+func AddMigration(packageName string, up, down rockhopper.TransactionHandler, opts ...rockhopper.MigrationOption) {
 	pc, filename, _, _ := runtime.Caller(1)
 
 	if packageName == "" {
@@ -99,7 +100,7 @@ func AddMigration(packageName string, up, down rockhopper.TransactionHandler) {
 		packageName = _parseFuncPackageName(funcName)
 	}
 
-	AddNamedMigration(packageName, filename, up, down)
+	AddNamedMigration(packageName, filename, up, down, opts...)
 }
 
 // parseFuncPackageName parses the package name from a given runtime caller function name 
@@ -116,7 +117,7 @@ func _parseFuncPackageName(funcName string) string {
 
 
 // AddNamedMigration adds a named migration to the registered go migration map
-func AddNamedMigration(packageName, filename string, up, down rockhopper.TransactionHandler) {
+func AddNamedMigration(packageName, filename string, up, down rockhopper.TransactionHandler, opts ...rockhopper.MigrationOption) {
 	v, err := rockhopper.FileNumericComponent(filename)
 	if err != nil {
 		panic(fmt.Errorf("unable to parse numeric component from filename %s: %v", filename, err))
@@ -133,6 +134,10 @@ func AddNamedMigration(packageName, filename string, up, down rockhopper.Transac
 		UseTx:   true,
 	}
 
+	for _, opt := range opts {
+		opt(migration)
+	}
+
 	key := rockhopper.RegistryKey{ Package: packageName, Version: v}
 	if existing, ok := registeredGoMigrations[key]; ok {
 		panic(fmt.Sprintf("failed to add migration %q: version conflicts with key %+v: %+v", filename, key, existing))
@@ -144,7 +149,7 @@ func AddNamedMigration(packageName, filename string, up, down rockhopper.Transac
 // AddStatementMigration registers a migration that was compiled from a .sql file.
 // The SQL statements are kept as data (rather than baked into a function body) so
 // the console can preview each statement while the migration runs.
-func AddStatementMigration(packageName string, version int64, source string, useTx bool, upStatements, downStatements []rockhopper.Statement) {
+func AddStatementMigration(packageName string, version int64, source string, useTx bool, upStatements, downStatements []rockhopper.Statement, opts ...rockhopper.MigrationOption) {
 	migration := &rockhopper.Migration{
 		Package:    packageName,
 		Registered: true,
@@ -157,6 +162,10 @@ func AddStatementMigration(packageName string, version int64, source string, use
 		DownStatements: downStatements,
 	}
 
+	for _, opt := range opts {
+		opt(migration)
+	}
+
 	key := rockhopper.RegistryKey{ Package: packageName, Version: version}
 	if existing, ok := registeredGoMigrations[key]; ok {
 		panic(fmt.Sprintf("failed to add migration %q: version conflicts with key %+v: %+v", source, key, existing))
@@ -178,14 +187,23 @@ func init() {
 	AddStatementMigration({{ .Migration.Package | quote }}, {{ .Migration.Version }}, {{ .Migration.Source | quote }}, {{ .Migration.UseTx }},
 		[]rockhopper.Statement{
 {{- range .Migration.UpStatements }}
-			{Direction: rockhopper.DirectionUp, SQL: {{ .SQL | quote }}},
+			{Direction: rockhopper.DirectionUp, SQL: {{ .SQL | quote }}{{ if .Line }}, Line: {{ .Line }}{{ end }}{{ if .File }}, File: {{ .File | quote }}{{ end }}},
 {{- end }}
 		},
 		[]rockhopper.Statement{
 {{- range .Migration.DownStatements }}
-			{Direction: rockhopper.DirectionDown, SQL: {{ .SQL | quote }}},
+			{Direction: rockhopper.DirectionDown, SQL: {{ .SQL | quote }}{{ if .Line }}, Line: {{ .Line }}{{ end }}{{ if .File }}, File: {{ .File | quote }}{{ end }}},
 {{- end }}
 		},
+{{- range .Migration.Requires }}
+		rockhopper.Requires({{ .Package | quote }}, {{ .Version }}),
+{{- end }}
+{{- if .Migration.BatchSize }}
+		rockhopper.BatchStatements({{ .Migration.BatchSize }}),
+{{- end }}
+{{- if .Migration.SquashedFrom }}
+		rockhopper.SquashedFrom({{ .Migration.SquashedFrom }}),
+{{- end }}
 	)
 }`))
 
@@ -223,6 +241,10 @@ type migrationTemplateArgs struct {
 var specialCharsRegExp = regexp.MustCompile(`\W`)
 
 func renderMigration(packageName string, m *Migration) ([]byte, error) {
+	if m.Stream {
+		return nil, fmt.Errorf("%s: a '-- +stream' migration can not be compiled, its statements are read from the file when it runs", filepath.Base(m.Source))
+	}
+
 	buf := bytes.NewBuffer(nil)
 	err := migrationTemplate.Execute(buf, migrationTemplateArgs{
 		Migration:   m,
@@ -283,6 +305,10 @@ func (d *GoMigrationDumper) Dump(migrations MigrationSlice) error {
 		return err
 	}
 
+	if err := migrations.Parse(); err != nil {
+		return err
+	}
+
 	for _, migration := range migrations {
 		err := d.DumpMigration(migration)
 		if err != nil {
@@ -294,6 +320,10 @@ func (d *GoMigrationDumper) Dump(migrations MigrationSlice) error {
 }
 
 func (d *GoMigrationDumper) DumpMigration(m *Migration) error {
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
 	packageName := d.PackageName
 	if len(packageName) == 0 {
 		packageName = filepath.Base(d.Dir)
@@ -304,7 +334,11 @@ func (d *GoMigrationDumper) DumpMigration(m *Migration) error {
 		return err
 	}
 
-	goFilename := filepath.Join(d.Dir,
+	return os.WriteFile(d.MigrationFilename(m), out, 0600)
+}
+
+// MigrationFilename returns the path of the go file DumpMigration writes for m.
+func (d *GoMigrationDumper) MigrationFilename(m *Migration) string {
+	return filepath.Join(d.Dir,
 		specialCharsRegExp.ReplaceAllLiteralString(m.Package, "_")+"_"+replaceExt(filepath.Base(m.Source), ".go"))
-	return os.WriteFile(goFilename, out, 0600)
 }
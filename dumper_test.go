@@ -20,11 +20,14 @@ func TestRenderMigrationKeepsStatements(t *testing.T) {
 		Source:  "migrations/20200101000000_create_invoices.sql",
 		UseTx:   true,
 		UpStatements: []Statement{
-			{Direction: DirectionUp, SQL: "CREATE TABLE invoices (id INT PRIMARY KEY)"},
+			{Direction: DirectionUp, SQL: "CREATE TABLE invoices (id INT PRIMARY KEY)", Line: 2, File: "migrations/20200101000000_create_invoices.sql"},
 		},
 		DownStatements: []Statement{
 			{Direction: DirectionDown, SQL: "DROP TABLE invoices"},
 		},
+		Requires:     []MigrationRef{{Package: "users", Version: 20190101000000}},
+		BatchSize:    50,
+		SquashedFrom: 20190601000000,
 	}
 
 	out, err := renderMigration("migrations", m)
@@ -38,6 +41,14 @@ func TestRenderMigrationKeepsStatements(t *testing.T) {
 	assert.Contains(t, src, "CREATE TABLE invoices (id INT PRIMARY KEY)")
 	assert.Contains(t, src, "DROP TABLE invoices")
 
+	// the statement location is kept for error messages
+	assert.Contains(t, src, `Line: 2, File: "migrations/20200101000000_create_invoices.sql"`)
+
+	// and so are the required migrations
+	assert.Contains(t, src, `rockhopper.Requires("users", 20190101000000)`)
+	assert.Contains(t, src, `rockhopper.BatchStatements(50)`)
+	assert.Contains(t, src, `rockhopper.SquashedFrom(20190601000000)`)
+
 	// the SQL must no longer be hidden inside generated function bodies
 	assert.NotContains(t, src, "func up")
 	assert.NotContains(t, src, "tx.ExecContext")
@@ -0,0 +1,62 @@
+package rockhopper
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// GolangMigrateTableName is the version table of golang-migrate.
+const GolangMigrateTableName = "schema_migrations"
+
+// golangMigrateImporter imports the version table of golang-migrate. It keeps
+// only the current version, which is imported as a baseline.
+type golangMigrateImporter struct{}
+
+func (golangMigrateImporter) Name() string { return "golang-migrate" }
+
+func (golangMigrateImporter) TableName() string { return GolangMigrateTableName }
+
+func (golangMigrateImporter) Load(ctx context.Context, db *DB, table string) ([]ImportedVersion, error) {
+	// the schema_migrations table of Rails has no dirty column
+	rows, err := queryHistoryTable(ctx, db, fmt.Sprintf(`SELECT version, dirty FROM %s`, table))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var version int64
+	var dirty bool
+	for rows.Next() {
+		var v int64
+		var d bool
+		if err := rows.Scan(&v, &d); err != nil {
+			return nil, err
+		}
+
+		// golang-migrate keeps a single row, take the highest one anyway
+		if v > version {
+			version, dirty = v, d
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if dirty {
+		return nil, &DirtyHistoryError{Table: table, Version: strconv.FormatInt(version, 10), Hint: "run `migrate force <version>`"}
+	}
+
+	if version == 0 {
+		return nil, nil
+	}
+
+	return []ImportedVersion{{
+		Package:  DefaultPackageName,
+		Version:  version,
+		Baseline: true,
+		Ref:      "version " + strconv.FormatInt(version, 10),
+	}}, nil
+}
@@ -0,0 +1,161 @@
+package rockhopper
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openGolangMigrateTestDB(t *testing.T, setup ...string) *DB {
+	t.Helper()
+
+	dialect, err := LoadDialect("sqlite3")
+	require.NoError(t, err)
+
+	db, err := Open("sqlite3", dialect, ":memory:", TableName)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	for _, q := range setup {
+		_, err := db.Exec(q)
+		require.NoError(t, err)
+	}
+
+	return db
+}
+
+func TestSqlMigrationLoader_PairFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "000001_create_users.up.sql", "CREATE TABLE users (id INT);\n\nCREATE INDEX idx_users_id ON users (id);\n")
+	writeTestMigrationFile(t, dir, "000001_create_users.down.sql", "DROP TABLE users;\n")
+	writeTestMigrationFile(t, dir, "000002_create_posts.up.sql", "-- @package blog\nCREATE TABLE posts (id INT);\n")
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	users := migrations[0]
+	assert.Equal(t, int64(1), users.Version)
+	assert.Equal(t, "create_users", users.Name)
+	assert.Equal(t, DefaultPackageName, users.Package)
+	assert.Equal(t, filepath.Join(dir, "000001_create_users.up.sql"), users.Source)
+	assert.Equal(t, filepath.Join(dir, "000001_create_users.down.sql"), users.DownSource)
+	assert.True(t, users.UseTx)
+	assert.Equal(t, []string{"CREATE TABLE users (id INT);", "CREATE INDEX idx_users_id ON users (id);"}, statementSQLs(users.UpStatements))
+	assert.Equal(t, 3, users.UpStatements[1].Line)
+	if assert.Len(t, users.DownStatements, 1) {
+		assert.Equal(t, DirectionDown, users.DownStatements[0].Direction)
+		assert.Equal(t, users.DownSource, users.DownStatements[0].File)
+	}
+
+	posts := migrations[1]
+	assert.Equal(t, "blog", posts.Package)
+	assert.Empty(t, posts.DownSource)
+	assert.Empty(t, posts.DownStatements)
+
+	t.Run("down file without up file", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestMigrationFile(t, dir, "000003_orphan.down.sql", "DROP TABLE orphan;\n")
+
+		_, err := loader.Load(dir)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "000003_orphan.down.sql")
+		}
+	})
+}
+
+func TestGolangMigrateTableImport(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "000001_create_users.up.sql", "CREATE TABLE users (id INT);\n")
+	writeTestMigrationFile(t, dir, "000001_create_users.down.sql", "DROP TABLE users;\n")
+	writeTestMigrationFile(t, dir, "000002_create_posts.up.sql", "CREATE TABLE posts (id INT);\n")
+	writeTestMigrationFile(t, dir, "000002_create_posts.down.sql", "DROP TABLE posts;\n")
+	writeTestMigrationFile(t, dir, "000003_create_tags.up.sql", "CREATE TABLE tags (id INT);\n")
+	writeTestMigrationFile(t, dir, "000003_create_tags.down.sql", "DROP TABLE tags;\n")
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+
+	// golang-migrate applied up to version 2
+	db := openGolangMigrateTestDB(t,
+		`CREATE TABLE users (id INT)`,
+		`CREATE TABLE posts (id INT)`,
+		`CREATE TABLE schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`,
+		`INSERT INTO schema_migrations (version, dirty) VALUES (2, false)`,
+	)
+	require.NoError(t, db.Touch(ctx))
+
+	tableNames, err := db.getTableNames(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, tableNames, GolangMigrateTableName)
+
+	status, err := db.InspectMigrations(ctx, migrations)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), status.HighestAppliedVersion)
+	assert.Empty(t, status.OutOfOrder, "the versions below the imported one are applied")
+	if assert.Len(t, status.Pending, 1) {
+		assert.Equal(t, int64(3), status.Pending[0].Version)
+	}
+
+	require.NoError(t, Up(ctx, db, migrations.Tail(), 0))
+
+	appliedVersions := func() (versions []int64) {
+		for _, m := range migrations {
+			m.Record = nil
+			_, err := db.LoadMigration(ctx, m)
+			require.NoError(t, err)
+			if m.Record != nil && m.Record.IsApplied {
+				versions = append(versions, m.Version)
+			}
+		}
+		return versions
+	}
+	assert.Equal(t, []int64{1, 2, 3}, appliedVersions())
+
+	// rolling back below the imported version keeps the lower versions applied
+	require.NoError(t, DownBySteps(ctx, db, migrations.Tail(), 2))
+	assert.Equal(t, []int64{1}, appliedVersions())
+
+	require.NoError(t, DownBySteps(ctx, db, migrations.Head(), 1))
+	assert.Empty(t, appliedVersions())
+
+	tableNames, err = db.getTableNames(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, tableNames, "users")
+}
+
+func TestGolangMigrateTableImport_Dirty(t *testing.T) {
+	db := openGolangMigrateTestDB(t,
+		`CREATE TABLE schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`,
+		`INSERT INTO schema_migrations (version, dirty) VALUES (5, true)`,
+	)
+
+	var dirtyErr *DirtyHistoryError
+	if assert.ErrorAs(t, db.Touch(context.Background()), &dirtyErr) {
+		assert.Equal(t, "5", dirtyErr.Version)
+		assert.Contains(t, dirtyErr.Error(), "migrate force")
+	}
+}
+
+func TestGolangMigrateTableImport_OtherTool(t *testing.T) {
+	ctx := context.Background()
+
+	// Rails names its version table schema_migrations too
+	db := openGolangMigrateTestDB(t,
+		`CREATE TABLE schema_migrations (version varchar NOT NULL PRIMARY KEY)`,
+	)
+	require.NoError(t, db.Touch(ctx))
+
+	tableNames, err := db.getTableNames(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, tableNames, GolangMigrateTableName, "a table of another tool is left alone")
+	assert.Contains(t, tableNames, TableName)
+}
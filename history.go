@@ -0,0 +1,268 @@
+package rockhopper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/c9s/rockhopper/v2/pkg/dialect"
+)
+
+// baselineSourceFile is the source_file of an imported baseline record. Some
+// tools keep only their current version, or start from a baseline, so such a
+// record also stands for every lower version of its package.
+const baselineSourceFile = "(baseline)"
+
+// ErrNotImportable is returned by HistoryImporter.Load when the table belongs
+// to a tool that uses the same table name, e.g. the schema_migrations table of
+// Rails.
+var ErrNotImportable = errors.New("not an importable history table")
+
+// ImportedVersion is a migration applied by another tool, mapped to a record
+// of the version table.
+type ImportedVersion struct {
+	Package    string
+	Version    int64
+	SourceFile string
+
+	// Baseline marks a record that stands for every lower version of the
+	// package too. It is stored with the "(baseline)" source file.
+	Baseline bool
+
+	// Ref identifies the row of the legacy table, for the import report.
+	Ref string
+}
+
+// DirtyHistoryError is returned when the history table of another tool has a
+// failed or partially applied migration, so it is unknown which of its
+// statements were applied.
+type DirtyHistoryError struct {
+	Table   string
+	Version string
+
+	// Hint tells how the tool clears the failure.
+	Hint string
+}
+
+func (e *DirtyHistoryError) Error() string {
+	return fmt.Sprintf("history table %s is dirty at version %s; fix the database by hand and %s before switching to rockhopper",
+		e.Table, e.Version, e.Hint)
+}
+
+// HistoryImporter adopts the history table of another migration tool. When
+// the rockhopper version table does not exist yet, runCoreMigration imports
+// the first table of HistoryImporters it finds, and drops it unless the DB
+// keeps legacy tables.
+type HistoryImporter interface {
+	// Name is the name of the tool.
+	Name() string
+
+	// TableName is the history table of the tool, matched case-insensitively.
+	TableName() string
+
+	// Load maps the applied migrations of the table, named as in the database.
+	// It returns ErrNotImportable when the table belongs to another tool.
+	Load(ctx context.Context, db *DB, table string) ([]ImportedVersion, error)
+}
+
+// HistoryImporters are the importers tried by runCoreMigration, in order.
+var HistoryImporters = []HistoryImporter{
+	golangMigrateImporter{},
+	flywayImporter{},
+	sqlxImporter{},
+	liquibaseImporter{},
+	atlasImporter{},
+}
+
+// HistoryImport is the mapping of the history table of another tool.
+type HistoryImport struct {
+	Importer HistoryImporter
+	Table    string
+
+	// Versions are sorted by package and version.
+	Versions []ImportedVersion
+}
+
+// SetKeepLegacyTables keeps the history table of another tool, or the goose
+// version table, after importing it instead of dropping it.
+func (db *DB) SetKeepLegacyTables(keep bool) {
+	db.keepLegacyTables = keep
+}
+
+// PlanHistoryImport maps the history table of another tool without changing
+// the database. It returns nil when the rockhopper version table exists or no
+// importable table is found.
+func (db *DB) PlanHistoryImport(ctx context.Context) (*HistoryImport, error) {
+	tableNames, err := db.getTableNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if sliceContains(tableNames, TableName) {
+		return nil, nil
+	}
+
+	return db.planHistoryImport(ctx, tableNames)
+}
+
+func (db *DB) planHistoryImport(ctx context.Context, tableNames []string) (*HistoryImport, error) {
+	for _, importer := range HistoryImporters {
+		table := findTableName(tableNames, importer.TableName())
+		if table == "" {
+			continue
+		}
+
+		versions, err := importer.Load(ctx, db, table)
+		if errors.Is(err, ErrNotImportable) {
+			log.Debugf("%s is not a %s history table: %v", table, importer.Name(), err)
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to import the %s history table %s", importer.Name(), table)
+		}
+
+		sort.SliceStable(versions, func(i, j int) bool {
+			if versions[i].Package != versions[j].Package {
+				return versions[i].Package < versions[j].Package
+			}
+			return versions[i].Version < versions[j].Version
+		})
+
+		for i := 1; i < len(versions); i++ {
+			if versions[i].Package == versions[i-1].Package && versions[i].Version == versions[i-1].Version {
+				return nil, fmt.Errorf("failed to import the %s history table %s: %s and %s map to the same version %d",
+					importer.Name(), table, versions[i-1].Ref, versions[i].Ref, versions[i].Version)
+			}
+		}
+
+		return &HistoryImport{Importer: importer, Table: table, Versions: versions}, nil
+	}
+
+	return nil, nil
+}
+
+// importHistory creates the version table with the imported versions.
+func (db *DB) importHistory(ctx context.Context, plan *HistoryImport) error {
+	if err := db.createVersionTable(ctx, db, VersionRockhopperV1); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range plan.Versions {
+		source := v.SourceFile
+		if v.Baseline {
+			source = baselineSourceFile
+		}
+
+		if err := db.insertVersion(ctx, tx, v.Package, source, v.Version, true); err != nil {
+			return rollbackAndLogErr(err, tx, "unable to import %s", v.Ref)
+		}
+	}
+
+	if !db.keepLegacyTables {
+		if err := execAndCheckErr(tx, ctx, fmt.Sprintf(`DROP TABLE %s`, plan.Table)); err != nil {
+			return rollbackAndLogErr(err, tx, "unable to drop legacy table")
+		}
+	}
+
+	return tx.Commit()
+}
+
+func findTableName(tableNames []string, name string) string {
+	for _, tableName := range tableNames {
+		if strings.EqualFold(tableName, name) {
+			return tableName
+		}
+	}
+
+	return ""
+}
+
+// queryImportedBaseline returns the highest imported baseline version of the
+// package, or zero when there is none.
+func (db *DB) queryImportedBaseline(ctx context.Context, pkgName string) (int64, time.Time, error) {
+	q, args := db.dialect.Select(db.tableName,
+		[]string{"version_id", "tstamp"},
+		[]dialect.Col{
+			{Name: "package", Val: pkgName},
+			{Name: "source_file", Val: baselineSourceFile},
+		},
+		dialect.SelectOpt{OrderBy: []dialect.Order{{Col: "version_id", Desc: true}}, Limit: 1})
+
+	var version int64
+	var tstamp time.Time
+	if err := db.queryRowContext(ctx, q, args...).Scan(&version, &tstamp); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, time.Time{}, nil
+		}
+
+		return 0, time.Time{}, errors.Wrap(err, "failed to query the imported baseline")
+	}
+
+	return version, tstamp, nil
+}
+
+// loadImportedBaseline is called when m has no record of its own. A migration
+// at or below the imported baseline of its package is applied. It returns
+// (nil, nil) otherwise, like LoadMigration.
+func (db *DB) loadImportedBaseline(ctx context.Context, m *Migration) (*Migration, error) {
+	baseline, tstamp, err := db.queryImportedBaseline(ctx, m.Package)
+	if err != nil {
+		return nil, err
+	}
+
+	if baseline == 0 || m.Version > baseline {
+		return nil, nil
+	}
+
+	m.Record = importedBaselineRecord(m, tstamp)
+	return m, nil
+}
+
+// importedBaselineRecord is the record of a migration covered by the imported
+// baseline, applied when the baseline was imported.
+func importedBaselineRecord(m *Migration, tstamp time.Time) *MigrationRecord {
+	return &MigrationRecord{
+		VersionID: m.Version,
+		Time:      tstamp,
+		IsApplied: true,
+		Package:   m.Package,
+	}
+}
+
+// moveImportedBaseline is called when m is rolled back. When m is the
+// imported baseline, the lower versions it stood for stay applied, so the
+// baseline moves to the previous migration of the package.
+func (db *DB) moveImportedBaseline(ctx context.Context, exec SQLExecutor, m *Migration, baseline int64) error {
+	if baseline != m.Version {
+		return nil
+	}
+
+	if prev := m.previousPackageVersion(); prev > 0 {
+		return db.insertVersion(ctx, exec, m.Package, baselineSourceFile, prev, true)
+	}
+
+	return nil
+}
+
+// previousPackageVersion returns the version of the previous migration of the
+// package of m, found through the Previous link or recorded by the planner,
+// zero when there is none.
+func (m *Migration) previousPackageVersion() int64 {
+	for prev := m.Previous; prev != nil; prev = prev.Previous {
+		if prev.Package == m.Package {
+			return prev.Version
+		}
+	}
+
+	return m.previousVersion
+}
@@ -0,0 +1,157 @@
+package rockhopper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanHistoryImport(t *testing.T) {
+	testcases := []struct {
+		name  string
+		tool  string
+		table string
+		setup []string
+		want  []ImportedVersion
+	}{
+		{
+			name:  "flyway",
+			tool:  "flyway",
+			table: "flyway_schema_history",
+			setup: []string{
+				`CREATE TABLE flyway_schema_history (installed_rank INT NOT NULL PRIMARY KEY, version VARCHAR(50), description VARCHAR(200) NOT NULL, type VARCHAR(20) NOT NULL, script VARCHAR(1000) NOT NULL, checksum INT, installed_by VARCHAR(100) NOT NULL, installed_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, execution_time INT NOT NULL, success BOOLEAN NOT NULL)`,
+				`INSERT INTO flyway_schema_history (installed_rank, version, description, type, script, installed_by, execution_time, success) VALUES
+					(1, '1', '<< Flyway Baseline >>', 'BASELINE', '<< Flyway Baseline >>', 'app', 0, true),
+					(2, '2', 'create users', 'SQL', 'V2__create_users.sql', 'app', 10, true),
+					(3, NULL, 'views', 'SQL', 'R__views.sql', 'app', 10, true),
+					(4, '3', 'create posts', 'SQL', 'V3__create_posts.sql', 'app', 10, true),
+					(5, '3', 'create posts', 'UNDO_SQL', 'U3__create_posts.sql', 'app', 10, true)`,
+			},
+			want: []ImportedVersion{
+				{Package: DefaultPackageName, Version: 1, SourceFile: "<< Flyway Baseline >>", Baseline: true, Ref: "installed_rank 1"},
+				{Package: DefaultPackageName, Version: 2, SourceFile: "V2__create_users.sql", Ref: "installed_rank 2"},
+			},
+		},
+		{
+			name:  "sqlx",
+			tool:  "sqlx",
+			table: "_sqlx_migrations",
+			setup: []string{
+				`CREATE TABLE _sqlx_migrations (version BIGINT PRIMARY KEY, description TEXT NOT NULL, installed_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, success BOOLEAN NOT NULL, checksum BLOB NOT NULL, execution_time BIGINT NOT NULL)`,
+				`INSERT INTO _sqlx_migrations (version, description, success, checksum, execution_time) VALUES
+					(20240101120000, 'create users', true, x'00', 1),
+					(20240102120000, 'create posts', true, x'00', 1)`,
+			},
+			want: []ImportedVersion{
+				{Package: DefaultPackageName, Version: 20240101120000, SourceFile: "20240101120000_create_users.sql", Ref: "version 20240101120000"},
+				{Package: DefaultPackageName, Version: 20240102120000, SourceFile: "20240102120000_create_posts.sql", Ref: "version 20240102120000"},
+			},
+		},
+		{
+			name:  "liquibase",
+			tool:  "liquibase",
+			table: "DATABASECHANGELOG",
+			setup: []string{
+				`CREATE TABLE DATABASECHANGELOG (ID VARCHAR(255) NOT NULL, AUTHOR VARCHAR(255) NOT NULL, FILENAME VARCHAR(255) NOT NULL, DATEEXECUTED TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, ORDEREXECUTED INT NOT NULL, EXECTYPE VARCHAR(10) NOT NULL, MD5SUM VARCHAR(35))`,
+				`INSERT INTO DATABASECHANGELOG (ID, AUTHOR, FILENAME, ORDEREXECUTED, EXECTYPE) VALUES
+					('20240101120000-create-users', 'alice', 'db/changelog.xml', 1, 'EXECUTED'),
+					('20240102120000-seed', 'bob', 'db/changelog.xml', 2, 'SKIPPED'),
+					('20240103120000-create-posts', 'bob', 'db/changelog.xml', 3, 'RERAN')`,
+			},
+			want: []ImportedVersion{
+				{Package: DefaultPackageName, Version: 20240101120000, SourceFile: "db/changelog.xml", Ref: "changeset db/changelog.xml::20240101120000-create-users::alice"},
+				{Package: DefaultPackageName, Version: 20240103120000, SourceFile: "db/changelog.xml", Ref: "changeset db/changelog.xml::20240103120000-create-posts::bob"},
+			},
+		},
+		{
+			name:  "atlas",
+			tool:  "atlas",
+			table: "atlas_schema_revisions",
+			setup: []string{
+				`CREATE TABLE atlas_schema_revisions (version VARCHAR(255) NOT NULL PRIMARY KEY, description VARCHAR(255) NOT NULL, type INT NOT NULL DEFAULT 2, applied INT NOT NULL DEFAULT 0, total INT NOT NULL DEFAULT 0, executed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, execution_time BIGINT NOT NULL DEFAULT 0, error TEXT, error_stmt TEXT, hash VARCHAR(255) NOT NULL DEFAULT '', partial_hashes TEXT, operator_version VARCHAR(255) NOT NULL DEFAULT '')`,
+				`INSERT INTO atlas_schema_revisions (version, description, type, applied, total) VALUES
+					('.atlas_cloud_identifiers', '', 0, 0, 0),
+					('20240101120000', 'baseline', 1, 0, 0),
+					('20240102120000', 'create_posts', 2, 2, 2)`,
+			},
+			want: []ImportedVersion{
+				{Package: DefaultPackageName, Version: 20240101120000, SourceFile: "20240101120000_baseline.sql", Baseline: true, Ref: "version 20240101120000"},
+				{Package: DefaultPackageName, Version: 20240102120000, SourceFile: "20240102120000_create_posts.sql", Ref: "version 20240102120000"},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openGolangMigrateTestDB(t, tc.setup...)
+
+			plan, err := db.PlanHistoryImport(ctx)
+			require.NoError(t, err)
+			require.NotNil(t, plan)
+			assert.Equal(t, tc.tool, plan.Importer.Name())
+			assert.Equal(t, tc.table, plan.Table)
+			assert.Equal(t, tc.want, plan.Versions)
+
+			// planning does not change the database
+			tableNames, err := db.getTableNames(ctx)
+			require.NoError(t, err)
+			assert.NotContains(t, tableNames, TableName)
+
+			require.NoError(t, db.Touch(ctx))
+
+			tableNames, err = db.getTableNames(ctx)
+			require.NoError(t, err)
+			assert.NotContains(t, tableNames, tc.table)
+
+			last := tc.want[len(tc.want)-1]
+			m := &Migration{Package: last.Package, Version: last.Version}
+			_, err = db.LoadMigration(ctx, m)
+			require.NoError(t, err)
+			if assert.NotNil(t, m.Record) {
+				assert.True(t, m.Record.IsApplied)
+			}
+		})
+	}
+}
+
+func TestImportHistory_KeepLegacyTable(t *testing.T) {
+	ctx := context.Background()
+	db := openGolangMigrateTestDB(t,
+		`CREATE TABLE _sqlx_migrations (version BIGINT PRIMARY KEY, description TEXT NOT NULL, success BOOLEAN NOT NULL)`,
+		`INSERT INTO _sqlx_migrations (version, description, success) VALUES (1, 'init', true)`,
+	)
+	db.SetKeepLegacyTables(true)
+	require.NoError(t, db.Touch(ctx))
+
+	tableNames, err := db.getTableNames(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, tableNames, "_sqlx_migrations")
+	assert.Contains(t, tableNames, TableName)
+
+	version, err := db.CurrentVersion(ctx, DefaultPackageName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	// the version table exists now, so nothing is imported again
+	plan, err := db.PlanHistoryImport(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, plan)
+}
+
+func TestImportHistory_Dirty(t *testing.T) {
+	db := openGolangMigrateTestDB(t,
+		`CREATE TABLE flyway_schema_history (installed_rank INT NOT NULL PRIMARY KEY, version VARCHAR(50), type VARCHAR(20) NOT NULL, script VARCHAR(1000) NOT NULL, success BOOLEAN NOT NULL)`,
+		`INSERT INTO flyway_schema_history (installed_rank, version, type, script, success) VALUES
+			(1, '1', 'SQL', 'V1__init.sql', true),
+			(2, '2', 'SQL', 'V2__broken.sql', false)`,
+	)
+
+	var dirtyErr *DirtyHistoryError
+	if assert.ErrorAs(t, db.Touch(context.Background()), &dirtyErr) {
+		assert.Equal(t, "2", dirtyErr.Version)
+		assert.Contains(t, dirtyErr.Error(), "flyway repair")
+	}
+}
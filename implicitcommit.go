@@ -0,0 +1,256 @@
+package rockhopper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// implicitCommitRegExp matches the statements MySQL commits implicitly,
+	// along with the transaction they run in: DDL, account management and
+	// table maintenance statements.
+	implicitCommitRegExp = regexp.MustCompile(`(?i)^(?:CREATE|ALTER|DROP|RENAME|TRUNCATE|GRANT|REVOKE|LOCK TABLES?|UNLOCK TABLES?|ANALYZE|OPTIMIZE|REPAIR|CACHE INDEX|LOAD INDEX|FLUSH|INSTALL|UNINSTALL)\b`)
+
+	// temporaryTableRegExp matches the DDL statements that do not commit.
+	temporaryTableRegExp = regexp.MustCompile(`(?i)^(?:CREATE|DROP) TEMPORARY TABLE\b`)
+)
+
+// isImplicitCommit reports whether MySQL commits the transaction a statement
+// runs in before executing it.
+func isImplicitCommit(sql string) bool {
+	sql = normalizeLintSQL(sql)
+	return implicitCommitRegExp.MatchString(sql) && !temporaryTableRegExp.MatchString(sql)
+}
+
+// ImplicitCommitError is returned with SetStrictImplicitCommits by a
+// transactional migration whose DDL statements would commit the transaction
+// of its other statements.
+type ImplicitCommitError struct {
+	Migration *Migration
+	Direction Direction
+
+	// Statements are the 1-based indexes of the statements that commit
+	// implicitly.
+	Statements []int
+}
+
+func (e *ImplicitCommitError) Error() string {
+	verb := "commit"
+	if len(e.Statements) == 1 {
+		verb = "commits"
+	}
+
+	return fmt.Sprintf("migration %s runs its %s statements in a transaction, but %s %s implicitly; "+
+		"move the DDL statements to migrations of their own, or mark the migration with '-- !txn'",
+		e.Migration.location(), e.Direction, describeStatementIndexes(e.Statements), verb)
+}
+
+// PartialCommitError is returned when a transactional migration fails after
+// one of its statements committed the transaction implicitly: the statements
+// up to Committed are not rolled back.
+type PartialCommitError struct {
+	Migration *Migration
+	Direction Direction
+
+	// Committed is the 1-based index of the last committed statement.
+	Committed int
+
+	// Location is the "file:line" of the last committed statement, when known.
+	Location string
+
+	// AtLeast is set when the migration failed in a batch of statements, some
+	// of which may have been committed as well.
+	AtLeast bool
+
+	Err error
+}
+
+func (e *PartialCommitError) Error() string {
+	return e.summary() + ": " + e.Err.Error()
+}
+
+// summary tells which statements were committed, without the error.
+func (e *PartialCommitError) summary() string {
+	stmt := fmt.Sprintf("statement #%d", e.Committed)
+	if e.Location != "" {
+		stmt += " at " + e.Location
+	}
+
+	committed := "the statements"
+	if e.AtLeast {
+		committed = "at least the statements"
+	}
+
+	return fmt.Sprintf("%s of the %s block up to %s were committed implicitly by DDL statements and are not rolled back",
+		committed, e.Direction, stmt)
+}
+
+func (e *PartialCommitError) Unwrap() error {
+	return e.Err
+}
+
+// SetStrictImplicitCommits makes a transactional migration that mixes DDL
+// statements with other statements fail with ImplicitCommitError on MySQL and
+// TiDB, instead of logging a warning.
+func (db *DB) SetStrictImplicitCommits(strict bool) {
+	db.strictImplicitCommits = strict
+}
+
+// commitsImplicitly reports whether the DDL statements of the database commit
+// the transaction they run in.
+func (db *DB) commitsImplicitly() bool {
+	return db.driverName == DialectMySQL
+}
+
+// statementCommits classifies the statements of a migration for
+// checkImplicitCommits.
+type statementCommits struct {
+	// statements is the number of statements, executable the number of them
+	// that are not no-ops.
+	statements, executable int
+
+	// committing are the 1-based indexes of the statements that commit
+	// implicitly.
+	committing []int
+}
+
+func (c *statementCommits) add(sql string) {
+	c.statements++
+	if isNoOpSQL(sql) {
+		return
+	}
+
+	c.executable++
+	if isImplicitCommit(sql) {
+		c.committing = append(c.committing, c.statements)
+	}
+}
+
+// checkImplicitCommits warns when the statements of a transactional migration
+// mix DDL statements with other statements on a database that commits DDL
+// statements implicitly: a failure rolls back the statements after the last
+// DDL statement only. It fails with SetStrictImplicitCommits. The up
+// statements of a stream migration are classified when its file is parsed.
+func (db *DB) checkImplicitCommits(m *Migration, direction Direction, stmts []Statement) error {
+	if !m.UseTx || !db.commitsImplicitly() {
+		return nil
+	}
+
+	var commits statementCommits
+	if m.Stream && direction == DirectionUp && m.streamCommits != nil {
+		commits = *m.streamCommits
+	} else {
+		for i := range stmts {
+			commits.add(stmts[i].SQL)
+		}
+	}
+
+	// a migration of DDL statements only has nothing left to roll back
+	if len(commits.committing) == 0 || commits.executable <= len(commits.committing) {
+		return nil
+	}
+
+	err := &ImplicitCommitError{Migration: m, Direction: direction, Statements: commits.committing}
+	if db.strictImplicitCommits {
+		return err
+	}
+
+	log.Warn(err.Error())
+	return nil
+}
+
+// checkPlanImplicitCommits runs checkImplicitCommits on the steps of a plan.
+func (db *DB) checkPlanImplicitCommits(plan *Plan) error {
+	for i := range plan.Steps {
+		s := &plan.Steps[i]
+		m, err := s.Migration()
+		if err != nil {
+			return err
+		}
+
+		stmts := m.UpStatements
+		if s.Direction == DirectionDown {
+			stmts = m.DownStatements
+		}
+
+		if err := db.checkImplicitCommits(m, s.Direction, stmts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// implicitlyCommitted returns the 1-based index of the last statement
+// committed when a transactional migration failed after executing executed
+// statements, or 0 when none is. In a failed batch, the statements after the
+// first one may be committed as well.
+func implicitlyCommitted(stmts []Statement, executed int) int {
+	committed, prev, n := 0, 0, 0
+	for i := range stmts {
+		if isNoOpSQL(stmts[i].SQL) {
+			continue
+		}
+
+		if n == executed {
+			// the failed statement commits the transaction before it runs
+			if isImplicitCommit(stmts[i].SQL) {
+				committed = prev
+			}
+
+			break
+		}
+
+		if isImplicitCommit(stmts[i].SQL) {
+			committed = i + 1
+		}
+
+		prev = i + 1
+		n++
+	}
+
+	return committed
+}
+
+// checkPartialCommit wraps the error of a failed transactional migration into
+// PartialCommitError when some of its statements were committed implicitly.
+func (db *DB) checkPartialCommit(m *Migration, direction Direction, stmts []Statement, executed, batchSize int, err error) error {
+	if !m.UseTx || !db.commitsImplicitly() {
+		return err
+	}
+
+	committed := implicitlyCommitted(stmts, executed)
+	if committed == 0 {
+		return err
+	}
+
+	partial := &PartialCommitError{
+		Migration: m,
+		Direction: direction,
+		Committed: committed,
+		Location:  stmts[committed-1].location(),
+		AtLeast:   batchSize > 0,
+		Err:       err,
+	}
+
+	log.Errorf("migration %s is partially applied: %s", m.location(), partial.summary())
+	return partial
+}
+
+// describeStatementIndexes lists statement indexes for messages, e.g.
+// "statements #1 and #3".
+func describeStatementIndexes(indexes []int) string {
+	if len(indexes) == 1 {
+		return fmt.Sprintf("statement #%d", indexes[0])
+	}
+
+	names := make([]string, len(indexes))
+	for i, index := range indexes {
+		names[i] = fmt.Sprintf("#%d", index)
+	}
+
+	return "statements " + strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
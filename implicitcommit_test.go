@@ -0,0 +1,141 @@
+package rockhopper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_isImplicitCommit(t *testing.T) {
+	for sql, want := range map[string]bool{
+		"CREATE TABLE users (id INT);":             true,
+		"alter table users add column name text;":  true,
+		"/* seed */ DROP INDEX idx ON users;":      true,
+		"RENAME TABLE a TO b;":                     true,
+		"TRUNCATE users;":                          true,
+		"CREATE TEMPORARY TABLE tmp (id INT);":     false,
+		"INSERT INTO users (id) VALUES (1);":       false,
+		"UPDATE users SET created = NOW();":        false,
+		"SELECT 'CREATE TABLE x' FROM dual;":       false,
+		"-- comment\nDELETE FROM users WHERE id=1": false,
+	} {
+		assert.Equal(t, want, isImplicitCommit(sql), sql)
+	}
+}
+
+func implicitCommitTestMigration() *Migration {
+	return &Migration{
+		Source:  "20240101120000_users.sql",
+		Version: 20240101120000,
+		UseTx:   true,
+		UpStatements: []Statement{
+			{SQL: "CREATE TABLE users (id INT);", File: "20240101120000_users.sql", Line: 2},
+			{SQL: "INSERT INTO users (id) VALUES (1);", File: "20240101120000_users.sql", Line: 3},
+			{SQL: "ALTER TABLE users ADD COLUMN name TEXT;", File: "20240101120000_users.sql", Line: 4},
+			{SQL: "INSERT INTO users (id, name) VALUES (2, 'a');", File: "20240101120000_users.sql", Line: 5},
+		},
+	}
+}
+
+func TestDB_checkImplicitCommits(t *testing.T) {
+	m := implicitCommitTestMigration()
+
+	db := &DB{driverName: DialectMySQL}
+	assert.NoError(t, db.checkImplicitCommits(m, DirectionUp, m.UpStatements), "warns only")
+
+	db.SetStrictImplicitCommits(true)
+	err := db.checkImplicitCommits(m, DirectionUp, m.UpStatements)
+	var implicitErr *ImplicitCommitError
+	require.ErrorAs(t, err, &implicitErr)
+	assert.Equal(t, []int{1, 3}, implicitErr.Statements)
+	assert.ErrorContains(t, err, "but statements #1 and #3 commit implicitly")
+
+	assert.NoError(t, db.checkImplicitCommits(m, DirectionUp, m.UpStatements[:1]), "a single DDL statement")
+	assert.NoError(t, db.checkImplicitCommits(m, DirectionUp, m.UpStatements[1:2]), "no DDL statement")
+
+	ddl := []Statement{
+		{SQL: "CREATE TABLE a (id INT);"},
+		{SQL: "-- a comment only"},
+		{SQL: "CREATE INDEX a_id ON a (id);"},
+		{SQL: "ALTER TABLE a ADD COLUMN name TEXT;"},
+	}
+	assert.NoError(t, db.checkImplicitCommits(m, DirectionUp, ddl), "DDL statements only")
+
+	m.UseTx = false
+	assert.NoError(t, db.checkImplicitCommits(m, DirectionUp, m.UpStatements), "a '-- !txn' migration")
+
+	m.UseTx = true
+	db.driverName = DialectPostgres
+	assert.NoError(t, db.checkImplicitCommits(m, DirectionUp, m.UpStatements), "transactional DDL")
+}
+
+func Test_implicitlyCommitted(t *testing.T) {
+	stmts := implicitCommitTestMigration().UpStatements
+
+	assert.Equal(t, 0, implicitlyCommitted(stmts, 0), "the first DDL statement failed")
+	assert.Equal(t, 1, implicitlyCommitted(stmts, 1), "the first INSERT failed after the CREATE TABLE")
+	assert.Equal(t, 2, implicitlyCommitted(stmts, 2), "the ALTER TABLE failed after committing the INSERT")
+	assert.Equal(t, 3, implicitlyCommitted(stmts, 3))
+	assert.Equal(t, 3, implicitlyCommitted(stmts, 4), "the version record failed")
+
+	withNoOp := append([]Statement{{SQL: ";"}}, stmts...)
+	assert.Equal(t, 3, implicitlyCommitted(withNoOp, 2))
+}
+
+func TestDB_checkPartialCommit(t *testing.T) {
+	m := implicitCommitTestMigration()
+	db := &DB{driverName: DialectMySQL}
+	failure := errors.New("duplicate entry")
+
+	err := db.checkPartialCommit(m, DirectionUp, m.UpStatements, 1, 0, failure)
+	var partial *PartialCommitError
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, 1, partial.Committed)
+	assert.ErrorIs(t, err, failure)
+	assert.EqualError(t, err, "the statements of the up block up to statement #1 at 20240101120000_users.sql:2 were committed implicitly by DDL statements and are not rolled back: duplicate entry")
+
+	err = db.checkPartialCommit(m, DirectionUp, m.UpStatements, 0, 0, failure)
+	assert.Equal(t, failure, err, "nothing was committed")
+
+	db.driverName = DialectSQLite3
+	err = db.checkPartialCommit(m, DirectionUp, m.UpStatements, 1, 0, failure)
+	assert.Equal(t, failure, err)
+}
+
+func TestDB_checkImplicitCommits_Stream(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeStreamTestMigration(t, dir, 10, "-- +stream\n")
+
+	migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Load(dir)
+	require.NoError(t, err)
+
+	m := migrations[0]
+	require.Nil(t, m.UpStatements)
+
+	mysql := &DB{driverName: DialectMySQL}
+	mysql.SetStrictImplicitCommits(true)
+
+	var implicitErr *ImplicitCommitError
+	require.ErrorAs(t, mysql.checkImplicitCommits(m, DirectionUp, m.UpStatements), &implicitErr, "the streamed statements are classified")
+	assert.Equal(t, []int{1}, implicitErr.Statements)
+
+	// a stream step decoded from a plan file is classified when its source
+	// is checked
+	db := openTestDB(t)
+	plan, err := NewPlanner(db, migrations).PlanUp(ctx, 0, 0)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, plan.Encode(&buf))
+	decoded, err := DecodePlan(&buf)
+	require.NoError(t, err)
+
+	db.driverName = DialectMySQL
+	db.SetStrictImplicitCommits(true)
+	assert.ErrorAs(t, db.ExecutePlan(ctx, decoded), &implicitErr)
+}
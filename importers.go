@@ -0,0 +1,251 @@
+package rockhopper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// queryHistoryTable runs the query of an importer. A failing query means that
+// the table does not have the columns of the tool.
+func queryHistoryTable(ctx context.Context, db *DB, q string) (*sql.Rows, error) {
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, errors.Wrap(ErrNotImportable, err.Error())
+	}
+
+	return rows, nil
+}
+
+func parseImportedVersion(tool, version string) (int64, error) {
+	v, err := strconv.ParseInt(strings.TrimSpace(version), 10, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("%s version %q is not a positive integer, which rockhopper versions must be", tool, version)
+	}
+
+	return v, nil
+}
+
+// flywayImporter imports flyway_schema_history. Repeatable migrations have no
+// version and are skipped, a BASELINE row is imported as a baseline.
+type flywayImporter struct{}
+
+func (flywayImporter) Name() string { return "flyway" }
+
+func (flywayImporter) TableName() string { return "flyway_schema_history" }
+
+func (flywayImporter) Load(ctx context.Context, db *DB, table string) ([]ImportedVersion, error) {
+	rows, err := queryHistoryTable(ctx, db, fmt.Sprintf(`SELECT installed_rank, version, type, script, success FROM %s ORDER BY installed_rank`, table))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int64]ImportedVersion)
+	for rows.Next() {
+		var rank int64
+		var version sql.NullString
+		var typ, script string
+		var success bool
+		if err := rows.Scan(&rank, &version, &typ, &script, &success); err != nil {
+			return nil, err
+		}
+
+		if !version.Valid || version.String == "" {
+			continue
+		}
+
+		if !success {
+			return nil, &DirtyHistoryError{Table: table, Version: version.String, Hint: "run `flyway repair`"}
+		}
+
+		v, err := parseImportedVersion("flyway", version.String)
+		if err != nil {
+			return nil, err
+		}
+
+		// undo migrations and deletions take the version back
+		if strings.HasPrefix(typ, "UNDO_") || typ == "DELETE" {
+			delete(applied, v)
+			continue
+		}
+
+		applied[v] = ImportedVersion{
+			Package:    DefaultPackageName,
+			Version:    v,
+			SourceFile: script,
+			Baseline:   typ == "BASELINE",
+			Ref:        fmt.Sprintf("installed_rank %d", rank),
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var versions []ImportedVersion
+	for _, v := range applied {
+		versions = append(versions, v)
+	}
+
+	return versions, nil
+}
+
+// sqlxImporter imports the _sqlx_migrations table of sqlx-cli.
+type sqlxImporter struct{}
+
+func (sqlxImporter) Name() string { return "sqlx" }
+
+func (sqlxImporter) TableName() string { return "_sqlx_migrations" }
+
+func (sqlxImporter) Load(ctx context.Context, db *DB, table string) ([]ImportedVersion, error) {
+	rows, err := queryHistoryTable(ctx, db, fmt.Sprintf(`SELECT version, description, success FROM %s ORDER BY version`, table))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var versions []ImportedVersion
+	for rows.Next() {
+		var version int64
+		var description string
+		var success bool
+		if err := rows.Scan(&version, &description, &success); err != nil {
+			return nil, err
+		}
+
+		if !success {
+			return nil, &DirtyHistoryError{Table: table, Version: strconv.FormatInt(version, 10), Hint: "delete its row"}
+		}
+
+		versions = append(versions, ImportedVersion{
+			Package: DefaultPackageName,
+			Version: version,
+
+			// sqlx reads the description from the {version}_{description}.sql filename
+			SourceFile: fmt.Sprintf("%d_%s.sql", version, strings.ReplaceAll(description, " ", "_")),
+			Ref:        "version " + strconv.FormatInt(version, 10),
+		})
+	}
+
+	return versions, rows.Err()
+}
+
+var liquibaseVersionRegExp = regexp.MustCompile(`^\d+`)
+
+// liquibaseImporter imports DATABASECHANGELOG. Changesets are identified by
+// strings, so the leading digits of the changeset id are taken as the version,
+// e.g. 20240101120000 for "20240101120000-create-users".
+type liquibaseImporter struct{}
+
+func (liquibaseImporter) Name() string { return "liquibase" }
+
+func (liquibaseImporter) TableName() string { return "DATABASECHANGELOG" }
+
+func (liquibaseImporter) Load(ctx context.Context, db *DB, table string) ([]ImportedVersion, error) {
+	rows, err := queryHistoryTable(ctx, db, fmt.Sprintf(`SELECT id, author, filename, exectype FROM %s ORDER BY orderexecuted`, table))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var versions []ImportedVersion
+	for rows.Next() {
+		var id, author, filename, execType string
+		if err := rows.Scan(&id, &author, &filename, &execType); err != nil {
+			return nil, err
+		}
+
+		ref := "changeset " + filename + "::" + id + "::" + author
+
+		switch execType {
+		case "SKIPPED":
+			continue
+
+		case "FAILED":
+			return nil, &DirtyHistoryError{Table: table, Version: id, Hint: "remove its row"}
+		}
+
+		digits := liquibaseVersionRegExp.FindString(id)
+		if digits == "" {
+			return nil, fmt.Errorf("liquibase %s has no leading digits in its id to use as the version", ref)
+		}
+
+		v, err := parseImportedVersion("liquibase", digits)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, ImportedVersion{
+			Package:    DefaultPackageName,
+			Version:    v,
+			SourceFile: filename,
+			Ref:        ref,
+		})
+	}
+
+	return versions, rows.Err()
+}
+
+// atlasRevisionTypeBaseline is the baseline bit of the revision type of Atlas.
+const atlasRevisionTypeBaseline = 1
+
+// atlasImporter imports atlas_schema_revisions. Atlas keeps it in a schema of
+// its own on MySQL and PostgreSQL by default, so it is only found when it was
+// created in the schema rockhopper connects to.
+type atlasImporter struct{}
+
+func (atlasImporter) Name() string { return "atlas" }
+
+func (atlasImporter) TableName() string { return "atlas_schema_revisions" }
+
+func (atlasImporter) Load(ctx context.Context, db *DB, table string) ([]ImportedVersion, error) {
+	rows, err := queryHistoryTable(ctx, db, fmt.Sprintf(`SELECT version, description, type, applied, total, error FROM %s ORDER BY version`, table))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var versions []ImportedVersion
+	for rows.Next() {
+		var version, description string
+		var typ, applied, total int
+		var errMsg sql.NullString
+		if err := rows.Scan(&version, &description, &typ, &applied, &total, &errMsg); err != nil {
+			return nil, err
+		}
+
+		// internal rows of atlas, such as .atlas_cloud_identifiers
+		if strings.HasPrefix(version, ".") {
+			continue
+		}
+
+		if applied < total || errMsg.String != "" {
+			return nil, &DirtyHistoryError{Table: table, Version: version, Hint: "run `atlas migrate set`"}
+		}
+
+		v, err := parseImportedVersion("atlas", version)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, ImportedVersion{
+			Package:    DefaultPackageName,
+			Version:    v,
+			SourceFile: version + "_" + description + ".sql",
+			Baseline:   typ&atlasRevisionTypeBaseline != 0,
+			Ref:        "version " + version,
+		})
+	}
+
+	return versions, rows.Err()
+}
@@ -0,0 +1,275 @@
+package rockhopper
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sqlSyntax is the lexical syntax of a SQL dialect that matters for splitting
+// a script into statements.
+type sqlSyntax struct {
+	// backslashEscapes lets a backslash escape a quote inside a string literal.
+	backslashEscapes bool
+
+	// hashComments starts a line comment with '#'.
+	hashComments bool
+
+	// nestedComments lets block comments nest.
+	nestedComments bool
+
+	// dollarQuotes enables PostgreSQL $tag$ ... $tag$ quoting.
+	dollarQuotes bool
+
+	// delimiterCommand enables the MySQL client "DELIMITER <delim>" command
+	// used by mysqldump around triggers and routines.
+	delimiterCommand bool
+}
+
+// sqlSyntaxOf returns the syntax of the dialect. An empty dialect accepts both
+// the MySQL and the PostgreSQL quoting, which is what migration files written
+// without a configured dialect expect.
+func sqlSyntaxOf(dialectName string) sqlSyntax {
+	switch dialectName {
+	case DialectMySQL, DialectTiDB:
+		return sqlSyntax{backslashEscapes: true, hashComments: true, delimiterCommand: true}
+
+	case DialectPostgres, DialectRedshift:
+		return sqlSyntax{nestedComments: true, dollarQuotes: true}
+
+	case DialectClickHouse:
+		return sqlSyntax{backslashEscapes: true}
+
+	case DialectSQLite3:
+		return sqlSyntax{}
+	}
+
+	return sqlSyntax{backslashEscapes: true, dollarQuotes: true, delimiterCommand: true}
+}
+
+type lexState int
+
+const (
+	lexCode lexState = iota
+	lexString
+	lexQuotedIdentifier
+	lexBlockComment
+	lexDollarQuote
+)
+
+var (
+	dollarTagRegExp        = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z0-9_]*)?\$`)
+	delimiterCommandRegExp = regexp.MustCompile(`(?i)^\s*DELIMITER\s+(\S+)\s*$`)
+)
+
+// lexedStatement is a statement split by sqlLexer.
+type lexedStatement struct {
+	SQL string
+
+	// Line is the line of the first token of the statement.
+	Line int
+}
+
+// sqlLexer splits SQL text into statements. It is fed line by line and keeps
+// track of string literals, quoted identifiers, comments and dollar quotes
+// across lines, so that only a delimiter outside of them ends a statement.
+type sqlLexer struct {
+	syntax    sqlSyntax
+	delimiter string
+
+	state lexState
+
+	// quote is the closing quote of the current string or identifier.
+	quote byte
+
+	// escapes is set when the current string takes backslash escapes.
+	escapes bool
+
+	// dollarTag is the tag of the current dollar quote, e.g. "$body$".
+	dollarTag string
+
+	commentDepth int
+
+	buf strings.Builder
+
+	// line is the line of the first token of the pending statement, zero
+	// while the pending text holds only whitespace and comments.
+	line int
+}
+
+func newSQLLexer(dialectName string) *sqlLexer {
+	return &sqlLexer{
+		syntax:    sqlSyntaxOf(dialectName),
+		delimiter: ";",
+	}
+}
+
+// inCode reports whether the lexer is outside of any string, identifier,
+// comment or dollar quote.
+func (l *sqlLexer) inCode() bool {
+	return l.state == lexCode
+}
+
+// pending returns the text of the unfinished statement, or an empty string
+// when it has no token yet.
+func (l *sqlLexer) pending() string {
+	if l.line == 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(l.buf.String())
+}
+
+// feed lexes a line and returns the statements it finishes.
+func (l *sqlLexer) feed(line string, lineNo int) (stmts []lexedStatement) {
+	if l.syntax.delimiterCommand && l.inCode() && l.line == 0 {
+		if matches := delimiterCommandRegExp.FindStringSubmatch(line); matches != nil {
+			l.delimiter = matches[1]
+			return nil
+		}
+	}
+
+	// start of the text not written to the buffer yet
+	last := 0
+
+	// end of the last statement finished on this line
+	split := -1
+
+	mark := func() {
+		if l.line == 0 {
+			l.line = lineNo
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch l.state {
+		case lexCode:
+			switch {
+			case strings.HasPrefix(line[i:], l.delimiter):
+				mark()
+				l.buf.WriteString(line[last:i])
+				if l.delimiter == ";" {
+					l.buf.WriteString(";")
+				}
+
+				stmts = append(stmts, lexedStatement{SQL: strings.TrimSpace(l.buf.String()), Line: l.line})
+				l.buf.Reset()
+				l.line = 0
+
+				i += len(l.delimiter) - 1
+				last, split = i+1, i+1
+				continue
+
+			case c == '-' && strings.HasPrefix(line[i:], "--"), c == '#' && l.syntax.hashComments:
+				// the rest of the line is a comment
+				i = len(line)
+				continue
+
+			case c == '/' && strings.HasPrefix(line[i:], "/*"):
+				l.state = lexBlockComment
+				l.commentDepth = 1
+
+				// MySQL executes the body of /*! ... */ comments
+				if strings.HasPrefix(line[i:], "/*!") {
+					mark()
+				}
+
+				i++
+				continue
+
+			case c == '\'':
+				l.state = lexString
+				l.quote = c
+				l.escapes = l.syntax.backslashEscapes || isEscapeStringPrefix(line, i)
+
+			// MySQL reads "..." as a string literal unless ANSI_QUOTES is set,
+			// so a backslash escapes its quote as in '...'
+			case c == '"' && l.syntax.backslashEscapes:
+				l.state = lexString
+				l.quote = c
+				l.escapes = true
+
+			case c == '"' || c == '`':
+				l.state = lexQuotedIdentifier
+				l.quote = c
+
+			case c == '$' && l.syntax.dollarQuotes && (i == 0 || !isIdentifierChar(line[i-1])):
+				if tag := dollarTagRegExp.FindString(line[i:]); tag != "" {
+					l.state = lexDollarQuote
+					l.dollarTag = tag
+					mark()
+					i += len(tag) - 1
+					continue
+				}
+			}
+
+			if !isSpace(c) {
+				mark()
+			}
+
+		case lexString, lexQuotedIdentifier:
+			switch {
+			case c == '\\' && l.escapes && l.state == lexString:
+				i++
+
+			case c == l.quote:
+				if i+1 < len(line) && line[i+1] == l.quote {
+					i++
+				} else {
+					l.state = lexCode
+				}
+			}
+
+		case lexBlockComment:
+			switch {
+			case c == '*' && strings.HasPrefix(line[i:], "*/"):
+				l.commentDepth--
+				if l.commentDepth == 0 {
+					l.state = lexCode
+				}
+				i++
+
+			case c == '/' && l.syntax.nestedComments && strings.HasPrefix(line[i:], "/*"):
+				l.commentDepth++
+				i++
+			}
+
+		case lexDollarQuote:
+			if c == '$' && strings.HasPrefix(line[i:], l.dollarTag) {
+				l.state = lexCode
+				i += len(l.dollarTag) - 1
+			}
+		}
+	}
+
+	// a trailing comment after the last statement of the line stays with it,
+	// e.g. "DROP TABLE a; -- no longer used"
+	if split >= 0 && l.line == 0 && l.inCode() {
+		stmts[len(stmts)-1].SQL = strings.TrimSpace(stmts[len(stmts)-1].SQL + line[split:])
+		l.buf.Reset()
+		return stmts
+	}
+
+	l.buf.WriteString(line[last:])
+	l.buf.WriteString("\n")
+	return stmts
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == '\v'
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// isEscapeStringPrefix reports whether the quote at i opens a PostgreSQL
+// E'...' string, which takes backslash escapes.
+func isEscapeStringPrefix(line string, i int) bool {
+	if i == 0 || line[i-1] != 'E' && line[i-1] != 'e' {
+		return false
+	}
+
+	return i == 1 || !isIdentifierChar(line[i-2])
+}
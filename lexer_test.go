@@ -0,0 +1,128 @@
+package rockhopper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationParser_Lexer(t *testing.T) {
+	testcases := []struct {
+		name    string
+		dialect string
+		script  string
+		want    []Statement
+	}{
+		{
+			name:   "semicolon in a string at the end of a line",
+			script: "-- +up\nINSERT INTO t (c) VALUES ('a;\nb;');\n",
+			want: []Statement{
+				{Direction: DirectionUp, SQL: "INSERT INTO t (c) VALUES ('a;\nb;');", Line: 2},
+			},
+		},
+		{
+			name:   "block comment",
+			script: "-- +up\n/* DROP TABLE a;\n   DROP TABLE b; */\nCREATE TABLE a (id INT); /* done; */\n",
+			want: []Statement{
+				{Direction: DirectionUp, SQL: "/* DROP TABLE a;\n   DROP TABLE b; */\nCREATE TABLE a (id INT); /* done; */", Line: 4},
+			},
+		},
+		{
+			name:    "dollar quoted function body",
+			dialect: DialectPostgres,
+			script: "-- +up\nCREATE FUNCTION f() RETURNS int AS $body$\nBEGIN\n  RETURN 1;\nEND;\n$body$ LANGUAGE plpgsql;\n" +
+				"-- +down\nDROP FUNCTION f();\n",
+			want: []Statement{
+				{Direction: DirectionUp, SQL: "CREATE FUNCTION f() RETURNS int AS $body$\nBEGIN\n  RETURN 1;\nEND;\n$body$ LANGUAGE plpgsql;", Line: 2},
+				{Direction: DirectionDown, SQL: "DROP FUNCTION f();", Line: 8},
+			},
+		},
+		{
+			name:    "nested block comments",
+			dialect: DialectPostgres,
+			script:  "-- +up\n/* outer /* inner; */ still a comment; */ SELECT 1;\n",
+			want: []Statement{
+				{Direction: DirectionUp, SQL: "/* outer /* inner; */ still a comment; */ SELECT 1;", Line: 2},
+			},
+		},
+		{
+			name:    "mysql delimiter command",
+			dialect: DialectMySQL,
+			script: "-- +up\nDELIMITER ;;\nCREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN\n  SET NEW.c = 1;\nEND ;;\nDELIMITER ;\n" +
+				"INSERT INTO a (c) VALUES ('it\\'s;');\n",
+			want: []Statement{
+				{Direction: DirectionUp, SQL: "CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN\n  SET NEW.c = 1;\nEND", Line: 3},
+				{Direction: DirectionUp, SQL: "INSERT INTO a (c) VALUES ('it\\'s;');", Line: 7},
+			},
+		},
+		{
+			name:    "backslash is not an escape in sqlite",
+			dialect: DialectSQLite3,
+			script:  "-- +up\nSELECT 'C:\\'; SELECT 2; -- two statements\n",
+			want: []Statement{
+				{Direction: DirectionUp, SQL: "SELECT 'C:\\';", Line: 2},
+				{Direction: DirectionUp, SQL: "SELECT 2; -- two statements", Line: 2},
+			},
+		},
+		{
+			name:    "escaped quote in a double quoted mysql string",
+			dialect: DialectMySQL,
+			script:  "-- +up\nINSERT INTO t (c) VALUES (\"a\\\";b\");\n",
+			want: []Statement{
+				{Direction: DirectionUp, SQL: "INSERT INTO t (c) VALUES (\"a\\\";b\");", Line: 2},
+			},
+		},
+		{
+			name:   "escaped quote in a double quoted string",
+			script: "-- +up\nINSERT INTO t (c) VALUES (\"a\\\";b\"); SELECT 2;\n",
+			want: []Statement{
+				{Direction: DirectionUp, SQL: "INSERT INTO t (c) VALUES (\"a\\\";b\");", Line: 2},
+				{Direction: DirectionUp, SQL: "SELECT 2;", Line: 2},
+			},
+		},
+		{
+			name:   "annotation inside a string",
+			script: "-- +up\nINSERT INTO t (c) VALUES ('\n-- +down\n');\n",
+			want: []Statement{
+				{Direction: DirectionUp, SQL: "INSERT INTO t (c) VALUES ('\n-- +down\n');", Line: 2},
+			},
+		},
+		{
+			name:   "blank line inside a string",
+			script: "-- +up\nINSERT INTO t (c) VALUES ('a\n\nb');\n",
+			want: []Statement{
+				{Direction: DirectionUp, SQL: "INSERT INTO t (c) VALUES ('a\n\nb');", Line: 2},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &MigrationParser{Dialect: tc.dialect}
+			chunk, err := p.ParseString(tc.script)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, append(chunk.UpStmts, chunk.DownStmts...))
+		})
+	}
+}
+
+func TestMigrationParser_LexerErrors(t *testing.T) {
+	p := &MigrationParser{}
+
+	_, err := p.ParseString("-- +up\nINSERT INTO t (c) VALUES ('a;\n")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "missing semicolon")
+	}
+
+	_, err = p.ParseString("-- +up\nSELECT 1;\n/* unterminated\n")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unterminated quote or comment")
+	}
+
+	_, err = p.ParseString("-- +up\nCREATE TABLE a (id INT)\n-- +down\nDROP TABLE a;\n")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "line 3")
+	}
+}
@@ -0,0 +1,444 @@
+package rockhopper
+
+import (
+	"fmt"
+	"iter"
+	"regexp"
+	"strings"
+)
+
+// LintRule is a check run on each statement of a SQL migration. Rules can be
+// suppressed with a "-- +lint-ignore <rule>" annotation, either right before a
+// statement or before "-- +up" for the whole file.
+type LintRule struct {
+	Name string
+
+	// Dialects limits the rule to the given dialects, empty means every dialect.
+	Dialects []string
+
+	// Down also checks the statements of the down block.
+	Down bool
+
+	// Check returns the finding message, or an empty string when the statement
+	// passes.
+	Check func(l *lintStatement) string
+
+	// CheckMigration checks the migration as a whole instead of each of its
+	// statements, for rules without Check.
+	CheckMigration func(m *Migration) string
+}
+
+// LintFinding is a statement flagged by a lint rule.
+type LintFinding struct {
+	Rule      string
+	Migration *Migration
+	Direction Direction
+
+	// Statement is the 1-based index of the statement in its block, as in
+	// execution errors, or zero for a finding on the whole migration.
+	Statement int
+
+	// Location is the "file:line" of the statement, when known.
+	Location string
+
+	Message string
+}
+
+func (f *LintFinding) String() string {
+	if f.Statement == 0 {
+		return fmt.Sprintf("%s: %s [%s]", f.Migration.location(), f.Message, f.Rule)
+	}
+
+	stmt := fmt.Sprintf("statement #%d", f.Statement)
+	if f.Location != "" {
+		stmt += " at " + f.Location
+	}
+
+	return fmt.Sprintf("%s %s %s: %s [%s]", f.Migration.location(), f.Direction, stmt, f.Message, f.Rule)
+}
+
+// LintError is returned when migrations have lint findings.
+type LintError struct {
+	Findings []LintFinding
+}
+
+func (e *LintError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "found %d lint issue(s), fix them or suppress them with '-- +lint-ignore <rule>':", len(e.Findings))
+	for _, f := range e.Findings {
+		b.WriteString("\n  " + f.String())
+	}
+	return b.String()
+}
+
+// lintStreamNotLinted is the rule of the finding reported when the up
+// statements of a '-- +stream' migration can not be read to lint them.
+const lintStreamNotLinted = "stream-not-linted"
+
+// DefaultLintRules are the rules run by LintMigrations.
+var DefaultLintRules = []LintRule{
+	{
+		Name:     "pg-index-not-concurrent",
+		Dialects: []string{DialectPostgres},
+		Check:    lintIndexNotConcurrent,
+	},
+	{
+		Name:     "concurrently-in-transaction",
+		Dialects: []string{DialectPostgres},
+		Down:     true,
+		Check:    lintConcurrentlyInTransaction,
+	},
+	{
+		Name:  "add-column-not-null-without-default",
+		Check: lintAddColumnNotNullWithoutDefault,
+	},
+	{
+		Name:  "drop-column",
+		Check: lintDropColumn,
+	},
+	{
+		Name:  "drop-table",
+		Check: lintDropTable,
+	},
+	{
+		// TiDB is left out: it runs every ALTER TABLE online, without the
+		// table copy that blocks writes on MySQL
+		Name:     "mysql-table-copy",
+		Dialects: []string{DialectMySQL},
+		Check:    lintMySQLTableCopy,
+	},
+	{
+		Name:           "missing-down",
+		CheckMigration: lintMissingDown,
+	},
+}
+
+// LintMigrations runs DefaultLintRules on the SQL statements of the migrations
+// for the given dialect. Go migrations are not checked.
+func LintMigrations(dialectName string, migrations MigrationSlice) []LintFinding {
+	var findings []LintFinding
+	for _, m := range migrations {
+		findings = append(findings, LintMigration(dialectName, m, DefaultLintRules)...)
+	}
+
+	return findings
+}
+
+// LintMigration runs the rules on the SQL statements of a migration. The up
+// statements of a '-- +stream' migration are read from its source.
+func LintMigration(dialectName string, m *Migration, rules []LintRule) []LintFinding {
+	var fileIgnore []string
+	if m.Chunk != nil {
+		fileIgnore = m.Chunk.LintIgnore
+	}
+
+	created := createdTableNames(m.UpStatements)
+
+	var findings []LintFinding
+	for _, rule := range rules {
+		if rule.CheckMigration == nil {
+			continue
+		}
+
+		if len(rule.Dialects) > 0 && !sliceContains(rule.Dialects, dialectName) {
+			continue
+		}
+
+		if sliceContains(fileIgnore, rule.Name) {
+			continue
+		}
+
+		if msg := rule.CheckMigration(m); msg != "" {
+			findings = append(findings, LintFinding{
+				Rule:      rule.Name,
+				Migration: m,
+				Message:   msg,
+			})
+		}
+	}
+
+	check := func(stmts iter.Seq2[Statement, error], direction Direction) error {
+		i := -1
+		for stmt, err := range stmts {
+			if err != nil {
+				return err
+			}
+
+			i++
+			if isNoOpSQL(stmt.SQL) {
+				continue
+			}
+
+			// the statements of a stream migration are not kept, the tables
+			// are collected as they are read
+			if m.Stream && direction == DirectionUp {
+				for table := range createdTableNames([]Statement{stmt}) {
+					created[table] = true
+				}
+			}
+
+			l := &lintStatement{
+				Migration:     m,
+				SQL:           normalizeLintSQL(stmt.SQL),
+				createdTables: created,
+			}
+
+			for _, rule := range rules {
+				if rule.Check == nil {
+					continue
+				}
+
+				if direction == DirectionDown && !rule.Down {
+					continue
+				}
+
+				if len(rule.Dialects) > 0 && !sliceContains(rule.Dialects, dialectName) {
+					continue
+				}
+
+				if sliceContains(fileIgnore, rule.Name) || sliceContains(stmt.LintIgnore, rule.Name) {
+					continue
+				}
+
+				if msg := rule.Check(l); msg != "" {
+					findings = append(findings, LintFinding{
+						Rule:      rule.Name,
+						Migration: m,
+						Direction: direction,
+						Statement: i + 1,
+						Location:  stmt.location(),
+						Message:   msg,
+					})
+				}
+			}
+		}
+
+		return nil
+	}
+
+	upStmts := statementSeq(m.UpStatements)
+	if m.Stream {
+		streamDialect := dialectName
+		if m.lazy != nil {
+			streamDialect = m.lazy.dialect
+		}
+
+		upStmts = m.streamedUpStatements(streamDialect)
+	}
+
+	// a stream that can not be read is reported, rather than passing unchecked
+	if err := check(upStmts, DirectionUp); err != nil {
+		findings = append(findings, LintFinding{
+			Rule:      lintStreamNotLinted,
+			Migration: m,
+			Direction: DirectionUp,
+			Message:   "the streamed up statements were not linted: " + err.Error(),
+		})
+	}
+
+	_ = check(statementSeq(m.DownStatements), DirectionDown)
+	return findings
+}
+
+// lintStatement is the statement a rule checks.
+type lintStatement struct {
+	Migration *Migration
+
+	// SQL is the statement without comments and with whitespace collapsed.
+	SQL string
+
+	// createdTables holds the tables created by the up block of the
+	// migration. Locking a table nobody else uses yet is harmless.
+	createdTables map[string]bool
+}
+
+func (l *lintStatement) isNewTable(table string) bool {
+	return l.createdTables[strings.ToLower(table)]
+}
+
+var (
+	lintBlockCommentRegExp = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	lintLineCommentRegExp  = regexp.MustCompile(`--[^\n]*`)
+	lintWhitespaceRegExp   = regexp.MustCompile(`\s+`)
+
+	createTableRegExp = regexp.MustCompile(`(?i)^CREATE (?:TEMPORARY |TEMP )?TABLE (?:IF NOT EXISTS )?([^\s(]+)`)
+	createIndexRegExp = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX (.*)$`)
+	indexTableRegExp  = regexp.MustCompile(`(?i) ON (?:ONLY )?([^\s(]+)`)
+	alterTableRegExp  = regexp.MustCompile(`(?i)^ALTER TABLE (?:ONLY )?(?:IF EXISTS )?([^\s(]+) (.*?);?$`)
+	dropTableRegExp   = regexp.MustCompile(`(?i)^DROP TABLE (?:IF EXISTS )?(.*?)(?: CASCADE| RESTRICT)?;?$`)
+	concurrentRegExp  = regexp.MustCompile(`(?i)\bCONCURRENTLY\b`)
+
+	addColumnRegExp  = regexp.MustCompile(`(?i)^ADD (?:COLUMN )?(?:IF NOT EXISTS )?(\S+)`)
+	dropColumnRegExp = regexp.MustCompile(`(?i)^DROP (?:COLUMN )?(?:IF EXISTS )?(\S+)`)
+
+	mysqlOnlineAlgorithmRegExp = regexp.MustCompile(`(?i)\bALGORITHM ?= ?(?:INPLACE|INSTANT)\b`)
+	mysqlTableCopyRegExp       = regexp.MustCompile(`(?i)^(?:MODIFY|CHANGE|CONVERT TO CHARACTER SET|CHARACTER SET|ADD PRIMARY KEY|DROP PRIMARY KEY|ALGORITHM ?= ?COPY|ENGINE ?=|FORCE)\b`)
+)
+
+// clauseKeywords are the words after ADD / DROP that do not name a column.
+var clauseKeywords = map[string]bool{
+	"CONSTRAINT": true, "INDEX": true, "KEY": true, "PRIMARY": true, "UNIQUE": true,
+	"FOREIGN": true, "CHECK": true, "FULLTEXT": true, "SPATIAL": true, "PARTITION": true,
+	"DEFAULT": true,
+}
+
+func normalizeLintSQL(sql string) string {
+	sql = lintBlockCommentRegExp.ReplaceAllString(sql, " ")
+	sql = lintLineCommentRegExp.ReplaceAllString(sql, " ")
+	sql = lintWhitespaceRegExp.ReplaceAllString(sql, " ")
+	return strings.TrimSpace(sql)
+}
+
+func unquoteIdentifier(name string) string {
+	return strings.Trim(name, "`\"[]")
+}
+
+func createdTableNames(stmts []Statement) map[string]bool {
+	tables := make(map[string]bool)
+	for _, stmt := range stmts {
+		if matches := createTableRegExp.FindStringSubmatch(normalizeLintSQL(stmt.SQL)); matches != nil {
+			tables[strings.ToLower(unquoteIdentifier(matches[1]))] = true
+		}
+	}
+
+	return tables
+}
+
+// alterTableClauses splits an ALTER TABLE statement into its table and its
+// comma separated clauses. ok is false for other statements.
+func alterTableClauses(sql string) (table string, clauses []string, ok bool) {
+	matches := alterTableRegExp.FindStringSubmatch(sql)
+	if matches == nil {
+		return "", nil, false
+	}
+
+	depth, last := 0, 0
+	body := matches[2]
+	for i, c := range body {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, strings.TrimSpace(body[last:i]))
+				last = i + 1
+			}
+		}
+	}
+
+	clauses = append(clauses, strings.TrimSpace(body[last:]))
+	return unquoteIdentifier(matches[1]), clauses, true
+}
+
+func lintIndexNotConcurrent(l *lintStatement) string {
+	matches := createIndexRegExp.FindStringSubmatch(l.SQL)
+	if matches == nil || strings.HasPrefix(strings.ToUpper(matches[1]), "CONCURRENTLY ") {
+		return ""
+	}
+
+	table := ""
+	if m := indexTableRegExp.FindStringSubmatch(matches[1]); m != nil {
+		table = unquoteIdentifier(m[1])
+	}
+
+	if l.isNewTable(table) {
+		return ""
+	}
+
+	return fmt.Sprintf("CREATE INDEX on existing table %s blocks writes while the index is built, use CREATE INDEX CONCURRENTLY in a -- !txn migration", table)
+}
+
+func lintConcurrentlyInTransaction(l *lintStatement) string {
+	if !l.Migration.UseTx || !concurrentRegExp.MatchString(l.SQL) {
+		return ""
+	}
+
+	return "CONCURRENTLY can not run inside a transaction block, mark the migration with -- !txn"
+}
+
+func lintAddColumnNotNullWithoutDefault(l *lintStatement) string {
+	table, clauses, ok := alterTableClauses(l.SQL)
+	if !ok || l.isNewTable(table) {
+		return ""
+	}
+
+	for _, clause := range clauses {
+		matches := addColumnRegExp.FindStringSubmatch(clause)
+		if matches == nil || clauseKeywords[strings.ToUpper(matches[1])] {
+			continue
+		}
+
+		upper := strings.ToUpper(clause)
+		if strings.Contains(upper, "NOT NULL") && !strings.Contains(upper, "DEFAULT") {
+			return fmt.Sprintf("adding NOT NULL column %s to %s without a default fails on a table with rows", unquoteIdentifier(matches[1]), table)
+		}
+	}
+
+	return ""
+}
+
+func lintDropColumn(l *lintStatement) string {
+	table, clauses, ok := alterTableClauses(l.SQL)
+	if !ok || l.isNewTable(table) {
+		return ""
+	}
+
+	for _, clause := range clauses {
+		matches := dropColumnRegExp.FindStringSubmatch(clause)
+		if matches == nil || clauseKeywords[strings.ToUpper(matches[1])] {
+			continue
+		}
+
+		return fmt.Sprintf("dropping column %s.%s loses its data and breaks code still reading it", table, unquoteIdentifier(matches[1]))
+	}
+
+	return ""
+}
+
+func lintDropTable(l *lintStatement) string {
+	matches := dropTableRegExp.FindStringSubmatch(l.SQL)
+	if matches == nil {
+		return ""
+	}
+
+	for _, name := range strings.Split(matches[1], ",") {
+		table := unquoteIdentifier(strings.TrimSpace(name))
+		if !l.isNewTable(table) {
+			return fmt.Sprintf("dropping table %s loses its data and breaks code still reading it", table)
+		}
+	}
+
+	return ""
+}
+
+func lintMySQLTableCopy(l *lintStatement) string {
+	table, clauses, ok := alterTableClauses(l.SQL)
+	if !ok || l.isNewTable(table) {
+		return ""
+	}
+
+	// with an explicit online algorithm MySQL fails instead of copying
+	if mysqlOnlineAlgorithmRegExp.MatchString(l.SQL) {
+		return ""
+	}
+
+	for _, clause := range clauses {
+		if mysqlTableCopyRegExp.MatchString(clause) {
+			return fmt.Sprintf("ALTER TABLE %s %s copies the whole table and blocks writes, use an online schema change tool or ALGORITHM=INPLACE/INSTANT when supported", table, strings.ToUpper(strings.SplitN(clause, " ", 2)[0]))
+		}
+	}
+
+	return ""
+}
+
+// lintMissingDown flags a SQL migration without a down block, which down
+// refuses to roll back. An intentionally irreversible migration is marked.
+func lintMissingDown(m *Migration) string {
+	if m.Chunk == nil || m.Chunk.HasDown || m.Chunk.Irreversible {
+		return ""
+	}
+
+	return "the migration has no down block; add one, or mark the migration with '-- +irreversible'"
+}
@@ -0,0 +1,182 @@
+package rockhopper
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseLintTestMigration(t *testing.T, script string) *Migration {
+	t.Helper()
+
+	var parser MigrationParser
+	chunk, err := parser.ParseString(script)
+	require.NoError(t, err)
+
+	return &Migration{
+		Package:        DefaultPackageName,
+		Version:        20240101000000,
+		Source:         "migrations/20240101000000_test.sql",
+		UseTx:          chunk.UseTx,
+		Chunk:          chunk,
+		UpStatements:   chunk.UpStmts,
+		DownStatements: chunk.DownStmts,
+	}
+}
+
+func lintRuleNames(findings []LintFinding) (names []string) {
+	for _, f := range findings {
+		names = append(names, f.Rule)
+	}
+	return names
+}
+
+func TestLintMigrations(t *testing.T) {
+	testcases := []struct {
+		name    string
+		dialect string
+		script  string
+		rules   []string
+	}{
+		{
+			name:    "index on existing table",
+			dialect: DialectPostgres,
+			script:  "-- +up\nCREATE INDEX idx_users_email ON users (email);\n-- +down\nDROP INDEX idx_users_email;\n",
+			rules:   []string{"pg-index-not-concurrent"},
+		},
+		{
+			name:    "index on a table created by the migration",
+			dialect: DialectPostgres,
+			script:  "-- +up\nCREATE TABLE users (id INT, email TEXT);\nCREATE UNIQUE INDEX idx_users_email ON users (email);\n-- +down\nDROP TABLE users;\n",
+		},
+		{
+			name:    "index rule is postgres only",
+			dialect: DialectMySQL,
+			script:  "-- +up\nCREATE INDEX idx_users_email ON users (email);\n-- +down\n",
+		},
+		{
+			name:    "concurrently inside a transaction",
+			dialect: DialectPostgres,
+			script:  "-- +up\nCREATE INDEX CONCURRENTLY idx_users_email ON users (email);\n-- +down\nDROP INDEX CONCURRENTLY idx_users_email;\n",
+			rules:   []string{"concurrently-in-transaction", "concurrently-in-transaction"},
+		},
+		{
+			name:    "concurrently in a non-transactional migration",
+			dialect: DialectPostgres,
+			script:  "-- !txn\n-- +up\nCREATE INDEX CONCURRENTLY idx_users_email ON users (email);\n-- +down\n",
+		},
+		{
+			name:    "not null column without default",
+			dialect: DialectSQLite3,
+			script:  "-- +up\nALTER TABLE users ADD COLUMN age INT NOT NULL, ADD COLUMN nick TEXT NOT NULL DEFAULT '';\n-- +down\n",
+			rules:   []string{"add-column-not-null-without-default"},
+		},
+		{
+			name:    "not null column with default",
+			dialect: DialectSQLite3,
+			script:  "-- +up\nALTER TABLE users ADD COLUMN age INT NOT NULL DEFAULT 0;\n-- +down\n",
+		},
+		{
+			name:    "drop column and table in up",
+			dialect: DialectMySQL,
+			script:  "-- +up\nALTER TABLE users DROP COLUMN age;\nDROP TABLE IF EXISTS `legacy`;\n-- +down\nALTER TABLE users ADD COLUMN age INT;\n",
+			rules:   []string{"drop-column", "drop-table"},
+		},
+		{
+			name:    "dropping an index or a default is not a column drop",
+			dialect: DialectPostgres,
+			script:  "-- +up\nALTER TABLE users DROP CONSTRAINT users_age_check, ALTER COLUMN age DROP DEFAULT;\n-- +down\n",
+		},
+		{
+			name:    "mysql table copy",
+			dialect: DialectMySQL,
+			script:  "-- +up\nALTER TABLE users MODIFY COLUMN name VARCHAR(255) NOT NULL DEFAULT '';\nALTER TABLE users CONVERT TO CHARACTER SET utf8mb4;\n-- +down\n",
+			rules:   []string{"mysql-table-copy", "mysql-table-copy"},
+		},
+		{
+			name:    "mysql explicit online algorithm",
+			dialect: DialectMySQL,
+			script:  "-- +up\nALTER TABLE users MODIFY COLUMN name VARCHAR(255), ALGORITHM=INPLACE, LOCK=NONE;\n-- +down\n",
+		},
+		{
+			name:    "statement suppression",
+			dialect: DialectMySQL,
+			script:  "-- +up\n-- +lint-ignore drop-column\nALTER TABLE users DROP COLUMN age;\nALTER TABLE users DROP COLUMN nick;\n-- +down\n",
+			rules:   []string{"drop-column"},
+		},
+		{
+			name:    "missing down block",
+			dialect: DialectSQLite3,
+			script:  "-- +up\nCREATE TABLE a (id INT);\n",
+			rules:   []string{"missing-down"},
+		},
+		{
+			name:    "irreversible migration",
+			dialect: DialectSQLite3,
+			script:  "-- +irreversible\n-- +up\nCREATE TABLE a (id INT);\n",
+		},
+		{
+			name:    "missing down suppression",
+			dialect: DialectSQLite3,
+			script:  "-- +lint-ignore missing-down\n-- +up\nCREATE TABLE a (id INT);\n",
+		},
+		{
+			name:    "file suppression",
+			dialect: DialectPostgres,
+			script:  "-- +lint-ignore pg-index-not-concurrent, drop-table\n-- +up\nCREATE INDEX idx_a ON a (id);\nDROP TABLE b;\n-- +down\n",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := parseLintTestMigration(t, tc.script)
+			findings := LintMigrations(tc.dialect, MigrationSlice{m})
+			assert.Equal(t, tc.rules, lintRuleNames(findings))
+		})
+	}
+}
+
+func TestLintFinding_String(t *testing.T) {
+	m := parseLintTestMigration(t, "-- +up\nCREATE TABLE a (id INT);\nDROP TABLE b;\n-- +down\n")
+	findings := LintMigrations(DialectSQLite3, MigrationSlice{m})
+	require.Len(t, findings, 1)
+	assert.Equal(t, `source="migrations/20240101000000_test.sql" version=20240101000000 package="main" up statement #2: `+
+		`dropping table b loses its data and breaks code still reading it [drop-table]`, findings[0].String())
+}
+
+func TestLintFinding_StringMigration(t *testing.T) {
+	m := parseLintTestMigration(t, "-- +up\nCREATE TABLE a (id INT);\n")
+	findings := LintMigrations(DialectSQLite3, MigrationSlice{m})
+	require.Len(t, findings, 1)
+	assert.Equal(t, `source="migrations/20240101000000_test.sql" version=20240101000000 package="main": `+
+		`the migration has no down block; add one, or mark the migration with '-- +irreversible' [missing-down]`, findings[0].String())
+}
+
+func TestLintMigrations_Stream(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_seed.sql", "-- +stream\n-- +up\n"+
+		"CREATE TABLE seeds (id INT);\n"+
+		"CREATE INDEX seeds_id ON seeds (id);\n"+
+		"DROP TABLE legacy_seeds;\n"+
+		"-- +down\nDROP TABLE seeds;\n")
+
+	migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectPostgres}).Load(dir)
+	require.NoError(t, err)
+
+	m := migrations[0]
+	require.True(t, m.Stream)
+	require.Empty(t, m.UpStatements)
+
+	findings := LintMigrations(DialectPostgres, migrations)
+	assert.Equal(t, []string{"drop-table"}, lintRuleNames(findings), "the index on a streamed new table passes")
+	if assert.Len(t, findings, 1) {
+		assert.Equal(t, 3, findings[0].Statement)
+		assert.Equal(t, m.Source+":5", findings[0].Location)
+	}
+
+	require.NoError(t, os.Remove(m.Source))
+	findings = LintMigrations(DialectPostgres, migrations)
+	assert.Equal(t, []string{"stream-not-linted"}, lintRuleNames(findings))
+}
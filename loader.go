@@ -6,8 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -21,6 +23,10 @@ var (
 	ErrVersionNotFound = errors.New("migration version not found")
 
 	SqlMigrationFilenamePattern = regexp.MustCompile(`(\d+)_(\w+)\.sql$`)
+
+	// SqlMigrationPairFilenamePattern matches the two-file layout of
+	// golang-migrate: {version}_{name}.up.sql and {version}_{name}.down.sql.
+	SqlMigrationPairFilenamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
 )
 
 func replaceExt(s string, ext string) string {
@@ -34,6 +40,14 @@ type MigrationRecord struct {
 	Time      time.Time `db:"time"`
 	IsApplied bool      `db:"is_applied"` // was this a result of up() or down()
 	Package   string    `db:"package"`
+
+	// The audit columns, loaded by LoadMigration.
+	AppliedBy         string        `db:"applied_by"`
+	Hostname          string        `db:"hostname"`
+	RockhopperVersion string        `db:"rockhopper_version"`
+	BuildID           string        `db:"build_id"`
+	Duration          time.Duration `db:"duration_ms"`
+	Checksum          string        `db:"checksum"`
 }
 
 type TransactionHandler func(ctx context.Context, exec SQLExecutor) error
@@ -159,15 +173,28 @@ func (loader *SqlMigrationLoader) SetDefaultPackage(pkgName string) {
 
 // Load returns all the valid looking migration scripts in the
 // migrations folders and go func registry, and key them by version.
-// Load method always returns a sorted migration slice
+// Load method always returns a sorted migration slice, with the statements
+// of every script parsed.
 func (loader *SqlMigrationLoader) Load(dirs ...string) (MigrationSlice, error) {
+	all, err := loader.Scan(dirs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return all, all.Parse()
+}
+
+// Scan is like Load, but it reads only the file names and the annotations of
+// the scripts. The statements are parsed on demand, when a
+// migration runs, or with MigrationSlice.Parse.
+func (loader *SqlMigrationLoader) Scan(dirs ...string) (MigrationSlice, error) {
 	log.Debugf("starting loading sql migrations from %v", dirs)
 
 	var all MigrationSlice
 	for _, d := range dirs {
 		log.Debugf("loading sql migrations from %v", d)
 
-		slice, err := loader.LoadDir(d)
+		slice, err := loader.ScanDir(d)
 		if err != nil {
 			return nil, err
 		}
@@ -181,6 +208,16 @@ func (loader *SqlMigrationLoader) Load(dirs ...string) (MigrationSlice, error) {
 // LoadDir returns all the valid looking migration scripts in the
 // migrations folder and go func registry, and key them by version.
 func (loader *SqlMigrationLoader) LoadDir(dir string) (MigrationSlice, error) {
+	migrations, err := loader.ScanDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrations, migrations.Parse()
+}
+
+// ScanDir is like LoadDir, without parsing the statements, see Scan.
+func (loader *SqlMigrationLoader) ScanDir(dir string) (MigrationSlice, error) {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		return nil, fmt.Errorf("directory %q does not exists", dir)
 	}
@@ -198,7 +235,16 @@ func (loader *SqlMigrationLoader) LoadDir(dir string) (MigrationSlice, error) {
 		defaultPkgName = DefaultPackageName
 	}
 
+	pairs := make(map[int64]*Migration)
+
 	for _, file := range files {
+		if matches := SqlMigrationPairFilenamePattern.FindStringSubmatch(filepath.Base(file)); matches != nil {
+			if err := addPairFile(pairs, defaultPkgName, file, matches); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
 		versionID, err := FileNumericComponent(file)
 		if err != nil {
 			return nil, err
@@ -212,7 +258,19 @@ func (loader *SqlMigrationLoader) LoadDir(dir string) (MigrationSlice, error) {
 			Source:  file,
 		}
 
-		if err := migration.readSource(); err != nil {
+		if err := migration.scanSource(loader.dialect()); err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration)
+	}
+
+	for _, migration := range pairs {
+		if migration.Source == "" {
+			return nil, fmt.Errorf("%s: down migration file without its .up.sql file", migration.DownSource)
+		}
+
+		if err := migration.scanPairSource(loader.dialect()); err != nil {
 			return nil, err
 		}
 
@@ -231,27 +289,342 @@ func (loader *SqlMigrationLoader) LoadDir(dir string) (MigrationSlice, error) {
 	return migrations.SortAndConnect(), nil
 }
 
-func (m *Migration) readSource() error {
-	f, err := os.Open(m.Source)
+// dialect returns the dialect the SQL migration files are written in.
+func (loader *SqlMigrationLoader) dialect() string {
+	if loader.config == nil {
+		return ""
+	}
+
+	if loader.config.Dialect != "" {
+		return loader.config.Dialect
+	}
+
+	return loader.config.Driver
+}
+
+// addPairFile adds a file of the two-file layout to the migration of its
+// version, creating it for the first file of the pair.
+func addPairFile(pairs map[int64]*Migration, pkgName, file string, matches []string) error {
+	versionID, err := strconv.ParseInt(matches[1], 10, 64)
 	if err != nil {
-		return errors.Wrapf(err, "ERROR %v: failed to open SQL migration file", filepath.Base(m.Source))
+		return errors.Wrapf(err, "%s: invalid migration version", file)
 	}
 
-	defer f.Close()
+	if versionID <= 0 {
+		return fmt.Errorf("%s: migration IDs must be greater than zero", file)
+	}
+
+	migration, ok := pairs[versionID]
+	if !ok {
+		migration = &Migration{
+			Package: pkgName,
+			Version: versionID,
+			Name:    matches[2],
+		}
+		pairs[versionID] = migration
+	}
+
+	target := &migration.Source
+	if matches[3] == "down" {
+		target = &migration.DownSource
+	}
+
+	if *target != "" {
+		return fmt.Errorf("duplicate migration version %d detected:\n%s\n%s", versionID, *target, file)
+	}
+
+	*target = file
+	return nil
+}
+
+// lazySource parses the statements of a scanned migration once.
+type lazySource struct {
+	dialect string
+
+	// pair is set for the two-file layout.
+	pair bool
+
+	once sync.Once
+	err  error
+}
+
+// scanSource reads the header annotations of the script, its statements are
+// parsed by Parse.
+func (m *Migration) scanSource(dialectName string) error {
+	header, err := readMigrationHeader(m.Source, dialectName)
+	if err != nil {
+		return err
+	}
+
+	m.setHeader(header)
+	m.lazy = &lazySource{dialect: dialectName}
+	return nil
+}
+
+// scanPairSource is scanSource for the two-file layout, where the down file
+// may disable the transaction too.
+func (m *Migration) scanPairSource(dialectName string) error {
+	header, err := readMigrationHeader(m.Source, dialectName)
+	if err != nil {
+		return err
+	}
+
+	m.setHeader(header)
+
+	if m.DownSource != "" {
+		downHeader, err := readMigrationHeader(m.DownSource, dialectName)
+		if err != nil {
+			return err
+		}
+
+		m.UseTx = m.UseTx && downHeader.UseTx
+	}
+
+	m.lazy = &lazySource{dialect: dialectName, pair: true}
+	return nil
+}
+
+func (m *Migration) setHeader(header *MigrationScriptChunk) {
+	m.Stream = header.Stream
+	m.BatchSize = header.BatchSize
+	m.UseTx = header.UseTx
+	m.SquashedFrom = header.SquashedFrom
+	m.Irreversible = header.Irreversible
+
+	if header.Package != "" {
+		m.Package = header.Package
+	}
+
+	m.setRequires(header.Requires)
+}
+
+// Parse parses the statements of a migration scanned by
+// SqlMigrationLoader.Scan. It parses the script once, later calls return the
+// same result. Migrations that were not scanned have nothing to parse.
+func (m *Migration) Parse() error {
+	if m.lazy == nil {
+		return nil
+	}
+
+	m.lazy.once.Do(func() {
+		if m.lazy.pair {
+			m.lazy.err = m.readPairSource(m.lazy.dialect)
+		} else {
+			m.lazy.err = m.readSource(m.lazy.dialect)
+		}
+	})
+
+	return m.lazy.err
+}
+
+// Parse parses the statements of the scanned migrations with a bounded pool
+// of workers. It returns the error of the first migration that fails.
+func (slice MigrationSlice) Parse() error {
+	var unparsed MigrationSlice
+	for _, m := range slice {
+		if m.lazy != nil {
+			unparsed = append(unparsed, m)
+		}
+	}
+
+	workers := min(runtime.GOMAXPROCS(0), len(unparsed))
+	if workers <= 1 {
+		for _, m := range unparsed {
+			if err := m.Parse(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	errs := make([]error, len(unparsed))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = unparsed[i].Parse()
+			}
+		}()
+	}
+
+	for i := range unparsed {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readUpFile parses the script of the up statements. For a stream migration
+// it returns what is known of the up statements instead of keeping them.
+func (m *Migration) readUpFile(dialectName string, section Direction) (*MigrationScriptChunk, *streamedUp, error) {
+	if m.Stream {
+		return readStreamFile(m.Source, dialectName, section)
+	}
+
+	chunk, err := readMigrationFile(m.Source, dialectName, section)
+	return chunk, nil, err
+}
 
-	var parser MigrationParser
-	chunk, err := parser.Parse(f)
+func (m *Migration) readSource(dialectName string) error {
+	chunk, up, err := m.readUpFile(dialectName, 0)
 	if err != nil {
-		return errors.Wrapf(err, "%s: failed to parse SQL migration file", filepath.Base(m.Source))
+		return err
 	}
 
+	m.warnLatePackage(chunk)
 	m.Chunk = chunk
 	m.UseTx = chunk.UseTx
 	m.UpStatements = chunk.UpStmts
 	m.DownStatements = chunk.DownStmts
+	m.SquashedFrom = chunk.SquashedFrom
+	m.Irreversible = chunk.Irreversible
+	m.BatchSize = chunk.BatchSize
 
 	if chunk.Package != "" {
 		m.Package = chunk.Package
 	}
+
+	m.setRequires(chunk.Requires)
+	m.setStreamChecksum(up)
+	m.warnTrackedBatch()
 	return nil
 }
+
+// warnLatePackage warns when a scanned script declares its package after the
+// first statement, which the scan does not read: the migration was listed and
+// planned in the package of its header until it was parsed.
+func (m *Migration) warnLatePackage(chunk *MigrationScriptChunk) {
+	if m.lazy != nil && chunk.Package != "" && chunk.Package != m.Package {
+		log.Warnf("%s: the '-- @package %s' annotation comes after the first statement, the migration was scanned in package %q; move it before the first statement",
+			filepath.Base(m.Source), chunk.Package, m.Package)
+	}
+}
+
+// setRequires sets the required migrations of the script, a version without
+// a package is in the package of the migration.
+func (m *Migration) setRequires(refs []MigrationRef) {
+	m.Requires = nil
+	for _, ref := range refs {
+		if ref.Package == "" {
+			ref.Package = m.Package
+		}
+
+		m.Requires = append(m.Requires, ref)
+	}
+}
+
+// readPairSource reads a migration in the two-file layout. The files hold
+// plain SQL without the '-- +up' / '-- +down' annotations, the other
+// annotations, such as '-- @package' in the up file, are read as usual.
+func (m *Migration) readPairSource(dialectName string) error {
+	chunk, up, err := m.readUpFile(dialectName, DirectionUp)
+	if err != nil {
+		return err
+	}
+
+	m.warnLatePackage(chunk)
+	m.Chunk = chunk
+	m.UseTx = chunk.UseTx
+	m.UpStatements = chunk.UpStmts
+	m.SquashedFrom = chunk.SquashedFrom
+	m.Irreversible = chunk.Irreversible
+	m.BatchSize = chunk.BatchSize
+
+	if chunk.Package != "" {
+		m.Package = chunk.Package
+	}
+
+	m.setRequires(chunk.Requires)
+
+	if m.DownSource == "" {
+		m.setStreamChecksum(up)
+		m.warnTrackedBatch()
+		return nil
+	}
+
+	downChunk, err := readMigrationFile(m.DownSource, dialectName, DirectionDown)
+	if err != nil {
+		return err
+	}
+
+	if chunk.Irreversible && len(downChunk.DownStmts) > 0 {
+		return fmt.Errorf("%s: a '-- +irreversible' migration can not have a down file with statements", filepath.Base(m.Source))
+	}
+
+	chunk.HasDown = true
+	chunk.Irreversible = downChunk.Irreversible
+	chunk.DownStmts = downChunk.DownStmts
+	m.DownStatements = downChunk.DownStmts
+	m.UseTx = m.UseTx && downChunk.UseTx
+	m.Irreversible = chunk.Irreversible
+	m.setStreamChecksum(up)
+	m.warnTrackedBatch()
+	return nil
+}
+
+// readMigrationHeader reads the header annotations of a SQL migration file.
+func readMigrationHeader(path, dialectName string) (*MigrationScriptChunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ERROR %v: failed to open SQL migration file", filepath.Base(path))
+	}
+
+	defer f.Close()
+
+	parser := MigrationParser{Dialect: dialectName}
+	header, err := parser.ParseHeader(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: failed to parse SQL migration file", filepath.Base(path))
+	}
+
+	return header, nil
+}
+
+// readMigrationFile parses a SQL migration file and records the file in its
+// statements. section is the direction of a file without the '-- +up' /
+// '-- +down' annotations, or zero for an annotated file.
+func readMigrationFile(path, dialectName string, section Direction) (*MigrationScriptChunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ERROR %v: failed to open SQL migration file", filepath.Base(path))
+	}
+
+	defer f.Close()
+
+	parser := MigrationParser{Dialect: dialectName}
+
+	var chunk *MigrationScriptChunk
+	if section == 0 {
+		chunk, err = parser.Parse(f)
+	} else {
+		chunk, err = parser.ParseSection(f, section)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: failed to parse SQL migration file", filepath.Base(path))
+	}
+
+	for i := range chunk.UpStmts {
+		chunk.UpStmts[i].File = path
+	}
+
+	for i := range chunk.DownStmts {
+		chunk.DownStmts[i].File = path
+	}
+
+	return chunk, nil
+}
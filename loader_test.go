@@ -1,9 +1,16 @@
 package rockhopper
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFileNumericComponent(t *testing.T) {
@@ -40,6 +47,107 @@ func TestSqlMigrationLoader_Load(t *testing.T) {
 	assert.NotEmpty(t, migrations)
 }
 
+func TestSqlMigrationLoader_Scan(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_create_users.sql",
+		"-- @package users\n-- +up\n-- !txn\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n")
+	writeTestMigrationFile(t, dir, "20240102120000_create_posts.sql",
+		"-- @package users\n-- @requires billing:20240101000000\n-- +up\nCREATE TABLE posts (id INT);\n")
+	writeTestMigrationFile(t, dir, "20240103120000_broken.sql",
+		"-- +up\nCREATE TABLE broken (id INT)\n")
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+	migrations, err := loader.Scan(dir)
+	require.NoError(t, err)
+	require.Len(t, migrations, 3, "the statements of the broken script are not parsed")
+
+	users := migrations[0]
+	assert.Equal(t, "users", users.Package)
+	assert.False(t, users.UseTx)
+	assert.Nil(t, users.UpStatements)
+	assert.Equal(t, []MigrationRef{{Package: "billing", Version: 20240101000000}}, migrations[1].Requires)
+
+	db := openTestDB(t)
+	require.NoError(t, users.Up(context.Background(), db), "the statements are parsed when the migration runs")
+	assert.Len(t, users.UpStatements, 1)
+	assert.Len(t, users.DownStatements, 1)
+
+	err = migrations.Parse()
+	assert.ErrorContains(t, err, "20240103120000_broken.sql")
+
+	_, err = loader.Load(dir)
+	assert.ErrorContains(t, err, "20240103120000_broken.sql")
+}
+
+func TestSqlMigrationLoader_ScanLateAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_create_users.sql",
+		"-- +up\nCREATE TABLE users (id INT);\n-- @package users\n-- !txn\n"+
+			"INSERT INTO users (id) VALUES (1); -- @package posts\n"+
+			"-- +down\n-- +begin\nDROP TABLE users;\n-- +end\n")
+	writeTestMigrationFile(t, dir, "20240102120000_seed.sql",
+		"-- +up\nINSERT INTO notes (body) VALUES ('\n-- @package notes\n');\n")
+
+	migrations, err := NewSqlMigrationLoader(&Config{}).Scan(dir)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	// the scan stops at the first statement, the annotations after it are
+	// read when the script is parsed, like Load does
+	users := migrations[0]
+	assert.Equal(t, DefaultPackageName, users.Package)
+	assert.True(t, users.UseTx)
+	require.NoError(t, users.Parse())
+	assert.Equal(t, "users", users.Package)
+	assert.False(t, users.UseTx)
+
+	require.NoError(t, migrations[1].Parse())
+	assert.Equal(t, DefaultPackageName, migrations[1].Package, "a line of a string is not an annotation")
+}
+
+func TestMigrationParser_ParseHeader_StopsAtFirstStatement(t *testing.T) {
+	script := "-- @package users\n-- !txn\n\n-- +batch 10\n-- +up\nCREATE TABLE users (id INT);\n"
+
+	// the rest of the script is never read
+	r := io.MultiReader(strings.NewReader(script), iotest.ErrReader(errors.New("read past the header")))
+
+	chunk, err := (&MigrationParser{}).ParseHeader(r)
+	require.NoError(t, err)
+	assert.Equal(t, "users", chunk.Package)
+	assert.False(t, chunk.UseTx)
+	assert.Equal(t, 10, chunk.BatchSize)
+}
+
+// BenchmarkSqlMigrationLoader compares scanning a large migration tree with
+// loading and parsing it.
+func BenchmarkSqlMigrationLoader(b *testing.B) {
+	dir := b.TempDir()
+	for i := 0; i < 5000; i++ {
+		name := fmt.Sprintf("%d_create_table_%d.sql", 20240101000000+int64(i), i)
+		content := fmt.Sprintf("-- @package app%d\n-- +up\nCREATE TABLE t%d (\n  id INT PRIMARY KEY,\n  name VARCHAR(64) NOT NULL DEFAULT ''\n);\nCREATE INDEX t%d_name ON t%d (name);\n-- +down\nDROP TABLE t%d;\n",
+			i%10, i, i, i, i)
+		writeTestMigrationFile(b, dir, name, content)
+	}
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+
+	b.Run("Scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := loader.Scan(dir); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Load", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := loader.Load(dir); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
 func Test_toCamelCase(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"iter"
 	"reflect"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/pkg/errors"
@@ -28,6 +31,10 @@ type Migration struct {
 	// Source is the path to the .sql script
 	Source string
 
+	// DownSource is the path to the .down.sql script of a migration in the
+	// two-file layout of golang-migrate, where Source is the .up.sql script.
+	DownSource string
+
 	UseTx bool
 
 	Chunk *MigrationScriptChunk
@@ -47,6 +54,45 @@ type Migration struct {
 
 	UpStatements   []Statement
 	DownStatements []Statement
+
+	// SquashedFrom is the first version of the range this migration was
+	// squashed from. The range ends at Version. Zero for regular migrations.
+	SquashedFrom int64
+
+	// Irreversible marks a migration that can not be rolled back, with a
+	// "-- +irreversible" annotation or an empty down block.
+	Irreversible bool
+
+	// Requires are the migrations of other packages that must run before
+	// this one, declared with "-- @requires pkg:version" or Requires.
+	Requires []MigrationRef
+
+	// Stream marks a migration declared with "-- +stream", whose up
+	// statements are not kept in UpStatements but read from Source while they
+	// run.
+	Stream bool
+
+	// BatchSize is the number of statements sent to the database per round
+	// trip, declared with "-- +batch [size]" or BatchStatements. Zero runs the
+	// statements one by one.
+	BatchSize int
+
+	// checksum overrides Checksum for a migration rebuilt from a plan step,
+	// which carries the statements of one direction only.
+	checksum string
+
+	// previousVersion is the version of the previous migration of the package,
+	// set by the planner for a down step, so that a migration rebuilt from a
+	// plan step, which has no Previous link, can move the imported baseline.
+	previousVersion int64
+
+	// streamCommits tells which up statements of a stream migration commit
+	// implicitly, since they are not kept, see checkImplicitCommits.
+	streamCommits *statementCommits
+
+	// lazy parses the statements of a migration scanned from a SQL file on
+	// demand, see Parse.
+	lazy *lazySource
 }
 
 func (m *Migration) String() string {
@@ -55,14 +101,38 @@ func (m *Migration) String() string {
 
 // Up runs an up migration.
 func (m *Migration) Up(ctx context.Context, db *DB) error {
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
 	return m.runUp(ctx, db)
 }
 
-// Down runs a down migration.
+// Down runs a down migration. It returns IrreversibleMigrationError when the
+// migration can not be rolled back, unless the DB forces irreversible
+// migrations down.
 func (m *Migration) Down(ctx context.Context, db *DB) error {
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
+	if err := db.checkReversible(m); err != nil {
+		return err
+	}
+
+	if !m.Reversible() {
+		log.Warnf("forcing irreversible migration %s down, its changes stay in the database", m.location())
+	}
+
 	return m.runDown(ctx, db)
 }
 
+// Reversible reports whether the migration has down statements or a down
+// function to roll it back with.
+func (m *Migration) Reversible() bool {
+	return !m.Irreversible && (m.DownFn != nil || len(m.DownStatements) > 0)
+}
+
 type statementExecutorFunc func(ctx context.Context, db *sql.DB, callbacks ...TransactionHandler) error
 
 func withoutTransaction(ctx context.Context, db *sql.DB, callbacks ...TransactionHandler) error {
@@ -97,36 +167,96 @@ func (m *Migration) getStmtExecutor() statementExecutorFunc {
 	return withoutTransaction
 }
 
+// runUp applies the migration and appends the attempt to the migration log,
+// whether it succeeded or not.
 func (m *Migration) runUp(ctx context.Context, db *DB) error {
+	startTime := time.Now()
+
+	var executed int
+	var err error
+
+	// non-transactional statements can not be rolled back when one of them
+	// fails, so their progress is recorded to resume from the failed statement.
+	if !m.UseTx && m.UpFn == nil {
+		executed, err = m.runUpTracked(ctx, db, startTime)
+	} else {
+		executed, err = m.runUpStatements(ctx, db, startTime)
+	}
+
+	db.appendMigrationLog(ctx, m, DirectionUp, time.Since(startTime), executed, err)
+	return err
+}
+
+func (m *Migration) runUpStatements(ctx context.Context, db *DB, startTime time.Time) (int, error) {
+	if err := db.checkImplicitCommits(m, DirectionUp, m.UpStatements); err != nil {
+		return 0, err
+	}
+
+	conn, batchSize := db.batchConn(m)
+
+	var executed int
 	fn := withDefault[TransactionHandler](m.UpFn, func(ctx context.Context, exec SQLExecutor) error {
-		return executeStatements(ctx, exec, m.UpStatements)
+		return db.withServerCancel(ctx, exec, func(exec SQLExecutor) (err error) {
+			executed, err = executeStatementBatches(ctx, exec, m.upStatementSeq(db), batchSize, db.errorPosition())
+			return err
+		})
 	})
 	finalizer := func(ctx context.Context, exec SQLExecutor) error {
-		return db.insertVersion(ctx, exec, m.Package, m.Source, m.Version, true)
+		return db.insertAppliedVersion(ctx, exec, m, time.Since(startTime))
 	}
 
-	var executor = m.getStmtExecutor()
-	if err := executor(ctx, db.DB, fn, finalizer); err != nil {
-		return errors.Wrapf(err, "up migration failed: %s", m.location())
+	var executor = db.stmtExecutor(m)
+	if err := executor(ctx, conn, fn, finalizer); err != nil {
+		err = db.checkPartialCommit(m, DirectionUp, m.UpStatements, executed, batchSize, err)
+		return executed, errors.Wrapf(err, "up migration failed: %s", m.location())
 	}
 
-	return nil
+	return executed, nil
 }
 
+// runDown rolls back the migration and appends the attempt to the migration
+// log, whether it succeeded or not.
 func (m *Migration) runDown(ctx context.Context, db *DB) error {
+	startTime := time.Now()
+	executed, err := m.runDownStatements(ctx, db)
+	db.appendMigrationLog(ctx, m, DirectionDown, time.Since(startTime), executed, err)
+	return err
+}
+
+func (m *Migration) runDownStatements(ctx context.Context, db *DB) (int, error) {
+	baseline, _, err := db.queryImportedBaseline(ctx, m.Package)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := db.checkImplicitCommits(m, DirectionDown, m.DownStatements); err != nil {
+		return 0, err
+	}
+
+	conn, batchSize := db.batchConn(m)
+
+	var executed int
 	fn := withDefault[TransactionHandler](m.DownFn, func(ctx context.Context, exec SQLExecutor) error {
-		return executeStatements(ctx, exec, m.DownStatements)
+		return db.withServerCancel(ctx, exec, func(exec SQLExecutor) (err error) {
+			executed, err = executeStatementBatches(ctx, exec, statementSeq(m.DownStatements), batchSize, db.errorPosition())
+			return err
+		})
 	})
 	finalizer := func(ctx context.Context, exec SQLExecutor) error {
-		return db.deleteVersion(ctx, exec, m.Package, m.Version)
+		if err := db.deleteVersion(ctx, exec, m.Package, m.Version); err != nil {
+			return err
+		}
+
+		return db.moveImportedBaseline(ctx, exec, m, baseline)
 	}
 
-	var executor = m.getStmtExecutor()
-	if err := executor(ctx, db.DB, fn, finalizer); err != nil {
-		return errors.Wrapf(err, "down migration failed: %s", m.location())
+	var executor = db.stmtExecutor(m)
+	if err := executor(ctx, conn, fn, finalizer); err != nil {
+		err = db.checkPartialCommit(m, DirectionDown, m.DownStatements, executed, batchSize, err)
+		return executed, errors.Wrapf(err, "down migration failed: %s", m.location())
 	}
 
-	return nil
+	return executed, nil
 }
 
 // location returns a human-readable identifier of the migration for error
@@ -149,7 +279,11 @@ func withStatementDebug(next statementExecution) statementExecution {
 		err := next(ctx, e, stmt)
 		if err != nil {
 			log.Error(err.Error())
-			log.Error(stmt.SQL)
+			if loc := stmt.location(); loc != "" {
+				log.Errorf("%s: %s", loc, stmt.SQL)
+			} else {
+				log.Error(stmt.SQL)
+			}
 		}
 
 		return err
@@ -166,7 +300,11 @@ func withStatementPrettyLog(next statementExecution) statementExecution {
 		if err != nil {
 			fmt.Printf("[  %s  ]", text.Colors{text.FgHiRed}.Sprint("FAILED"))
 			fmt.Print("\n")
-			log.Error(stmt.SQL)
+			if loc := stmt.location(); loc != "" {
+				log.Errorf("%s: %s", loc, stmt.SQL)
+			} else {
+				log.Error(stmt.SQL)
+			}
 			log.Error(err.Error())
 		} else {
 			fmt.Printf("[  %s  ]", text.Colors{text.FgHiGreen}.Sprint("OK"))
@@ -208,24 +346,41 @@ func executeStatement(ctx context.Context, e SQLExecutor, stmt *Statement) error
 	return fn(ctx, e, stmt)
 }
 
-// executeStatements executes the given statements sequentially. Statements that
-// carry no executable SQL (empty, comment-only, or just semicolons) are skipped
-// so leftover queries from merged migration files do not fail execution.
-func executeStatements(ctx context.Context, e SQLExecutor, stmts []Statement) error {
-	for i := range stmts {
-		stmt := &stmts[i]
+// executeStatements executes the given statements sequentially and returns the
+// number of statements executed successfully. Statements that carry no
+// executable SQL (empty, comment-only, or just semicolons) are skipped so
+// leftover queries from merged migration files do not fail execution.
+func executeStatements(ctx context.Context, e SQLExecutor, stmts []Statement) (int, error) {
+	return executeStatementSeq(ctx, e, statementSeq(stmts))
+}
+
+// executeStatementSeq executes the statements as they are yielded.
+func executeStatementSeq(ctx context.Context, e SQLExecutor, stmts iter.Seq2[Statement, error]) (int, error) {
+	executed, i := 0, 0
+	for stmt, err := range stmts {
+		if err != nil {
+			return executed, err
+		}
 
 		if isNoOpSQL(stmt.SQL) {
 			log.Debugf("skipping empty SQL statement #%d", i+1)
+			i++
 			continue
 		}
 
-		if err := executeStatement(ctx, e, stmt); err != nil {
-			return errors.Wrapf(err, "statement #%d", i+1)
+		if err := executeStatement(ctx, e, &stmt); err != nil {
+			if interruptErr := interrupted(ctx, i, stmt.describe(i)); interruptErr != nil {
+				return executed, interruptErr
+			}
+
+			return executed, errors.Wrap(err, stmt.describe(i))
 		}
+
+		executed++
+		i++
 	}
 
-	return nil
+	return executed, nil
 }
 
 type MigrationSlice []*Migration
@@ -256,6 +411,52 @@ func (ms MigrationSlice) FilterPackage(pkgs []string) (slice MigrationSlice) {
 	return slice
 }
 
+// Packages returns the sorted package names of the migrations.
+func (ms MigrationSlice) Packages() (names []string) {
+	for _, m := range ms {
+		if !sliceContains(names, m.Package) {
+			names = append(names, m.Package)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// PackageRequiredError is returned when a rollback is not scoped to a package
+// while the migrations belong to several packages, whose versions are
+// unrelated to each other.
+type PackageRequiredError struct {
+	Packages []string
+}
+
+func (e *PackageRequiredError) Error() string {
+	return fmt.Sprintf("the migrations belong to several packages (%s); choose one with --package",
+		strings.Join(e.Packages, ", "))
+}
+
+// ForPackage returns the migrations of the package, sorted and linked to each
+// other only. An empty pkgName selects the only package of the migrations, and
+// returns PackageRequiredError when there are several.
+func (ms MigrationSlice) ForPackage(pkgName string) (MigrationSlice, error) {
+	if pkgName == "" {
+		packages := ms.Packages()
+		if len(packages) > 1 {
+			return nil, &PackageRequiredError{Packages: packages}
+		}
+
+		return append(MigrationSlice(nil), ms...).SortAndConnect(), nil
+	}
+
+	slice := ms.FilterPackage([]string{pkgName})
+	if len(slice) == 0 {
+		return nil, fmt.Errorf("no migrations of package %q found, available packages: %s",
+			pkgName, strings.Join(ms.Packages(), ", "))
+	}
+
+	return slice.SortAndConnect(), nil
+}
+
 func (ms MigrationSlice) MapByPackage() MigrationMap {
 	mm := make(MigrationMap)
 
@@ -2,10 +2,12 @@ package rockhopper
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLegacyGooseTableMigration_sqlite3(t *testing.T) {
@@ -187,6 +189,32 @@ func TestMigration_ErrorIncludesLocation(t *testing.T) {
 	}
 }
 
+// TestMigration_ErrorIncludesStatementLine guards that a failing statement of a
+// loaded SQL file is reported as file:line, which editors can jump to.
+func TestMigration_ErrorIncludesStatementLine(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240131120000_broken.sql",
+		"-- +up\nCREATE TABLE a (id INT);\n\nINSERT INTO missing (id)\nVALUES (1);\n")
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+
+	source := filepath.Join(dir, "20240131120000_broken.sql")
+	stmts := migrations[0].UpStatements
+	assert.Equal(t, []int{2, 4}, []int{stmts[0].Line, stmts[1].Line})
+	assert.Equal(t, source, stmts[1].File)
+
+	err = Up(ctx, db, migrations.Head(), 0)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "statement #2 at "+source+":4")
+	}
+}
+
 func TestIsNoOpSQL(t *testing.T) {
 	tests := []struct {
 		name string
@@ -209,3 +237,27 @@ func TestIsNoOpSQL(t *testing.T) {
 		})
 	}
 }
+
+func TestLegacyGooseTableMigration_sqlite3KeepsTable(t *testing.T) {
+	ctx := context.Background()
+	db := openGolangMigrateTestDB(t,
+		`CREATE TABLE goose_db_version (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version_id INTEGER NOT NULL,
+			is_applied INTEGER NOT NULL,
+			tstamp TIMESTAMP DEFAULT (datetime('now')))`,
+		`INSERT INTO goose_db_version (version_id, is_applied) VALUES (20240101120000, 1)`)
+	db.SetMaxOpenConns(1)
+	db.SetKeepLegacyTables(true)
+
+	require.NoError(t, db.Touch(ctx))
+
+	m := &Migration{Package: DefaultPackageName, Version: 20240101120000}
+	_, err := db.LoadMigration(ctx, m)
+	require.NoError(t, err)
+	require.NotNil(t, m.Record)
+	assert.True(t, m.Record.IsApplied)
+
+	_, err = db.Exec("SELECT package FROM goose_db_version")
+	assert.Error(t, err, "the kept goose table is not altered on sqlite")
+}
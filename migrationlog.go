@@ -0,0 +1,185 @@
+package rockhopper
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/c9s/rockhopper/v2/pkg/dialect"
+)
+
+// MigrationLogTableName is the core table with one row per attempt to apply or
+// roll back a migration. Unlike the version table, rows are never updated or
+// deleted, so it keeps the rollbacks and the failures too.
+const MigrationLogTableName = "rockhopper_migration_log"
+
+// Outcomes of a migration attempt stored in the outcome column.
+const (
+	MigrationLogSuccess = "success"
+	MigrationLogFailed  = "failed"
+)
+
+// MigrationLogEntry is a row of the migration log.
+type MigrationLogEntry struct {
+	ID         int64
+	Package    string
+	Version    int64
+	SourceFile string
+	Direction  Direction
+	Outcome    string
+	Error      string
+	Duration   time.Duration
+
+	// Statements is the number of statements executed before the migration
+	// finished or failed. It is 0 for a Go migration.
+	Statements int
+
+	AppliedBy string
+	Hostname  string
+	Time      time.Time
+}
+
+// MigrationLogFilter selects the rows of the migration log. Zero fields do not
+// filter.
+type MigrationLogFilter struct {
+	Package string
+	Version int64
+
+	// Since and Until bound the time of the attempt, Until is exclusive.
+	Since time.Time
+	Until time.Time
+
+	Limit int
+}
+
+// migrationLogSchema describes the migration log table.
+func migrationLogSchema(tableName string) dialect.Schema {
+	return dialect.Schema{
+		Table: tableName,
+		Columns: []dialect.Column{
+			{Name: "id", Type: dialect.ColSerial, PrimaryKey: true},
+			{Name: "package", Type: dialect.ColVarchar, Size: packageColumnSize, NotNull: true, Default: "'main'"},
+			{Name: "version_id", Type: dialect.ColBigInt, NotNull: true},
+			{Name: "source_file", Type: dialect.ColVarchar, Size: 255, NotNull: true, Default: "''"},
+			{Name: "direction", Type: dialect.ColVarchar, Size: 8, NotNull: true},
+			{Name: "outcome", Type: dialect.ColVarchar, Size: 16, NotNull: true},
+			{Name: "error", Type: dialect.ColText},
+			{Name: "duration_ms", Type: dialect.ColBigInt, NotNull: true, Default: "0"},
+			{Name: "statements", Type: dialect.ColBigInt, NotNull: true, Default: "0"},
+			{Name: "applied_by", Type: dialect.ColVarchar, Size: 128, NotNull: true, Default: "''"},
+			{Name: "hostname", Type: dialect.ColVarchar, Size: 255, NotNull: true, Default: "''"},
+			{Name: "executed_at", Type: dialect.ColTimestamp, NotNull: true, Default: dialect.DefaultNow},
+		},
+	}
+}
+
+func (db *DB) createMigrationLogTable(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, db.dialect.CreateTable(migrationLogSchema(MigrationLogTableName)))
+	return err
+}
+
+// appendMigrationLog records an attempt to apply or roll back m. It runs on
+// its own connection after the migration transaction has finished, so that a
+// failed attempt is recorded even though its transaction was rolled back. A
+// failure to write the log is logged and does not change the outcome. The
+// attempts of an atomic run are recorded when its transaction ends.
+func (db *DB) appendMigrationLog(ctx context.Context, m *Migration, direction Direction, duration time.Duration, statements int, migrationErr error) {
+	if db.atomicRun != nil {
+		db.atomicRun.attempts = append(db.atomicRun.attempts, migrationAttempt{
+			m: m, direction: direction, duration: duration, statements: statements, err: migrationErr,
+		})
+		return
+	}
+
+	outcome := MigrationLogSuccess
+	var errMsg sql.NullString
+	if migrationErr != nil {
+		outcome = MigrationLogFailed
+		errMsg = sql.NullString{String: migrationErr.Error(), Valid: true}
+	}
+
+	q, args := db.dialect.Insert(MigrationLogTableName, []dialect.Col{
+		{Name: "package", Val: m.Package},
+		{Name: "version_id", Val: m.Version},
+		{Name: "source_file", Val: m.Source},
+		{Name: "direction", Val: direction.String()},
+		{Name: "outcome", Val: outcome},
+		{Name: "error", Val: errMsg},
+		{Name: "duration_ms", Val: duration.Milliseconds()},
+		{Name: "statements", Val: statements},
+		{Name: "applied_by", Val: db.audit.AppliedBy},
+		{Name: "hostname", Val: db.audit.Hostname},
+	})
+
+	// a cancelled migration is recorded as well
+	if _, err := db.DB.ExecContext(context.WithoutCancel(ctx), q, args...); err != nil {
+		log.WithError(err).Errorf("unable to write the migration log of %s", m.location())
+	}
+}
+
+// LoadMigrationLog loads the rows of the migration log matching the filter,
+// the most recent first.
+func (db *DB) LoadMigrationLog(ctx context.Context, filter MigrationLogFilter) ([]MigrationLogEntry, error) {
+	var keys []dialect.Col
+	if filter.Package != "" {
+		keys = append(keys, dialect.Col{Name: "package", Val: filter.Package})
+	}
+
+	if filter.Version != 0 {
+		keys = append(keys, dialect.Col{Name: "version_id", Val: filter.Version})
+	}
+
+	opt := dialect.SelectOpt{
+		OrderBy: []dialect.Order{{Col: "id", Desc: true}},
+		Limit:   filter.Limit,
+	}
+
+	if !filter.Since.IsZero() {
+		opt.Conds = append(opt.Conds, dialect.Cond{Col: "executed_at", Op: ">=", Val: filter.Since.UTC()})
+	}
+
+	if !filter.Until.IsZero() {
+		opt.Conds = append(opt.Conds, dialect.Cond{Col: "executed_at", Op: "<", Val: filter.Until.UTC()})
+	}
+
+	q, args := db.dialect.Select(MigrationLogTableName,
+		[]string{"id", "package", "version_id", "source_file", "direction", "outcome", "error", "duration_ms", "statements", "applied_by", "hostname", "executed_at"},
+		keys, opt)
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the migration log")
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var entries []MigrationLogEntry
+	for rows.Next() {
+		var e MigrationLogEntry
+		var direction string
+		var errMsg sql.NullString
+		var durationMs int64
+		if err := rows.Scan(&e.ID, &e.Package, &e.Version, &e.SourceFile, &direction, &e.Outcome, &errMsg,
+			&durationMs, &e.Statements, &e.AppliedBy, &e.Hostname, &e.Time); err != nil {
+			return nil, errors.Wrap(err, "failed to scan the migration log")
+		}
+
+		switch direction {
+		case DirectionUp.String():
+			e.Direction = DirectionUp
+		case DirectionDown.String():
+			e.Direction = DirectionDown
+		}
+
+		e.Error = errMsg.String
+		e.Duration = time.Duration(durationMs) * time.Millisecond
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,86 @@
+package rockhopper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationLog(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_create_users.sql", "-- +up\nCREATE TABLE users (id INT);\nCREATE INDEX idx_users_id ON users (id);\n-- +down\nDROP TABLE users;\n")
+	writeTestMigrationFile(t, dir, "20240102120000_broken.sql", "-- +up\nCREATE TABLE posts (id INT);\nINSERT INTO missing (id) VALUES (1);\n-- +down\nDROP TABLE posts;\n")
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+
+	users, broken := migrations[0], migrations[1]
+
+	require.NoError(t, users.Up(ctx, db))
+	require.NoError(t, users.Down(ctx, db))
+	require.NoError(t, users.Up(ctx, db))
+	require.Error(t, broken.Up(ctx, db))
+
+	entries, err := db.LoadMigrationLog(ctx, MigrationLogFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 4, "the rollback and the failure are kept")
+
+	// the most recent first
+	failed := entries[0]
+	assert.Equal(t, broken.Version, failed.Version)
+	assert.Equal(t, DirectionUp, failed.Direction)
+	assert.Equal(t, MigrationLogFailed, failed.Outcome)
+	assert.Contains(t, failed.Error, "missing")
+	assert.Equal(t, 1, failed.Statements, "the statements before the failed one")
+
+	rolledBack := entries[2]
+	assert.Equal(t, users.Version, rolledBack.Version)
+	assert.Equal(t, DirectionDown, rolledBack.Direction)
+	assert.Equal(t, MigrationLogSuccess, rolledBack.Outcome)
+	assert.Empty(t, rolledBack.Error)
+	assert.Equal(t, 1, rolledBack.Statements)
+
+	applied := entries[3]
+	assert.Equal(t, 2, applied.Statements)
+	assert.Equal(t, users.Source, applied.SourceFile)
+	assert.Equal(t, db.AuditInfo().AppliedBy, applied.AppliedBy)
+
+	t.Run("filter by version", func(t *testing.T) {
+		entries, err := db.LoadMigrationLog(ctx, MigrationLogFilter{Package: DefaultPackageName, Version: users.Version})
+		require.NoError(t, err)
+		assert.Len(t, entries, 3)
+
+		entries, err = db.LoadMigrationLog(ctx, MigrationLogFilter{Package: "other"})
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("filter by time range", func(t *testing.T) {
+		entries, err := db.LoadMigrationLog(ctx, MigrationLogFilter{Since: time.Now().Add(-time.Hour), Until: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		assert.Len(t, entries, 4)
+
+		entries, err = db.LoadMigrationLog(ctx, MigrationLogFilter{Since: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+
+		entries, err = db.LoadMigrationLog(ctx, MigrationLogFilter{Until: time.Now().Add(-time.Hour)})
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		entries, err := db.LoadMigrationLog(ctx, MigrationLogFilter{Limit: 1})
+		require.NoError(t, err)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, broken.Version, entries[0].Version)
+		}
+	})
+}
@@ -80,6 +80,32 @@ func TestInspectMigrations_DetectsOutOfOrder(t *testing.T) {
 	assert.Empty(t, status2.OutOfOrder)
 }
 
+// TestUpgrade_SkipsOutOfOrder keeps the behaviour of Upgrade before it went
+// through the planner: the out-of-order migrations stay pending.
+func TestUpgrade_SkipsOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	v1 := newTestMigration(20240101000000, "CREATE TABLE t1 (id INT)", "DROP TABLE t1")
+	v2 := newTestMigration(20240102000000, "CREATE TABLE t2 (id INT)", "DROP TABLE t2")
+	v3 := newTestMigration(20240103000000, "CREATE TABLE t3 (id INT)", "DROP TABLE t3")
+	v4 := newTestMigration(20240104000000, "CREATE TABLE t4 (id INT)", "DROP TABLE t4")
+
+	require.NoError(t, UpMigrations(ctx, db, MigrationSlice{v1, v3}))
+
+	full := MigrationSlice{v1, v2, v3, v4}.SortAndConnect()
+	require.NoError(t, Upgrade(ctx, db, full))
+
+	status, err := db.InspectMigrations(ctx, full)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20240104000000), status.HighestAppliedVersion)
+	assert.Equal(t, []int64{20240102000000}, status.Pending.Versions())
+
+	var ooErr *OutOfOrderError
+	_, err = NewPlanner(db, full).PlanUp(ctx, 0, 0)
+	assert.ErrorAs(t, err, &ooErr, "the planner refuses them without SkipOutOfOrder")
+}
+
 // TestInspectMigrations_InOrderHasNoFalsePositive ensures a normal forward sequence
 // (pending migrations all above the highest applied) is never flagged out of order.
 func TestInspectMigrations_InOrderHasNoFalsePositive(t *testing.T) {
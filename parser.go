@@ -5,7 +5,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"iter"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,10 +21,8 @@ const (
 	start                   parserState = iota // 0
 	stateUp                                    // 1
 	stateUpStatementBegin                      // 2
-	stateUpStatementEnd                        // 3
-	stateDown                                  // 4
-	stateDownStatementBegin                    // 5
-	stateDownStatementEnd                      // 6
+	stateDown                                  // 3
+	stateDownStatementBegin                    // 4
 )
 
 const scanBufSize = 4 * 1024 * 1024
@@ -50,6 +50,25 @@ func (d Direction) String() string {
 	return "unset"
 }
 
+// MarshalText encodes the direction as "up" or "down", e.g. in a plan file.
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText accepts the numeric directions of earlier files too.
+func (d *Direction) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "up", "1":
+		*d = DirectionUp
+	case "down", "-1":
+		*d = DirectionDown
+	default:
+		return fmt.Errorf("invalid direction %q, expecting up or down", b)
+	}
+
+	return nil
+}
+
 const (
 	DirectionUp   Direction = 1
 	DirectionDown Direction = -1
@@ -59,17 +78,82 @@ type Statement struct {
 	Direction Direction     `json:"direction" yaml:"direction"`
 	SQL       string        `json:"sql" yaml:"sql"`
 	Duration  time.Duration `json:"duration" yaml:"duration"`
-	Line      int           `json:"line"`
-	File      string        `json:"file"`
+
+	// Line is the line of the migration file the statement starts at, and
+	// File the path of that file. Both are zero for statements that were not
+	// parsed from a file.
+	Line int    `json:"line" yaml:"line"`
+	File string `json:"file" yaml:"file,omitempty"`
+
+	// LintIgnore lists the lint rules suppressed for this statement with a
+	// "-- +lint-ignore <rule>..." annotation right before it.
+	LintIgnore []string `json:"lintIgnore,omitempty" yaml:"lintIgnore,omitempty"`
+}
+
+// location returns "file:line" for error messages, or an empty string when the
+// statement was not parsed from a file.
+func (s *Statement) location() string {
+	if s.File == "" {
+		return ""
+	}
+
+	if s.Line == 0 {
+		return s.File
+	}
+
+	return s.File + ":" + strconv.Itoa(s.Line)
+}
+
+// describe names the i-th statement of a block in error messages, e.g.
+// "statement #3 at migrations/20240101000000_users.sql:42".
+func (s *Statement) describe(i int) string {
+	if loc := s.location(); loc != "" {
+		return fmt.Sprintf("statement #%d at %s", i+1, loc)
+	}
+
+	return fmt.Sprintf("statement #%d", i+1)
 }
 
 type MigrationScriptChunk struct {
 	UpStmts, DownStmts []Statement
 	UseTx              bool
 	Package            string
+
+	// SquashedFrom is the first version of the range a squashed migration
+	// covers, declared with "-- @squashed <from> <to>". Zero when the script
+	// is not a squash.
+	SquashedFrom int64
+
+	// LintIgnore lists the lint rules suppressed for the whole script with a
+	// "-- +lint-ignore <rule>..." annotation before "-- +up".
+	LintIgnore []string
+
+	// HasDown reports whether the script has a down block, even an empty one.
+	HasDown bool
+
+	// Irreversible marks a script that can not be rolled back, either with a
+	// "-- +irreversible" annotation or with an empty down block.
+	Irreversible bool
+
+	// Requires are the migrations declared with "-- @requires pkg:version".
+	// A version without a package has an empty Package.
+	Requires []MigrationRef
+
+	// Stream marks a script whose up statements are executed while the file
+	// is read, declared with "-- +stream" before the first statement.
+	Stream bool
+
+	// BatchSize is the number of statements sent to the database per round
+	// trip, declared with "-- +batch [size]" before the first statement. Zero
+	// when the statements run one by one.
+	BatchSize int
 }
 
 type MigrationParser struct {
+	// Dialect selects the quoting and comment syntax used to split the
+	// statements. When empty, both the MySQL and the PostgreSQL syntax are
+	// accepted.
+	Dialect string
 }
 
 func (p *MigrationParser) ParseBytes(data []byte) (*MigrationScriptChunk, error) {
@@ -83,81 +167,198 @@ func (p *MigrationParser) ParseString(data string) (*MigrationScriptChunk, error
 }
 
 func (p *MigrationParser) Parse(r io.Reader) (*MigrationScriptChunk, error) {
+	return p.parse(r, start)
+}
+
+// ParseSection parses a script without the '-- +up' / '-- +down' annotations,
+// e.g. one file of the golang-migrate two-file layout. All its statements
+// belong to the given direction.
+func (p *MigrationParser) ParseSection(r io.Reader, direction Direction) (*MigrationScriptChunk, error) {
+	if direction == DirectionDown {
+		return p.parse(r, stateDown)
+	}
+
+	return p.parse(r, stateUp)
+}
+
+func (p *MigrationParser) parse(r io.Reader, initialState parserState) (*MigrationScriptChunk, error) {
 	chunk := &MigrationScriptChunk{}
+	err := p.parseFunc(r, initialState, chunk, func(stmt Statement) error {
+		if stmt.Direction == DirectionUp {
+			chunk.UpStmts = append(chunk.UpStmts, stmt)
+		} else {
+			chunk.DownStmts = append(chunk.DownStmts, stmt)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chunk, nil
+}
+
+// errStopStream stops the parser when the consumer of Stream stops early.
+var errStopStream = errors.New("stream stopped")
+
+// Stream parses an annotated script and yields its statements of the given
+// direction while it reads r, without keeping them in memory. It yields a
+// parse error as the last element.
+func (p *MigrationParser) Stream(r io.Reader, direction Direction) iter.Seq2[Statement, error] {
+	return p.stream(r, start, direction)
+}
+
+// StreamSection is Stream for a script without the '-- +up' / '-- +down'
+// annotations, see ParseSection.
+func (p *MigrationParser) StreamSection(r io.Reader, direction Direction) iter.Seq2[Statement, error] {
+	if direction == DirectionDown {
+		return p.stream(r, stateDown, direction)
+	}
+
+	return p.stream(r, stateUp, direction)
+}
+
+func (p *MigrationParser) stream(r io.Reader, initialState parserState, direction Direction) iter.Seq2[Statement, error] {
+	return func(yield func(Statement, error) bool) {
+		err := p.parseFunc(r, initialState, &MigrationScriptChunk{}, func(stmt Statement) error {
+			if stmt.Direction != direction {
+				return nil
+			}
+
+			if !yield(stmt, nil) {
+				return errStopStream
+			}
+
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopStream) {
+			yield(Statement{}, err)
+		}
+	}
+}
 
+// parseFunc parses the script into chunk and passes each statement to emit
+// as soon as it is complete. chunk gets the annotations, not the statements.
+func (p *MigrationParser) parseFunc(r io.Reader, initialState parserState, chunk *MigrationScriptChunk, emit func(stmt Statement) error) error {
+	// buf holds the statement of a '-- +begin' / '-- +end' block, which is
+	// taken verbatim, the other statements are split by the lexer.
 	var buf bytes.Buffer
+	var bufLine int
+
+	lexer := newSQLLexer(p.Dialect)
+
 	scanBufPtr := bufPool.Get().(*[]byte)
 	defer bufPool.Put(scanBufPtr)
 
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(*scanBufPtr, scanBufSize)
 
-	var state = start
+	var state = initialState
+	chunk.HasDown = state == stateDown
+
+	// lint rules suppressed for the next statement
+	var lintIgnore []string
+
+	// the number of statements of each direction
+	var upCount, downCount int
+
+	appendStmt := func(direction Direction, sql string, line int) error {
+		stmt := Statement{
+			Direction:  direction,
+			SQL:        sql,
+			Line:       line,
+			LintIgnore: lintIgnore,
+		}
+
+		if direction == DirectionUp {
+			upCount++
+		} else {
+			downCount++
+		}
+
+		lintIgnore = nil
+		return emit(stmt)
+	}
 
 	chunk.UseTx = true
 
+	lineNo := 0
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNo++
 
-		var isEnd = false
-		if strings.HasPrefix(line, "--") {
-			cmd := strings.TrimSpace(strings.TrimPrefix(line, "--"))
+		// a line starting with "--" inside a string or a comment is SQL text
+		if strings.HasPrefix(line, "--") && lexer.inCode() {
+			cmd := annotationCommand(line)
 
-			// make it goose compatible, replace +goose Up to just +up
-			cmd = strings.ToLower(strings.ReplaceAll(cmd, "+goose ", "+"))
+			if ok, err := chunk.parseMetadata(cmd, line); err != nil {
+				return err
+			} else if ok {
+				continue
+			}
 
-			// normalize the remaining goose-style annotations to their
-			// rockhopper equivalents so goose migration files parse as-is:
-			//   -- +goose StatementBegin  -> -- +begin
-			//   -- +goose StatementEnd    -> -- +end
-			//   -- +goose NO TRANSACTION  -> -- !txn
-			switch cmd {
-			case "+statementbegin":
-				cmd = "+begin"
-			case "+statementend":
-				cmd = "+end"
-			case "+no transaction":
-				cmd = "!txn"
+			if strings.HasPrefix(cmd, "+lint-ignore") {
+				rules := parseLintIgnore(cmd)
+				if state == start {
+					chunk.LintIgnore = append(chunk.LintIgnore, rules...)
+				} else {
+					lintIgnore = append(lintIgnore, rules...)
+				}
+				continue
 			}
 
-			if strings.HasPrefix(cmd, "@package") {
-				packageName, err := matchPackageName(line)
+			if isBatchAnnotation(cmd) {
+				if upCount > 0 || downCount > 0 {
+					return errors.Errorf("failed to parse migration: line %d: '-- +batch' must come before the first statement", lineNo)
+				}
+
+				size, err := parseBatchSize(cmd)
 				if err != nil {
-					return nil, errors.Wrapf(err, "incorrect package statement: %s", line)
+					return errors.Wrapf(err, "failed to parse migration: line %d", lineNo)
 				}
 
-				chunk.Package = packageName
+				chunk.BatchSize = size
 				continue
 			}
 
 			switch cmd {
 
+			case "+up", "+down", "+begin":
+				if sql := lexer.pending(); sql != "" {
+					return errors.Errorf("failed to parse migration: line %d: unfinished SQL query before '-- %s': %q: missing semicolon?", lineNo, cmd, sql)
+				}
+			}
+
+			switch cmd {
+
 			case "+up":
 				switch state {
 				case start:
 					state = stateUp
 				default:
-					return nil, fmt.Errorf("duplicate '-- +up' annotations; state=%v, see https://github.com/c9s/goose#sql-migrations", state)
+					return fmt.Errorf("duplicate '-- +up' annotations; state=%v, see https://github.com/c9s/goose#sql-migrations", state)
 				}
 				continue
 
 			case "+down":
 				switch state {
-				case stateUp, stateUpStatementEnd:
+				case stateUp:
 					state = stateDown
+					chunk.HasDown = true
 				default:
-					return nil, fmt.Errorf("must start with '-- +up' annotation, state=%v", state)
+					return fmt.Errorf("must start with '-- +up' annotation, state=%v", state)
 				}
 				continue
 
 			case "+begin":
 				switch state {
-				case stateUp, stateUpStatementEnd:
+				case stateUp:
 					state = stateUpStatementBegin
-				case stateDown, stateDownStatementEnd:
+				case stateDown:
 					state = stateDownStatementBegin
 				default:
-					return nil, fmt.Errorf("'-- +begin' must be defined after '-- +up' or '-- +down' annotation, state=%v, see https://github.com/c9s/goose#sql-migrations", state)
+					return fmt.Errorf("'-- +begin' must be defined after '-- +up' or '-- +down' annotation, state=%v, see https://github.com/c9s/goose#sql-migrations", state)
 				}
 
 				continue
@@ -165,114 +366,251 @@ func (p *MigrationParser) Parse(r io.Reader) (*MigrationScriptChunk, error) {
 			case "+end":
 				switch state {
 				case stateUpStatementBegin:
-					state = stateUpStatementEnd
+					if err := appendStmt(DirectionUp, strings.TrimSpace(buf.String()), bufLine); err != nil {
+						return err
+					}
+					state = stateUp
 				case stateDownStatementBegin:
-					state = stateDownStatementEnd
+					if err := appendStmt(DirectionDown, strings.TrimSpace(buf.String()), bufLine); err != nil {
+						return err
+					}
+					state = stateDown
 				default:
-					return nil, errors.New("'-- +end' must be defined after '-- +begin', see https://github.com/c9s/goose#sql-migrations")
+					return errors.New("'-- +end' must be defined after '-- +begin', see https://github.com/c9s/goose#sql-migrations")
 				}
 
-				isEnd = true
+				buf.Reset()
+				bufLine = 0
+				continue
 
 			case "!txn":
 				chunk.UseTx = false
 				continue
 
+			case "+irreversible":
+				chunk.Irreversible = true
+				continue
+
+			case "+stream":
+				if upCount > 0 || downCount > 0 {
+					return errors.Errorf("failed to parse migration: line %d: '-- +stream' must come before the first statement", lineNo)
+				}
+
+				chunk.Stream = true
+				continue
+
 			default:
 				// Ignore comments.
 				continue
 			}
 		}
 
-		// Ignore empty lines.
-		if matchEmptyLines.MatchString(line) {
+		// Ignore empty lines, unless they are part of a string.
+		if matchEmptyLines.MatchString(line) && lexer.inCode() {
 			continue
 		}
 
-		// Write SQL line to a buffer.
-		if !isEnd {
-			if _, err := buf.WriteString(line + "\n"); err != nil {
-				return nil, errors.Wrap(err, "failed to write to buf")
+		switch state {
+		case start:
+			return errors.Errorf("failed to parse migration: line %d: SQL found before the '-- +up' annotation, see https://github.com/c9s/goose#sql-migrations", lineNo)
+
+		case stateUp, stateDown:
+			direction := DirectionUp
+			if state == stateDown {
+				direction = DirectionDown
 			}
-		}
 
-		switch state {
-		case stateUp:
-			if p.endsWithSemicolon(line) {
-				chunk.UpStmts = append(chunk.UpStmts, Statement{
-					Direction: DirectionUp,
-					SQL:       strings.TrimSpace(buf.String()),
-				})
-				buf.Reset()
+			for _, stmt := range lexer.feed(line, lineNo) {
+				if err := appendStmt(direction, stmt.SQL, stmt.Line); err != nil {
+					return err
+				}
 			}
 
-		case stateDown:
-			if p.endsWithSemicolon(line) {
-				chunk.DownStmts = append(chunk.DownStmts, Statement{
-					Direction: DirectionDown,
-					SQL:       strings.TrimSpace(buf.String()),
-				})
-				buf.Reset()
+		case stateUpStatementBegin, stateDownStatementBegin:
+			if bufLine == 0 {
+				bufLine = lineNo
 			}
 
-		case stateUpStatementEnd:
-			chunk.UpStmts = append(chunk.UpStmts, Statement{
-				Direction: DirectionUp,
-				SQL:       strings.TrimSpace(buf.String()),
-			})
-			buf.Reset()
-			state = stateUp
-
-		case stateDownStatementEnd:
-			chunk.DownStmts = append(chunk.DownStmts, Statement{
-				Direction: DirectionDown,
-				SQL:       strings.TrimSpace(buf.String()),
-			})
-			buf.Reset()
-			state = stateDown
+			if _, err := buf.WriteString(line + "\n"); err != nil {
+				return errors.Wrap(err, "failed to write to buf")
+			}
 		}
 	} // end of for
 
 	if err := scanner.Err(); err != nil {
-		return nil, errors.Wrap(err, "failed to scan migration")
+		return errors.Wrap(err, "failed to scan migration")
 	}
 	// EOF
 
 	switch state {
 	case start:
-		return nil, errors.New("failed to parse migration: must start with '-- +up' annotation, see https://github.com/c9s/goose#sql-migrations")
+		return errors.New("failed to parse migration: must start with '-- +up' annotation, see https://github.com/c9s/goose#sql-migrations")
 
 	case stateUpStatementBegin, stateDownStatementBegin:
-		return nil, errors.New("failed to parse migration: missing '-- +end' annotation")
+		return errors.New("failed to parse migration: missing '-- +end' annotation")
 	}
 
-	if bufferRemaining := strings.TrimSpace(buf.String()); len(bufferRemaining) > 0 {
-		return nil, errors.Errorf("failed to parse migration: state %q, unexpected unfinished SQL query: %q: missing semicolon?", state, bufferRemaining)
+	if sql := lexer.pending(); sql != "" {
+		return errors.Errorf("failed to parse migration: state %q, unexpected unfinished SQL query: %q: missing semicolon?", state, sql)
 	}
 
-	return chunk, nil
+	if !lexer.inCode() {
+		return errors.Errorf("failed to parse migration: unterminated quote or comment in SQL query: %q", lexer.buf.String())
+	}
+
+	if chunk.Irreversible && downCount > 0 {
+		return errors.New("failed to parse migration: a '-- +irreversible' migration can not have down statements")
+	}
+
+	if chunk.HasDown && downCount == 0 {
+		chunk.Irreversible = true
+	}
+
+	return nil
 }
 
-// Checks the line to see if the line has a statement-ending semicolon
-// or if the line contains a double-dash comment.
-func (p *MigrationParser) endsWithSemicolon(line string) bool {
-	scanBufPtr := bufPool.Get().(*[]byte)
-	defer bufPool.Put(scanBufPtr)
+// annotationCommand returns the normalized annotation of a comment line.
+func annotationCommand(line string) string {
+	cmd := strings.TrimSpace(strings.TrimPrefix(line, "--"))
+
+	// make it goose compatible, replace +goose Up to just +up
+	cmd = strings.ToLower(strings.ReplaceAll(cmd, "+goose ", "+"))
+
+	// normalize the remaining goose-style annotations to their
+	// rockhopper equivalents so goose migration files parse as-is:
+	//   -- +goose StatementBegin  -> -- +begin
+	//   -- +goose StatementEnd    -> -- +end
+	//   -- +goose NO TRANSACTION  -> -- !txn
+	switch cmd {
+	case "+statementbegin":
+		cmd = "+begin"
+	case "+statementend":
+		cmd = "+end"
+	case "+no transaction":
+		cmd = "!txn"
+	}
 
-	prev := ""
-	scanner := bufio.NewScanner(strings.NewReader(line))
-	scanner.Buffer(*scanBufPtr, scanBufSize)
-	scanner.Split(bufio.ScanWords)
+	return cmd
+}
+
+// parseMetadata parses the '-- @package', '-- @squashed' and '-- @requires'
+// annotations, it reports whether cmd is one of them.
+func (chunk *MigrationScriptChunk) parseMetadata(cmd, line string) (bool, error) {
+	switch {
+	case strings.HasPrefix(cmd, "@package"):
+		packageName, err := matchPackageName(line)
+		if err != nil {
+			return true, errors.Wrapf(err, "incorrect package statement: %s", line)
+		}
+
+		chunk.Package = packageName
+
+	case strings.HasPrefix(cmd, "@squashed"):
+		from, err := matchSquashedRange(line)
+		if err != nil {
+			return true, errors.Wrapf(err, "incorrect squashed statement: %s", line)
+		}
+
+		chunk.SquashedFrom = from
+
+	case strings.HasPrefix(cmd, "@requires"):
+		refs, err := matchRequires(strings.TrimSpace(strings.TrimPrefix(line, "--")))
+		if err != nil {
+			return true, errors.Wrapf(err, "incorrect requires statement: %s", line)
+		}
+
+		chunk.Requires = append(chunk.Requires, refs...)
+
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// ParseHeader reads the annotations of a script without keeping its
+// statements: '-- @package', '-- @squashed', '-- @requires', '-- !txn',
+// '-- +irreversible', '-- +stream' and '-- +batch'. It stops at the first
+// SQL line, so that scanning a large tree reads only the head of every
+// script; the annotations after it are read when the script is parsed.
+func (p *MigrationParser) ParseHeader(r io.Reader) (*MigrationScriptChunk, error) {
+	chunk := &MigrationScriptChunk{UseTx: true}
+
+	// the header is short, the buffer grows for a long line only
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, scanBufSize)
 
 	for scanner.Scan() {
-		word := scanner.Text()
-		if strings.HasPrefix(word, "--") {
+		line := scanner.Text()
+
+		if !strings.HasPrefix(line, "--") {
+			if matchEmptyLines.MatchString(line) {
+				continue
+			}
+
 			break
 		}
-		prev = word
+
+		cmd := annotationCommand(line)
+		if _, err := chunk.parseMetadata(cmd, line); err != nil {
+			return nil, err
+		}
+
+		switch cmd {
+		case "!txn":
+			chunk.UseTx = false
+		case "+irreversible":
+			chunk.Irreversible = true
+		case "+stream":
+			chunk.Stream = true
+		}
+
+		if isBatchAnnotation(cmd) {
+			size, err := parseBatchSize(cmd)
+			if err != nil {
+				return nil, errors.Wrapf(err, "incorrect batch statement: %s", line)
+			}
+
+			chunk.BatchSize = size
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read migration header")
 	}
 
-	return strings.HasSuffix(prev, ";")
+	return chunk, nil
+}
+
+// parseLintIgnore returns the rule names of a "+lint-ignore" annotation. The
+// names may be separated by spaces or commas.
+func parseLintIgnore(cmd string) []string {
+	return strings.FieldsFunc(strings.TrimPrefix(cmd, "+lint-ignore"), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// defaultBatchSize is the batch size of a '-- +batch' annotation without a
+// size.
+const defaultBatchSize = 100
+
+func isBatchAnnotation(cmd string) bool {
+	return cmd == "+batch" || strings.HasPrefix(cmd, "+batch ")
+}
+
+// parseBatchSize returns the size of a "+batch [size]" annotation.
+func parseBatchSize(cmd string) (int, error) {
+	arg := strings.TrimSpace(strings.TrimPrefix(cmd, "+batch"))
+	if arg == "" {
+		return defaultBatchSize, nil
+	}
+
+	size, err := strconv.Atoi(arg)
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("invalid batch size %q, expecting a positive number", arg)
+	}
+
+	return size, nil
 }
 
 var packageNameRegExp = regexp.MustCompile(`@package\s+(\S+)`)
@@ -285,3 +623,16 @@ func matchPackageName(line string) (string, error) {
 
 	return matches[1], nil
 }
+
+var squashedRangeRegExp = regexp.MustCompile(`@squashed\s+(\d+)\s+(\d+)`)
+
+// matchSquashedRange parses the first version of a "-- @squashed <from> <to>"
+// annotation. The last version is the version of the squashed migration itself.
+func matchSquashedRange(line string) (int64, error) {
+	matches := squashedRangeRegExp.FindStringSubmatch(line)
+	if len(matches) < 3 {
+		return 0, errors.New("squashed version range not found")
+	}
+
+	return strconv.ParseInt(matches[1], 10, 64)
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
 )
 
@@ -242,6 +243,28 @@ func TestMigrationParser_RawDumpWithoutUp(t *testing.T) {
 	}
 }
 
+func TestMigrationParser_Irreversible(t *testing.T) {
+	p := &MigrationParser{}
+
+	chunk, err := p.ParseString("-- +irreversible\n-- +up\nDROP TABLE a;\n")
+	require.NoError(t, err)
+	assert.True(t, chunk.Irreversible)
+	assert.False(t, chunk.HasDown)
+
+	chunk, err = p.ParseString("-- +up\nDROP TABLE a;\n-- +down\n")
+	require.NoError(t, err)
+	assert.True(t, chunk.Irreversible, "an empty down block marks the migration irreversible")
+	assert.True(t, chunk.HasDown)
+
+	chunk, err = p.ParseString("-- +up\nDROP TABLE a;\n")
+	require.NoError(t, err)
+	assert.False(t, chunk.Irreversible, "a missing down block is not a mark")
+	assert.False(t, chunk.HasDown)
+
+	_, err = p.ParseString("-- +irreversible\n-- +up\nCREATE TABLE a (id INT);\n-- +down\nDROP TABLE a;\n")
+	assert.Error(t, err)
+}
+
 func Test_matchPackageName(t *testing.T) {
 	t.Run("simple", func(t *testing.T) {
 		pkgName, err := matchPackageName("@package main")
@@ -31,8 +31,16 @@ type Order struct {
 	Desc bool
 }
 
+// Cond is a comparison term "<Col> <Op> <placeholder>", e.g. {"tstamp", ">=", t}.
+type Cond struct {
+	Col string
+	Op  string
+	Val any
+}
+
 // SelectOpt carries the optional clauses of a Select.
 type SelectOpt struct {
+	Conds   []Cond // ANDed after the equality keys
 	OrderBy []Order
 	Limit   int // 0 means no LIMIT
 }
@@ -118,13 +126,23 @@ func (c CRUD) Select(table string, cols []string, keys []Col, opt SelectOpt) (st
 	var b strings.Builder
 	fmt.Fprintf(&b, "SELECT %s FROM %s", strings.Join(cols, ", "), table)
 
+	var conds []string
 	var args []any
 	if len(keys) > 0 {
 		where, wargs := c.eqClauses(keys, 0, " AND ")
-		fmt.Fprintf(&b, " WHERE %s", where)
+		conds = append(conds, where)
 		args = wargs
 	}
 
+	for _, cond := range opt.Conds {
+		conds = append(conds, fmt.Sprintf("%s %s %s", cond.Col, cond.Op, c.t.Placeholder(len(args)+1)))
+		args = append(args, cond.Val)
+	}
+
+	if len(conds) > 0 {
+		fmt.Fprintf(&b, " WHERE %s", strings.Join(conds, " AND "))
+	}
+
 	if len(opt.OrderBy) > 0 {
 		terms := make([]string, len(opt.OrderBy))
 		for i, o := range opt.OrderBy {
@@ -72,6 +72,23 @@ func TestCRUD_SelectOrderLimit(t *testing.T) {
 	}
 }
 
+func TestCRUD_SelectConds(t *testing.T) {
+	for _, c := range builders() {
+		t.Run(c.name, func(t *testing.T) {
+			sql, args := c.b.Select("t",
+				[]string{"id"},
+				[]Col{{"package", "p"}},
+				SelectOpt{Conds: []Cond{{Col: "tstamp", Op: ">=", Val: 1}, {Col: "tstamp", Op: "<", Val: 2}}})
+			if c.name == "mysql" {
+				assert.Equal(t, "SELECT id FROM t WHERE package = ? AND tstamp >= ? AND tstamp < ?", sql)
+			} else {
+				assert.Equal(t, "SELECT id FROM t WHERE package = $1 AND tstamp >= $2 AND tstamp < $3", sql)
+			}
+			assert.Equal(t, []any{"p", 1, 2}, args)
+		})
+	}
+}
+
 func TestCRUD_SelectAggregateNoKeys(t *testing.T) {
 	for _, c := range builders() {
 		t.Run(c.name, func(t *testing.T) {
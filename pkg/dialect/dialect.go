@@ -14,6 +14,6 @@ type Dialect interface {
 	TableNames() string
 
 	// AddColumn renders an ALTER TABLE ... ADD COLUMN statement. supported is
-	// false for dialects where rockhopper intentionally skips the alter (SQLite).
+	// false for dialects that can not add a column.
 	AddColumn(table string, c Column) (sql string, supported bool)
 }
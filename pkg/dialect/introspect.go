@@ -0,0 +1,379 @@
+package dialect
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TableDef is the introspected shape of an existing table. Unlike Schema, the
+// column types are the physical spellings reported by the database catalog.
+type TableDef struct {
+	Name        string
+	Columns     []ColumnDef
+	Indexes     []IndexDef
+	ForeignKeys []ForeignKeyDef
+}
+
+// ColumnDef is one introspected column.
+type ColumnDef struct {
+	Name    string
+	Type    string
+	NotNull bool
+
+	// Default is the default expression as the catalog reports it; HasDefault
+	// tells an empty default apart from no default.
+	Default    string
+	HasDefault bool
+
+	// PrimaryKey is the 1-based position of the column in the primary key, or 0.
+	PrimaryKey int
+}
+
+// IndexDef is one secondary index. Primary keys and indexes that back a
+// constraint are not reported as indexes.
+type IndexDef struct {
+	Name    string
+	Unique  bool
+	Columns []string
+}
+
+// ForeignKeyDef is one foreign key constraint.
+type ForeignKeyDef struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+// Introspector is the optional catalog introspection capability used by the
+// schema diff. Each query takes the table name as its only bind argument. The
+// OLTP dialects implement it (TiDB and Redshift inherit the MySQL and PostgreSQL
+// queries); callers detect the absence via a type assertion.
+type Introspector interface {
+	// ColumnsQuery lists the columns of a table in ordinal order. Rows are
+	// (name, type, not null, default or NULL, primary key position or 0).
+	ColumnsQuery() string
+
+	// IndexesQuery lists the secondary indexes of a table. Rows are (index name,
+	// unique, column name), ordered by index name and column position.
+	IndexesQuery() string
+
+	// ForeignKeysQuery lists the foreign keys of a table. Rows are (constraint
+	// name, column name, referenced table, referenced column), ordered by
+	// constraint name and column position.
+	ForeignKeysQuery() string
+}
+
+// SchemaAlterer renders the DDL the schema diff emits. Statements are returned
+// without the trailing semicolon. supported is false for changes the database
+// can not apply in place (e.g. altering a column on SQLite).
+type SchemaAlterer interface {
+	CreateTableDef(t TableDef) string
+	DropTable(table string) string
+	AddColumnDef(table string, c ColumnDef) string
+	DropColumn(table, column string) string
+	AlterColumn(table string, from, to ColumnDef) (stmts []string, supported bool)
+	CreateIndex(table string, idx IndexDef) string
+	DropIndex(table, index string) string
+	AddForeignKey(table string, fk ForeignKeyDef) (sql string, supported bool)
+	DropForeignKey(table string, fk ForeignKeyDef) (sql string, supported bool)
+}
+
+// defRenderer captures the per-dialect choices of the generic TableDef
+// renderers below.
+type defRenderer interface {
+	// columnType returns the type to declare a column with.
+	columnType(c ColumnDef) string
+	// hasDefault reports whether the column default is rendered; PostgreSQL
+	// folds its sequence default into the serial type.
+	hasDefault(c ColumnDef) bool
+	// namedForeignKeys reports whether foreign keys are rendered with their
+	// constraint names (SQLite only numbers them).
+	namedForeignKeys() bool
+}
+
+func columnDefSQL(r defRenderer, c ColumnDef) string {
+	def := c.Name + " " + r.columnType(c)
+	if c.NotNull {
+		def += " NOT NULL"
+	}
+	if r.hasDefault(c) {
+		def += " DEFAULT " + c.Default
+	}
+	return def
+}
+
+func foreignKeySQL(r defRenderer, fk ForeignKeyDef) string {
+	def := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)",
+		strings.Join(fk.Columns, ", "), fk.RefTable, strings.Join(fk.RefColumns, ", "))
+	if r.namedForeignKeys() && fk.Name != "" {
+		def = "CONSTRAINT " + fk.Name + " " + def
+	}
+	return def
+}
+
+func buildCreateTableDef(r defRenderer, t TableDef) string {
+	lines := make([]string, 0, len(t.Columns)+len(t.ForeignKeys)+1)
+
+	var pkCols []ColumnDef
+	for _, c := range t.Columns {
+		lines = append(lines, "    "+columnDefSQL(r, c))
+		if c.PrimaryKey > 0 {
+			pkCols = append(pkCols, c)
+		}
+	}
+
+	if len(pkCols) > 0 {
+		sort.Slice(pkCols, func(i, j int) bool { return pkCols[i].PrimaryKey < pkCols[j].PrimaryKey })
+
+		names := make([]string, len(pkCols))
+		for i, c := range pkCols {
+			names[i] = c.Name
+		}
+		lines = append(lines, fmt.Sprintf("    PRIMARY KEY(%s)", strings.Join(names, ", ")))
+	}
+
+	for _, fk := range t.ForeignKeys {
+		lines = append(lines, "    "+foreignKeySQL(r, fk))
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n)", t.Name, strings.Join(lines, ",\n"))
+}
+
+func buildCreateIndex(table string, idx IndexDef) string {
+	unique := ""
+	if idx.Unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, idx.Name, table, strings.Join(idx.Columns, ", "))
+}
+
+// SQLite
+
+func (d *Sqlite3Dialect) ColumnsQuery() string {
+	return `SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`
+}
+
+// IndexesQuery only reports indexes created with CREATE INDEX (origin 'c'), the
+// automatic ones backing PRIMARY KEY and UNIQUE constraints are part of the
+// table definition.
+func (d *Sqlite3Dialect) IndexesQuery() string {
+	return `SELECT il.name, il."unique", ii.name FROM pragma_index_list(?) AS il` +
+		` JOIN pragma_index_info(il.name) AS ii WHERE il.origin = 'c' ORDER BY il.name, ii.seqno`
+}
+
+func (d *Sqlite3Dialect) ForeignKeysQuery() string {
+	return `SELECT id, "from", "table", "to" FROM pragma_foreign_key_list(?) ORDER BY id, seq`
+}
+
+func (d *Sqlite3Dialect) CreateTableDef(t TableDef) string {
+	return buildCreateTableDef(sqliteDDL{}, t)
+}
+
+func (d *Sqlite3Dialect) DropTable(table string) string { return "DROP TABLE " + table }
+
+func (d *Sqlite3Dialect) AddColumnDef(table string, c ColumnDef) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, columnDefSQL(sqliteDDL{}, c))
+}
+
+func (d *Sqlite3Dialect) DropColumn(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
+}
+
+// AlterColumn, AddForeignKey and DropForeignKey are unsupported: SQLite can only
+// change them by rebuilding the table.
+func (d *Sqlite3Dialect) AlterColumn(string, ColumnDef, ColumnDef) ([]string, bool) {
+	return nil, false
+}
+
+func (d *Sqlite3Dialect) CreateIndex(table string, idx IndexDef) string {
+	return buildCreateIndex(table, idx)
+}
+
+func (d *Sqlite3Dialect) DropIndex(_, index string) string { return "DROP INDEX " + index }
+
+func (d *Sqlite3Dialect) AddForeignKey(string, ForeignKeyDef) (string, bool)  { return "", false }
+func (d *Sqlite3Dialect) DropForeignKey(string, ForeignKeyDef) (string, bool) { return "", false }
+
+func (sqliteDDL) columnType(c ColumnDef) string { return c.Type }
+func (sqliteDDL) hasDefault(c ColumnDef) bool   { return c.HasDefault }
+func (sqliteDDL) namedForeignKeys() bool        { return false }
+
+// MySQL
+
+// ColumnsQuery quotes string defaults with QUOTE(), information_schema reports
+// them unquoted.
+func (d *MySQLDialect) ColumnsQuery() string {
+	return "SELECT c.column_name, c.column_type, c.is_nullable = 'NO',\n" +
+		"\t\tCASE WHEN c.column_default IS NULL OR c.data_type NOT IN ('char', 'varchar', 'text', 'tinytext', 'mediumtext', 'longtext', 'enum', 'set')\n" +
+		"\t\t\tTHEN c.column_default ELSE QUOTE(c.column_default) END,\n" +
+		"\t\tCOALESCE((SELECT k.ordinal_position FROM information_schema.key_column_usage k\n" +
+		"\t\t\tWHERE k.table_schema = c.table_schema AND k.table_name = c.table_name\n" +
+		"\t\t\tAND k.column_name = c.column_name AND k.constraint_name = 'PRIMARY'), 0)\n" +
+		"\t\tFROM information_schema.columns c\n" +
+		"\t\tWHERE c.table_schema = DATABASE() AND c.table_name = ? ORDER BY c.ordinal_position"
+}
+
+func (d *MySQLDialect) IndexesQuery() string {
+	return "SELECT index_name, non_unique = 0, column_name FROM information_schema.statistics\n" +
+		"\t\tWHERE table_schema = DATABASE() AND table_name = ? AND index_name <> 'PRIMARY'\n" +
+		"\t\tORDER BY index_name, seq_in_index"
+}
+
+func (d *MySQLDialect) ForeignKeysQuery() string {
+	return "SELECT constraint_name, column_name, referenced_table_name, referenced_column_name\n" +
+		"\t\tFROM information_schema.key_column_usage\n" +
+		"\t\tWHERE table_schema = DATABASE() AND table_name = ? AND referenced_table_name IS NOT NULL\n" +
+		"\t\tORDER BY constraint_name, ordinal_position"
+}
+
+func (d *MySQLDialect) CreateTableDef(t TableDef) string { return buildCreateTableDef(mysqlDDL{}, t) }
+func (d *MySQLDialect) DropTable(table string) string    { return "DROP TABLE " + table }
+
+func (d *MySQLDialect) AddColumnDef(table string, c ColumnDef) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, columnDefSQL(mysqlDDL{}, c))
+}
+
+func (d *MySQLDialect) DropColumn(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
+}
+
+func (d *MySQLDialect) AlterColumn(table string, _, to ColumnDef) ([]string, bool) {
+	return []string{fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", table, columnDefSQL(mysqlDDL{}, to))}, true
+}
+
+func (d *MySQLDialect) CreateIndex(table string, idx IndexDef) string {
+	return buildCreateIndex(table, idx)
+}
+
+func (d *MySQLDialect) DropIndex(table, index string) string {
+	return fmt.Sprintf("DROP INDEX %s ON %s", index, table)
+}
+
+func (d *MySQLDialect) AddForeignKey(table string, fk ForeignKeyDef) (string, bool) {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s", table, foreignKeySQL(mysqlDDL{}, fk)), true
+}
+
+func (d *MySQLDialect) DropForeignKey(table string, fk ForeignKeyDef) (string, bool) {
+	return fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", table, fk.Name), true
+}
+
+func (mysqlDDL) columnType(c ColumnDef) string { return c.Type }
+func (mysqlDDL) hasDefault(c ColumnDef) bool   { return c.HasDefault }
+func (mysqlDDL) namedForeignKeys() bool        { return true }
+
+// PostgreSQL
+
+func (d *PostgresDialect) ColumnsQuery() string {
+	return "SELECT a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,\n" +
+		"\t\tpg_get_expr(ad.adbin, ad.adrelid), COALESCE(array_position(pk.conkey, a.attnum), 0)\n" +
+		"\t\tFROM pg_attribute a\n" +
+		"\t\tJOIN pg_class t ON t.oid = a.attrelid\n" +
+		"\t\tJOIN pg_namespace n ON n.oid = t.relnamespace\n" +
+		"\t\tLEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum\n" +
+		"\t\tLEFT JOIN pg_constraint pk ON pk.conrelid = t.oid AND pk.contype = 'p'\n" +
+		"\t\tWHERE n.nspname = current_schema() AND t.relname = $1 AND a.attnum > 0 AND NOT a.attisdropped\n" +
+		"\t\tORDER BY a.attnum"
+}
+
+func (d *PostgresDialect) IndexesQuery() string {
+	return "SELECT i.relname, ix.indisunique, a.attname\n" +
+		"\t\tFROM pg_index ix\n" +
+		"\t\tJOIN pg_class t ON t.oid = ix.indrelid\n" +
+		"\t\tJOIN pg_namespace n ON n.oid = t.relnamespace\n" +
+		"\t\tJOIN pg_class i ON i.oid = ix.indexrelid\n" +
+		"\t\tJOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY(ix.indkey)\n" +
+		"\t\tWHERE n.nspname = current_schema() AND t.relname = $1 AND NOT ix.indisprimary\n" +
+		"\t\tAND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = ix.indexrelid)\n" +
+		"\t\tORDER BY i.relname, array_position(ix.indkey::int2[], a.attnum)"
+}
+
+func (d *PostgresDialect) ForeignKeysQuery() string {
+	return "SELECT c.conname, a.attname, rt.relname, ra.attname\n" +
+		"\t\tFROM pg_constraint c\n" +
+		"\t\tJOIN pg_class t ON t.oid = c.conrelid\n" +
+		"\t\tJOIN pg_namespace n ON n.oid = t.relnamespace\n" +
+		"\t\tJOIN pg_class rt ON rt.oid = c.confrelid\n" +
+		"\t\tCROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, refattnum, pos)\n" +
+		"\t\tJOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum\n" +
+		"\t\tJOIN pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = k.refattnum\n" +
+		"\t\tWHERE c.contype = 'f' AND n.nspname = current_schema() AND t.relname = $1\n" +
+		"\t\tORDER BY c.conname, k.pos"
+}
+
+func (d *PostgresDialect) CreateTableDef(t TableDef) string { return buildCreateTableDef(pgDDL{}, t) }
+func (d *PostgresDialect) DropTable(table string) string    { return "DROP TABLE " + table }
+
+func (d *PostgresDialect) AddColumnDef(table string, c ColumnDef) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, columnDefSQL(pgDDL{}, c))
+}
+
+func (d *PostgresDialect) DropColumn(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
+}
+
+func (d *PostgresDialect) AlterColumn(table string, from, to ColumnDef) ([]string, bool) {
+	prefix := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ", table, to.Name)
+
+	var stmts []string
+	if !strings.EqualFold(from.Type, to.Type) {
+		stmts = append(stmts, prefix+"TYPE "+to.Type)
+	}
+
+	if from.NotNull != to.NotNull {
+		if to.NotNull {
+			stmts = append(stmts, prefix+"SET NOT NULL")
+		} else {
+			stmts = append(stmts, prefix+"DROP NOT NULL")
+		}
+	}
+
+	if from.HasDefault != to.HasDefault || from.Default != to.Default {
+		if to.HasDefault {
+			stmts = append(stmts, prefix+"SET DEFAULT "+to.Default)
+		} else {
+			stmts = append(stmts, prefix+"DROP DEFAULT")
+		}
+	}
+
+	return stmts, true
+}
+
+func (d *PostgresDialect) CreateIndex(table string, idx IndexDef) string {
+	return buildCreateIndex(table, idx)
+}
+
+func (d *PostgresDialect) DropIndex(_, index string) string { return "DROP INDEX " + index }
+
+func (d *PostgresDialect) AddForeignKey(table string, fk ForeignKeyDef) (string, bool) {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s", table, foreignKeySQL(pgDDL{}, fk)), true
+}
+
+func (d *PostgresDialect) DropForeignKey(table string, fk ForeignKeyDef) (string, bool) {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, fk.Name), true
+}
+
+// columnType folds a sequence default back into serial/bigserial, so that a
+// re-created table owns a new sequence instead of referencing a dropped one.
+func (pgDDL) columnType(c ColumnDef) string {
+	if isPgSequenceDefault(c) {
+		switch c.Type {
+		case "integer":
+			return "serial"
+		case "bigint":
+			return "bigserial"
+		}
+	}
+	return c.Type
+}
+
+func (pgDDL) hasDefault(c ColumnDef) bool {
+	return c.HasDefault && !(isPgSequenceDefault(c) && (c.Type == "integer" || c.Type == "bigint"))
+}
+
+func (pgDDL) namedForeignKeys() bool { return true }
+
+func isPgSequenceDefault(c ColumnDef) bool {
+	return c.HasDefault && strings.HasPrefix(c.Default, "nextval(")
+}
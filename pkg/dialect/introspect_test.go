@@ -0,0 +1,59 @@
+package dialect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaAlterer_DropIndex(t *testing.T) {
+	assert.Equal(t, "DROP INDEX idx_a ON t", NewMySQLDialect().DropIndex("t", "idx_a"))
+	assert.Equal(t, "DROP INDEX idx_a", NewPostgresDialect().DropIndex("t", "idx_a"))
+	assert.Equal(t, "DROP INDEX idx_a", NewSqlite3Dialect().DropIndex("t", "idx_a"))
+
+	sql, ok := NewSqlite3Dialect().AddColumn("t", Column{Name: "c", Type: ColBigInt, NotNull: true, Default: "0"})
+	assert.True(t, ok)
+	assert.Equal(t, "ALTER TABLE t ADD COLUMN c INTEGER NOT NULL DEFAULT 0", sql)
+}
+
+func TestSchemaAlterer_AlterColumn(t *testing.T) {
+	from := ColumnDef{Name: "name", Type: "varchar(64)"}
+	to := ColumnDef{Name: "name", Type: "text", NotNull: true, Default: "''", HasDefault: true}
+
+	stmts, supported := NewMySQLDialect().AlterColumn("t", from, to)
+	assert.True(t, supported)
+	assert.Equal(t, []string{"ALTER TABLE t MODIFY COLUMN name text NOT NULL DEFAULT ''"}, stmts)
+
+	stmts, supported = NewPostgresDialect().AlterColumn("t", from, to)
+	assert.True(t, supported)
+	assert.Equal(t, []string{
+		"ALTER TABLE t ALTER COLUMN name TYPE text",
+		"ALTER TABLE t ALTER COLUMN name SET NOT NULL",
+		"ALTER TABLE t ALTER COLUMN name SET DEFAULT ''",
+	}, stmts)
+
+	_, supported = NewSqlite3Dialect().AlterColumn("t", from, to)
+	assert.False(t, supported)
+}
+
+// TestPostgres_CreateTableDefSerial guards that a sequence default is rendered
+// as serial, so a re-created table does not reference a dropped sequence.
+func TestPostgres_CreateTableDefSerial(t *testing.T) {
+	ddl := NewPostgresDialect().CreateTableDef(TableDef{
+		Name: "users",
+		Columns: []ColumnDef{
+			{Name: "id", Type: "integer", NotNull: true, Default: "nextval('users_id_seq'::regclass)", HasDefault: true, PrimaryKey: 1},
+			{Name: "team_id", Type: "bigint"},
+		},
+		ForeignKeys: []ForeignKeyDef{
+			{Name: "users_team_fk", Columns: []string{"team_id"}, RefTable: "teams", RefColumns: []string{"id"}},
+		},
+	})
+
+	assert.Equal(t, "CREATE TABLE users (\n"+
+		"    id serial NOT NULL,\n"+
+		"    team_id bigint,\n"+
+		"    PRIMARY KEY(id),\n"+
+		"    CONSTRAINT users_team_fk FOREIGN KEY (team_id) REFERENCES teams (id)\n"+
+		")", ddl)
+}
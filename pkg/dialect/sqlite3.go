@@ -23,9 +23,9 @@ func (d *Sqlite3Dialect) TableNames() string {
 
 func (d *Sqlite3Dialect) CreateTable(s Schema) string { return buildCreateTable(sqliteDDL{}, s) }
 
-// AddColumn is intentionally unsupported for SQLite: the legacy-table migration
-// skips the ALTER on SQLite.
-func (d *Sqlite3Dialect) AddColumn(string, Column) (string, bool) { return "", false }
+func (d *Sqlite3Dialect) AddColumn(table string, c Column) (string, bool) {
+	return buildAddColumn(sqliteDDL{}, table, c), true
+}
 
 // sqliteDDL renders SQLite DDL types.
 type sqliteDDL struct{}
@@ -14,3 +14,27 @@ package driver
 // and scanning fails. It is registered by mysql.go's init and stays nil when
 // the MySQL driver is excluded from the build (the no_mysql build tag).
 var NormalizeMySQLDSN func(dsn string) (string, error)
+
+// EnableMySQLMultiStatements, when set, rewrites a MySQL DSN so that
+// multiStatements=true is enabled, for the dedicated connection that sends
+// batches of statements in one round trip. It is registered by mysql.go's init
+// and stays nil when the MySQL driver is excluded from the build.
+var EnableMySQLMultiStatements func(dsn string) (string, error)
+
+// PostgresErrorPosition, when set, returns the 1-based character position of
+// a PostgreSQL error in the query that caused it. It is registered by
+// pgsql.go's init and stays nil when the PostgreSQL driver is excluded from
+// the build.
+var PostgresErrorPosition func(err error) (int, bool)
+
+// PermanentMySQLError, when set, reports whether a MySQL connection error can
+// not be fixed by retrying, like bad credentials or an unknown database. It is
+// registered by mysql.go's init and stays nil when the MySQL driver is
+// excluded from the build.
+var PermanentMySQLError func(err error) bool
+
+// PermanentPostgresError, when set, reports whether a PostgreSQL connection
+// error can not be fixed by retrying, like bad credentials or an unknown
+// database. It is registered by pgsql.go's init and stays nil when the
+// PostgreSQL driver is excluded from the build.
+var PermanentPostgresError func(err error) bool
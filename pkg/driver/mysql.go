@@ -3,6 +3,8 @@
 package driver
 
 import (
+	"errors"
+
 	"github.com/go-sql-driver/mysql"
 	log "github.com/sirupsen/logrus"
 )
@@ -24,4 +26,32 @@ func init() {
 
 		return cfg.FormatDSN(), nil
 	}
+
+	EnableMySQLMultiStatements = func(dsn string) (string, error) {
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return dsn, err
+		}
+
+		cfg.MultiStatements = true
+		return cfg.FormatDSN(), nil
+	}
+
+	PermanentMySQLError = func(err error) bool {
+		var mysqlErr *mysql.MySQLError
+		if !errors.As(err, &mysqlErr) {
+			return false
+		}
+
+		switch mysqlErr.Number {
+		case 1044, // ER_DBACCESS_DENIED_ERROR
+			1045, // ER_ACCESS_DENIED_ERROR
+			1049, // ER_BAD_DB_ERROR
+			1251, // ER_NOT_SUPPORTED_AUTH_MODE
+			1698: // ER_ACCESS_DENIED_NO_PASSWORD_ERROR
+			return true
+		}
+
+		return false
+	}
 }
@@ -4,8 +4,11 @@
 package driver
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -63,3 +66,15 @@ func TestNormalizeMySQLDSN_Invalid(t *testing.T) {
 	_, err := NormalizeMySQLDSN("::::not a dsn")
 	assert.Error(t, err)
 }
+
+func TestPermanentMySQLError(t *testing.T) {
+	require.NotNil(t, PermanentMySQLError)
+
+	accessDenied := &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'root'@'localhost'"}
+	assert.True(t, PermanentMySQLError(accessDenied))
+	assert.True(t, PermanentMySQLError(fmt.Errorf("ping: %w", accessDenied)))
+	assert.True(t, PermanentMySQLError(&mysql.MySQLError{Number: 1049, Message: "Unknown database 'app'"}))
+
+	assert.False(t, PermanentMySQLError(&mysql.MySQLError{Number: 1040, Message: "Too many connections"}))
+	assert.False(t, PermanentMySQLError(errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")))
+}
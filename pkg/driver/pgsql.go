@@ -3,5 +3,31 @@
 package driver
 
 import (
-	_ "github.com/lib/pq"
+	"errors"
+	"strconv"
+
+	"github.com/lib/pq"
 )
+
+func init() {
+	PostgresErrorPosition = func(err error) (int, bool) {
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) || pqErr.Position == "" {
+			return 0, false
+		}
+
+		position, err := strconv.Atoi(pqErr.Position)
+		return position, err == nil
+	}
+
+	PermanentPostgresError = func(err error) bool {
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) {
+			return false
+		}
+
+		// class 28 is invalid_authorization_specification, e.g. a wrong
+		// password, and 3D000 is invalid_catalog_name, an unknown database
+		return pqErr.Code.Class() == "28" || pqErr.Code == "3D000"
+	}
+}
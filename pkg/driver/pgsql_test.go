@@ -0,0 +1,22 @@
+//go:build !no_postgres
+
+package driver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermanentPostgresError(t *testing.T) {
+	require.NotNil(t, PermanentPostgresError)
+
+	assert.True(t, PermanentPostgresError(&pq.Error{Code: "28P01", Message: "password authentication failed for user \"app\""}))
+	assert.True(t, PermanentPostgresError(&pq.Error{Code: "3D000", Message: "database \"app\" does not exist"}))
+
+	assert.False(t, PermanentPostgresError(&pq.Error{Code: "57P03", Message: "the database system is starting up"}))
+	assert.False(t, PermanentPostgresError(errors.New("dial tcp 127.0.0.1:5432: connect: connection refused")))
+}
@@ -41,7 +41,7 @@ func Migrations() rockhopper.MigrationSlice {
 }
 
 // AddMigration adds a migration with its runtime caller information
-func AddMigration(packageName string, up, down rockhopper.TransactionHandler) {
+func AddMigration(packageName string, up, down rockhopper.TransactionHandler, opts ...rockhopper.MigrationOption) {
 	pc, filename, _, _ := runtime.Caller(1)
 
 	if packageName == "" {
@@ -49,7 +49,7 @@ func AddMigration(packageName string, up, down rockhopper.TransactionHandler) {
 		packageName = _parseFuncPackageName(funcName)
 	}
 
-	AddNamedMigration(packageName, filename, up, down)
+	AddNamedMigration(packageName, filename, up, down, opts...)
 }
 
 // parseFuncPackageName parses the package name from a given runtime caller function name
@@ -65,7 +65,7 @@ func _parseFuncPackageName(funcName string) string {
 }
 
 // AddNamedMigration adds a named migration to the registered go migration map
-func AddNamedMigration(packageName, filename string, up, down rockhopper.TransactionHandler) {
+func AddNamedMigration(packageName, filename string, up, down rockhopper.TransactionHandler, opts ...rockhopper.MigrationOption) {
 	v, err := rockhopper.FileNumericComponent(filename)
 	if err != nil {
 		panic(fmt.Errorf("unable to parse numeric component from filename %s: %v", filename, err))
@@ -82,6 +82,10 @@ func AddNamedMigration(packageName, filename string, up, down rockhopper.Transac
 		UseTx:   true,
 	}
 
+	for _, opt := range opts {
+		opt(migration)
+	}
+
 	key := rockhopper.RegistryKey{Package: packageName, Version: v}
 	if existing, ok := registeredGoMigrations[key]; ok {
 		panic(fmt.Sprintf("failed to add migration %q: version conflicts with key %+v: %+v", filename, key, existing))
@@ -93,7 +97,7 @@ func AddNamedMigration(packageName, filename string, up, down rockhopper.Transac
 // AddStatementMigration registers a migration that was compiled from a .sql file.
 // The SQL statements are kept as data (rather than baked into a function body) so
 // the console can preview each statement while the migration runs.
-func AddStatementMigration(packageName string, version int64, source string, useTx bool, upStatements, downStatements []rockhopper.Statement) {
+func AddStatementMigration(packageName string, version int64, source string, useTx bool, upStatements, downStatements []rockhopper.Statement, opts ...rockhopper.MigrationOption) {
 	migration := &rockhopper.Migration{
 		Package:    packageName,
 		Registered: true,
@@ -106,6 +110,10 @@ func AddStatementMigration(packageName string, version int64, source string, use
 		DownStatements: downStatements,
 	}
 
+	for _, opt := range opts {
+		opt(migration)
+	}
+
 	key := rockhopper.RegistryKey{Package: packageName, Version: version}
 	if existing, ok := registeredGoMigrations[key]; ok {
 		panic(fmt.Sprintf("failed to add migration %q: version conflicts with key %+v: %+v", source, key, existing))
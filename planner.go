@@ -0,0 +1,724 @@
+package rockhopper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// PlanStep is a migration to apply or roll back. It carries the statements it
+// runs, so that a plan decoded from a file runs without the migration files.
+type PlanStep struct {
+	Direction Direction `json:"direction"`
+	Package   string    `json:"package"`
+	Version   int64     `json:"version"`
+	Name      string    `json:"name,omitempty"`
+	Source    string    `json:"source,omitempty"`
+
+	// UseTx runs the step in a transaction.
+	UseTx bool `json:"useTx"`
+
+	// Statements are the statements of the step direction. A Go migration has
+	// none, it is looked up in the registered Go migrations instead.
+	Statements  []Statement `json:"statements"`
+	GoMigration bool        `json:"goMigration,omitempty"`
+
+	// Stream marks the up step of a '-- +stream' migration. Its statements are
+	// not in the plan, they are read from Source when the step runs.
+	Stream bool `json:"stream,omitempty"`
+
+	// BatchSize is the number of statements of a '-- +batch' migration sent
+	// per round trip.
+	BatchSize int `json:"batchSize,omitempty"`
+
+	// Checksum is the checksum of the migration, recorded when it is applied.
+	Checksum string `json:"checksum,omitempty"`
+
+	// Irreversible marks a rollback forced with SetForceIrreversible, which
+	// only removes the version record.
+	Irreversible bool `json:"irreversible,omitempty"`
+
+	// PreviousVersion is the version of the previous migration of the package
+	// of a down step, where an imported baseline rolled back by the step moves.
+	PreviousVersion int64 `json:"previousVersion,omitempty"`
+
+	// Reason tells why the step is in the plan.
+	Reason string `json:"reason"`
+
+	migration *Migration
+}
+
+// Migration returns the migration the step runs. A step decoded from a plan
+// file is rebuilt from its statements, or streams them from Source.
+func (s *PlanStep) Migration() (*Migration, error) {
+	if s.migration != nil {
+		return s.migration, nil
+	}
+
+	if s.GoMigration {
+		m, ok := registeredGoMigrations[RegistryKey{Package: s.Package, Version: s.Version}]
+		if !ok {
+			return nil, fmt.Errorf("go migration %d of package %q is not registered", s.Version, s.Package)
+		}
+
+		s.migration = m
+		return m, nil
+	}
+
+	m := &Migration{
+		Name:         s.Name,
+		Package:      s.Package,
+		Version:      s.Version,
+		Source:       s.Source,
+		UseTx:        s.UseTx,
+		Irreversible: s.Irreversible,
+		Stream:       s.Stream,
+		BatchSize:    s.BatchSize,
+		checksum:     s.Checksum,
+
+		previousVersion: s.PreviousVersion,
+	}
+
+	if s.Direction == DirectionDown {
+		m.DownStatements = s.Statements
+	} else {
+		m.UpStatements = s.Statements
+	}
+
+	s.migration = m
+	return m, nil
+}
+
+// PlanPrecondition is the latest recorded version of a package when the plan
+// was computed. ExecutePlan refuses to run the plan when it has changed.
+type PlanPrecondition struct {
+	Package       string `json:"package"`
+	LatestVersion int64  `json:"latestVersion"`
+}
+
+// Plan is the ordered list of migrations an up, down or align would run,
+// computed by a Planner and run by DB.ExecutePlan.
+type Plan struct {
+	CreatedAt     time.Time          `json:"createdAt"`
+	Preconditions []PlanPrecondition `json:"preconditions"`
+	Steps         []PlanStep         `json:"steps"`
+}
+
+// Encode writes the plan as indented JSON.
+func (p *Plan) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// DecodePlan reads a plan written by Plan.Encode.
+func DecodePlan(r io.Reader) (*Plan, error) {
+	var p Plan
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, errors.Wrap(err, "unable to decode the plan")
+	}
+
+	return &p, nil
+}
+
+func (p *Plan) addStep(direction Direction, m *Migration, reason string) {
+	stmts := m.UpStatements
+	if direction == DirectionDown {
+		stmts = m.DownStatements
+	}
+
+	p.Steps = append(p.Steps, PlanStep{
+		Direction:    direction,
+		Package:      m.Package,
+		Version:      m.Version,
+		Name:         m.Name,
+		Source:       m.Source,
+		UseTx:        m.UseTx,
+		Statements:   stmts,
+		GoMigration:  m.UpFn != nil || m.DownFn != nil,
+		Stream:       direction == DirectionUp && m.Stream,
+		BatchSize:    m.BatchSize,
+		Checksum:     m.Checksum(),
+		Irreversible: direction == DirectionDown && !m.Reversible(),
+		Reason:       reason,
+		migration:    m,
+	})
+
+	if direction == DirectionDown {
+		p.Steps[len(p.Steps)-1].PreviousVersion = m.previousPackageVersion()
+	}
+}
+
+// addPreconditions records the latest version of every package of the steps.
+func (p *Plan) addPreconditions(ctx context.Context, db *DB) error {
+	seen := map[string]bool{}
+	for _, s := range p.Steps {
+		if seen[s.Package] {
+			continue
+		}
+
+		seen[s.Package] = true
+
+		latest, err := db.queryLatestVersion(ctx, s.Package)
+		if err != nil {
+			return err
+		}
+
+		p.Preconditions = append(p.Preconditions, PlanPrecondition{Package: s.Package, LatestVersion: latest})
+	}
+
+	return nil
+}
+
+// StalePlanError is returned by ExecutePlan when the database changed since
+// the plan was computed.
+type StalePlanError struct {
+	Package string
+	Version int64
+	Reason  string
+}
+
+func (e *StalePlanError) Error() string {
+	if e.Version > 0 {
+		return fmt.Sprintf("the database no longer matches the plan: migration %d of package %q %s; compute a new plan",
+			e.Version, e.Package, e.Reason)
+	}
+
+	return fmt.Sprintf("the database no longer matches the plan: package %q %s; compute a new plan", e.Package, e.Reason)
+}
+
+// Planner computes the plans of up, down and align over a set of migrations.
+type Planner struct {
+	db         *DB
+	migrations MigrationSlice
+
+	// AllowOutOfOrder plans pending migrations whose version is below an
+	// applied migration instead of returning OutOfOrderError.
+	AllowOutOfOrder bool
+
+	// SkipOutOfOrder leaves pending migrations whose version is below an
+	// applied migration unplanned instead of returning OutOfOrderError, as
+	// Upgrade does. AllowOutOfOrder takes precedence.
+	SkipOutOfOrder bool
+}
+
+func NewPlanner(db *DB, migrations MigrationSlice) *Planner {
+	return &Planner{db: db, migrations: migrations}
+}
+
+// packages returns the package names in order, and the migrations of each
+// package sorted by version. The migrations of the planner are not reordered.
+func (p *Planner) packages() ([]string, MigrationMap) {
+	migrationMap := MigrationMap{}
+	for pkgName, migrations := range p.migrations.MapByPackage() {
+		migrationMap[pkgName] = append(MigrationSlice(nil), migrations...).Sort()
+	}
+
+	var names []string
+	for pkgName := range migrationMap {
+		names = append(names, pkgName)
+	}
+
+	sort.Strings(names)
+	return names, migrationMap
+}
+
+// applied loads the records of the migrations and returns the applied ones,
+// the newest first.
+func (p *Planner) applied(ctx context.Context, migrations MigrationSlice) (MigrationSlice, error) {
+	if _, err := p.db.InspectMigrations(ctx, migrations); err != nil {
+		return nil, err
+	}
+
+	var applied MigrationSlice
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if m := migrations[i]; m.Record != nil && m.Record.IsApplied {
+			applied = append(applied, m)
+		}
+	}
+
+	return applied, nil
+}
+
+// PlanUp plans the pending migrations of every package. With steps > 0 it
+// plans at most that many migrations of each package, otherwise with to > 0
+// the migrations at or below that version. The steps are in version order,
+// except that a migration comes after the migrations it requires.
+func (p *Planner) PlanUp(ctx context.Context, steps int, to int64) (*Plan, error) {
+	var selected MigrationSlice
+	reasons := map[*Migration]string{}
+
+	names, migrationMap := p.packages()
+	for _, pkgName := range names {
+		status, err := p.db.InspectMigrations(ctx, migrationMap[pkgName])
+		if err != nil {
+			return nil, err
+		}
+
+		pending := status.Pending
+		if len(status.OutOfOrder) > 0 && !p.AllowOutOfOrder {
+			if !p.SkipOutOfOrder {
+				return nil, &OutOfOrderError{
+					Package:               pkgName,
+					HighestAppliedVersion: status.HighestAppliedVersion,
+					Migrations:            status.OutOfOrder,
+				}
+			}
+
+			log.Warnf("skipping %d out-of-order migrations of package %q below the applied version %d: %v",
+				len(status.OutOfOrder), pkgName, status.HighestAppliedVersion, status.OutOfOrder.Versions())
+			pending = pending[len(status.OutOfOrder):]
+		}
+
+		for _, m := range selectPending(pending, steps, to) {
+			reasons[m] = "pending"
+			if m.Version < status.HighestAppliedVersion {
+				reasons[m] = fmt.Sprintf("pending out of order, below the applied version %d", status.HighestAppliedVersion)
+				log.Warnf("applying out-of-order migration %d (%s); it is older than the already-applied version %d",
+					m.Version, m.Source, status.HighestAppliedVersion)
+			}
+
+			selected = append(selected, m)
+		}
+	}
+
+	return p.planUpSteps(ctx, selected, reasons)
+}
+
+// PlanDown plans the rollback of the applied migrations of a package above
+// version to, or of its last steps applied migrations. An empty pkgName
+// selects the only package, see MigrationSlice.ForPackage. It returns
+// IrreversibleMigrationError when one of them can not be rolled back.
+func (p *Planner) PlanDown(ctx context.Context, pkgName string, steps int, to int64) (*Plan, error) {
+	migrations, err := p.migrations.ForPackage(pkgName)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := p.applied(ctx, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(applied) == 0 {
+		return nil, errors.New("last applied migration not found")
+	}
+
+	if steps <= 0 {
+		steps = 1
+	}
+
+	var selected MigrationSlice
+	reasons := map[*Migration]string{}
+	for i, m := range applied {
+		if to > 0 {
+			if m.Version <= to {
+				break
+			}
+
+			reasons[m] = fmt.Sprintf("applied above version %d", to)
+		} else {
+			if i >= steps {
+				break
+			}
+
+			reasons[m] = fmt.Sprintf("one of the last %d applied migrations", steps)
+		}
+
+		selected = append(selected, m)
+	}
+
+	return p.planDownSteps(ctx, selected, reasons)
+}
+
+// PlanDownAll plans the rollback of every applied migration of every package.
+func (p *Planner) PlanDownAll(ctx context.Context) (*Plan, error) {
+	var selected MigrationSlice
+	reasons := map[*Migration]string{}
+
+	names, migrationMap := p.packages()
+	for _, pkgName := range names {
+		applied, err := p.applied(ctx, migrationMap[pkgName])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range applied {
+			reasons[m] = "rolling back all migrations"
+			selected = append(selected, m)
+		}
+	}
+
+	return p.planDownSteps(ctx, selected, reasons)
+}
+
+// PlanAlign plans the migrations that move a package to version: the
+// rollback of the applied migrations above it, or the pending migrations
+// after the last applied one up to it. An empty pkgName selects the only
+// package, see MigrationSlice.ForPackage.
+func (p *Planner) PlanAlign(ctx context.Context, pkgName string, version int64) (*Plan, error) {
+	migrations, err := p.migrations.ForPackage(pkgName)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := p.applied(ctx, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var last int64
+	if len(applied) > 0 {
+		last = applied[0].Version
+	}
+
+	var selected MigrationSlice
+	reasons := map[*Migration]string{}
+
+	switch {
+	case version < last:
+		for _, m := range applied {
+			if m.Version <= version {
+				break
+			}
+
+			reasons[m] = fmt.Sprintf("applied above the align version %d", version)
+			selected = append(selected, m)
+		}
+
+		return p.planDownSteps(ctx, selected, reasons)
+
+	case version > last:
+		for _, m := range migrations {
+			if m.Version <= last {
+				continue
+			}
+
+			if m.Version > version {
+				break
+			}
+
+			reasons[m] = fmt.Sprintf("pending up to the align version %d", version)
+			selected = append(selected, m)
+		}
+
+		return p.planUpSteps(ctx, selected, reasons)
+	}
+
+	log.Infof("the migration version is already aligned to %d", version)
+	return &Plan{CreatedAt: time.Now()}, nil
+}
+
+// planUpSteps plans the migrations in the order of their requirements.
+func (p *Planner) planUpSteps(ctx context.Context, migrations MigrationSlice, reasons map[*Migration]string) (*Plan, error) {
+	plan := &Plan{CreatedAt: time.Now()}
+	if err := p.addUpSteps(ctx, plan, migrations, reasons); err != nil {
+		return nil, err
+	}
+
+	return plan, plan.addPreconditions(ctx, p.db)
+}
+
+// planDownSteps plans the rollback of the migrations in the reverse order of
+// their requirements.
+func (p *Planner) planDownSteps(ctx context.Context, migrations MigrationSlice, reasons map[*Migration]string) (*Plan, error) {
+	plan := &Plan{CreatedAt: time.Now()}
+	if err := p.addDownSteps(ctx, plan, migrations, reasons); err != nil {
+		return nil, err
+	}
+
+	return plan, plan.addPreconditions(ctx, p.db)
+}
+
+// addUpSteps appends the migrations in the order of their requirements. A
+// required migration must be applied already or be one of the migrations.
+func (p *Planner) addUpSteps(ctx context.Context, plan *Plan, migrations MigrationSlice, reasons map[*Migration]string) error {
+	// the steps carry the statements
+	if err := migrations.Parse(); err != nil {
+		return err
+	}
+
+	planned := map[MigrationRef]bool{}
+	for _, m := range migrations {
+		planned[m.ref()] = true
+	}
+
+	for _, m := range migrations {
+		for _, req := range m.Requires {
+			if planned[req] {
+				continue
+			}
+
+			applied, err := p.isApplied(ctx, req)
+			if err != nil {
+				return err
+			}
+
+			if !applied {
+				return &UnmetRequirementError{Migration: m, Requires: req}
+			}
+		}
+	}
+
+	sorted, err := sortByRequires(migrations)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range sorted {
+		plan.addStep(DirectionUp, m, reasons[m])
+	}
+
+	return nil
+}
+
+// addDownSteps appends the rollback of the migrations in the reverse order of
+// their requirements. An applied migration that requires one of them must be
+// one of them too.
+func (p *Planner) addDownSteps(ctx context.Context, plan *Plan, migrations MigrationSlice, reasons map[*Migration]string) error {
+	if err := migrations.Parse(); err != nil {
+		return err
+	}
+
+	planned := map[MigrationRef]bool{}
+	for _, m := range migrations {
+		planned[m.ref()] = true
+	}
+
+	for _, dependent := range p.migrations {
+		if planned[dependent.ref()] {
+			continue
+		}
+
+		for _, req := range dependent.Requires {
+			if !planned[req] {
+				continue
+			}
+
+			applied, err := p.isApplied(ctx, dependent.ref())
+			if err != nil {
+				return err
+			}
+
+			if applied {
+				return &RequiredMigrationError{Migration: req, RequiredBy: dependent}
+			}
+		}
+	}
+
+	sorted, err := sortByRequires(migrations)
+	if err != nil {
+		return err
+	}
+
+	for i := len(sorted) - 1; i >= 0; i-- {
+		m := sorted[i]
+		if err := p.db.checkReversible(m); err != nil {
+			return err
+		}
+
+		reason := reasons[m]
+		if !m.Reversible() {
+			reason += ", irreversible: only its version record is removed"
+		}
+
+		m.previousVersion = p.previousVersion(m)
+		plan.addStep(DirectionDown, m, reason)
+	}
+
+	return nil
+}
+
+// previousVersion returns the version of the migration of the planner before
+// m in its package, zero when m is the first one.
+func (p *Planner) previousVersion(m *Migration) int64 {
+	var prev int64
+	for _, other := range p.migrations {
+		if other.Package == m.Package && other.Version < m.Version && other.Version > prev {
+			prev = other.Version
+		}
+	}
+
+	return prev
+}
+
+// isApplied reports whether the migration is applied, the migration of the
+// planner when it has one.
+func (p *Planner) isApplied(ctx context.Context, ref MigrationRef) (bool, error) {
+	m := &Migration{Package: ref.Package, Version: ref.Version}
+	for _, known := range p.migrations {
+		if known.ref() == ref {
+			m = known
+			break
+		}
+	}
+
+	m.Record = nil
+	if _, err := p.db.LoadMigration(ctx, m); err != nil {
+		return false, err
+	}
+
+	return m.Record != nil && m.Record.IsApplied, nil
+}
+
+// selectPending narrows the pending migrations down to those that should be applied
+// for this run. steps takes precedence over to: with steps > 0 it returns at most
+// that many migrations; otherwise with to > 0 it returns those at or below the
+// target version. The slice is assumed to be in ascending version order.
+func selectPending(pending MigrationSlice, steps int, to int64) MigrationSlice {
+	if steps > 0 {
+		if steps < len(pending) {
+			return pending[:steps]
+		}
+		return pending
+	}
+
+	if to > 0 {
+		var selected MigrationSlice
+		for _, m := range pending {
+			if m.Version > to {
+				break
+			}
+			selected = append(selected, m)
+		}
+		return selected
+	}
+
+	return pending
+}
+
+// ExecutePlan runs the steps of the plan in order. It first verifies that the
+// database still matches the plan: the latest version of every package is the
+// one recorded in the plan, every up step is pending and every down step is
+// applied. Otherwise it returns StalePlanError without running anything. With
+// SetAtomic, the steps run in one transaction.
+func (db *DB) ExecutePlan(ctx context.Context, plan *Plan, callbacks ...func(m *Migration)) error {
+	if err := db.checkPlan(ctx, plan); err != nil {
+		return err
+	}
+
+	// refuse the whole plan rather than stop in the middle of it
+	if db.strictImplicitCommits {
+		if err := db.checkPlanImplicitCommits(plan); err != nil {
+			return err
+		}
+	}
+
+	if !db.atomic {
+		return db.executePlanSteps(ctx, plan, callbacks...)
+	}
+
+	migrations := make(MigrationSlice, len(plan.Steps))
+	for i := range plan.Steps {
+		m, err := plan.Steps[i].Migration()
+		if err != nil {
+			return err
+		}
+
+		migrations[i] = m
+	}
+
+	if err := db.checkAtomic(migrations...); err != nil {
+		return err
+	}
+
+	return db.runAtomic(ctx, func() error {
+		return db.executePlanSteps(ctx, plan, callbacks...)
+	})
+}
+
+func (db *DB) executePlanSteps(ctx context.Context, plan *Plan, callbacks ...func(m *Migration)) error {
+	for i := range plan.Steps {
+		s := &plan.Steps[i]
+
+		m, err := s.Migration()
+		if err != nil {
+			return err
+		}
+
+		if s.Direction == DirectionDown {
+			descMigration("downgrading", m)
+
+			// the plan was computed with irreversible migrations forced down
+			if s.Irreversible {
+				log.Warnf("forcing irreversible migration %s down, its changes stay in the database", m.location())
+				err = m.runDown(ctx, db)
+			} else {
+				err = m.Down(ctx, db)
+			}
+		} else {
+			descMigration("upgrading", m)
+			err = m.Up(ctx, db)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, cb := range callbacks {
+			cb(m)
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) checkPlan(ctx context.Context, plan *Plan) error {
+	for _, pre := range plan.Preconditions {
+		latest, err := db.queryLatestVersion(ctx, pre.Package)
+		if err != nil {
+			return err
+		}
+
+		if latest != pre.LatestVersion {
+			return &StalePlanError{
+				Package: pre.Package,
+				Reason:  fmt.Sprintf("is at version %d, the plan was computed at version %d", latest, pre.LatestVersion),
+			}
+		}
+	}
+
+	migrations := make(MigrationSlice, len(plan.Steps))
+	for i := range plan.Steps {
+		s := &plan.Steps[i]
+		decoded := s.migration == nil
+		m, err := s.Migration()
+		if err != nil {
+			return err
+		}
+
+		// the statements of a stream step decoded from a plan file are read
+		// from its source when it runs, which must still be the planned file
+		if decoded && s.Stream && s.Direction == DirectionUp {
+			if err := db.checkStreamSource(m); err != nil {
+				return err
+			}
+		}
+
+		migrations[i] = m
+	}
+
+	if err := db.LoadMigrations(ctx, migrations); err != nil {
+		return err
+	}
+
+	for i, m := range migrations {
+		s := &plan.Steps[i]
+		applied := m.Record != nil && m.Record.IsApplied
+		if s.Direction == DirectionUp && applied {
+			return &StalePlanError{Package: s.Package, Version: s.Version, Reason: "is already applied"}
+		}
+
+		if s.Direction == DirectionDown && !applied {
+			return &StalePlanError{Package: s.Package, Version: s.Version, Reason: "is not applied"}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package rockhopper
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadPlannerTestMigrations(t *testing.T) MigrationSlice {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_create_users.sql", "-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n")
+	writeTestMigrationFile(t, dir, "20240102120000_create_posts.sql", "-- +up\nCREATE TABLE posts (id INT);\n-- +down\nDROP TABLE posts;\n")
+	writeTestMigrationFile(t, dir, "20240103120000_create_tags.sql", "-- +up\nCREATE TABLE tags (id INT);\n-- +down\nDROP TABLE tags;\n")
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+	return migrations
+}
+
+func planVersions(plan *Plan) (versions []int64) {
+	for _, s := range plan.Steps {
+		versions = append(versions, s.Version)
+	}
+
+	return versions
+}
+
+func TestPlanner_PlanUp(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrations := loadPlannerTestMigrations(t)
+
+	plan, err := NewPlanner(db, migrations).PlanUp(ctx, 0, 20240102120000)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240101120000, 20240102120000}, planVersions(plan))
+	assert.Equal(t, []PlanPrecondition{{Package: DefaultPackageName, LatestVersion: 0}}, plan.Preconditions)
+
+	step := plan.Steps[0]
+	assert.Equal(t, DirectionUp, step.Direction)
+	assert.Equal(t, "pending", step.Reason)
+	assert.Equal(t, migrations[0].UpStatements, step.Statements)
+	assert.Equal(t, migrations[0].Checksum(), step.Checksum)
+
+	plan, err = NewPlanner(db, migrations).PlanUp(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240101120000}, planVersions(plan))
+}
+
+func TestPlanner_PlanDownAndAlign(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrations := loadPlannerTestMigrations(t)
+	require.NoError(t, UpMigrations(ctx, db, migrations))
+
+	planner := NewPlanner(db, migrations)
+
+	plan, err := planner.PlanDown(ctx, "", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240103120000}, planVersions(plan), "one step by default")
+	assert.Equal(t, DirectionDown, plan.Steps[0].Direction)
+	assert.Equal(t, migrations[2].DownStatements, plan.Steps[0].Statements)
+
+	plan, err = planner.PlanDown(ctx, "", 0, 20240101120000)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240103120000, 20240102120000}, planVersions(plan))
+
+	plan, err = planner.PlanDownAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240103120000, 20240102120000, 20240101120000}, planVersions(plan))
+
+	plan, err = planner.PlanAlign(ctx, DefaultPackageName, 20240101120000)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240103120000, 20240102120000}, planVersions(plan))
+	require.NoError(t, db.ExecutePlan(ctx, plan))
+
+	plan, err = planner.PlanAlign(ctx, DefaultPackageName, 20240102120000)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240102120000}, planVersions(plan))
+	assert.Equal(t, DirectionUp, plan.Steps[0].Direction)
+
+	plan, err = planner.PlanAlign(ctx, DefaultPackageName, 20240101120000)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Steps, "already aligned")
+}
+
+func TestExecutePlan_Decoded(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrations := loadPlannerTestMigrations(t)
+
+	plan, err := NewPlanner(db, migrations).PlanUp(ctx, 0, 0)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, plan.Encode(&buf))
+	assert.Contains(t, buf.String(), `"direction": "up"`)
+
+	decoded, err := DecodePlan(&buf)
+	require.NoError(t, err)
+	require.Len(t, decoded.Steps, 3)
+	require.NoError(t, db.ExecutePlan(ctx, decoded))
+
+	for _, m := range migrations {
+		m.Record = nil
+		_, err := db.LoadMigration(ctx, m)
+		require.NoError(t, err)
+		if assert.NotNil(t, m.Record) {
+			assert.True(t, m.Record.IsApplied)
+			assert.Equal(t, m.Checksum(), m.Record.Checksum, "the checksum of the migration file is recorded")
+		}
+	}
+}
+
+func TestExecutePlan_Stale(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrations := loadPlannerTestMigrations(t)
+
+	plan, err := NewPlanner(db, migrations).PlanUp(ctx, 0, 0)
+	require.NoError(t, err)
+
+	// another deploy applied a migration after the plan was computed
+	require.NoError(t, migrations[0].Up(ctx, db))
+
+	var staleErr *StalePlanError
+	err = db.ExecutePlan(ctx, plan)
+	if assert.ErrorAs(t, err, &staleErr) {
+		assert.Equal(t, DefaultPackageName, staleErr.Package)
+	}
+
+	latest, err := db.queryLatestVersion(ctx, DefaultPackageName)
+	require.NoError(t, err)
+	assert.Equal(t, migrations[0].Version, latest, "nothing of the plan runs")
+
+	// the plan of a package at the same version still checks every step
+	plan, err = NewPlanner(db, migrations).PlanUp(ctx, 0, 0)
+	require.NoError(t, err)
+	plan.Steps = append(plan.Steps, PlanStep{Direction: DirectionUp, Package: DefaultPackageName, Version: migrations[0].Version})
+
+	err = db.ExecutePlan(ctx, plan)
+	if assert.ErrorAs(t, err, &staleErr) {
+		assert.Equal(t, migrations[0].Version, staleErr.Version)
+	}
+}
+
+func TestPlanner_PlanDownPackage(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	// the versions of the packages interleave
+	migrations := loadRequiresTestMigrations(t, map[string]string{
+		"20240101120000_create_users.sql":    "-- @package users\n-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n",
+		"20240102120000_create_invoices.sql": "-- @package billing\n-- +up\nCREATE TABLE invoices (id INT);\n-- +down\nDROP TABLE invoices;\n",
+		"20240103120000_create_posts.sql":    "-- @package users\n-- +up\nCREATE TABLE posts (id INT);\n-- +down\nDROP TABLE posts;\n",
+		"20240104120000_create_refunds.sql":  "-- @package billing\n-- +up\nCREATE TABLE refunds (id INT);\n-- +down\nDROP TABLE refunds;\n",
+	})
+	require.NoError(t, Upgrade(ctx, db, migrations))
+
+	planner := NewPlanner(db, migrations)
+
+	var packageErr *PackageRequiredError
+	_, err := planner.PlanDown(ctx, "", 1, 0)
+	if assert.ErrorAs(t, err, &packageErr) {
+		assert.Equal(t, []string{"billing", "users"}, packageErr.Packages)
+	}
+
+	plan, err := planner.PlanDown(ctx, "users", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users:20240103120000"}, planRefs(plan), "the last migration of the package, not the newest one")
+
+	plan, err = planner.PlanDown(ctx, "users", 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users:20240103120000", "users:20240101120000"}, planRefs(plan))
+
+	_, err = planner.PlanDown(ctx, "orders", 1, 0)
+	assert.ErrorContains(t, err, `no migrations of package "orders"`)
+
+	require.NoError(t, DownPackageBySteps(ctx, db, migrations, "billing", 1))
+	require.NoError(t, RedoPackage(ctx, db, migrations, "users"))
+	assert.ErrorAs(t, RedoPackage(ctx, db, migrations, ""), &packageErr)
+
+	applied := func(pkgName string) int64 {
+		latest, err := db.queryLatestVersion(ctx, pkgName)
+		require.NoError(t, err)
+		return latest
+	}
+
+	assert.Equal(t, int64(20240102120000), applied("billing"))
+	assert.Equal(t, int64(20240103120000), applied("users"))
+
+	require.NoError(t, DownPackage(ctx, db, migrations, "users", 0))
+	assert.Equal(t, int64(0), applied("users"))
+	assert.Equal(t, int64(20240102120000), applied("billing"))
+}
+
+func TestDB_ExecutePlan_DecodedBaselineDown(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrations := loadPlannerTestMigrations(t)
+
+	// the history of another tool was imported as a baseline at posts
+	_, err := db.ExecContext(ctx, "CREATE TABLE users (id INT); CREATE TABLE posts (id INT);")
+	require.NoError(t, err)
+	require.NoError(t, db.insertVersion(ctx, db, DefaultPackageName, baselineSourceFile, 20240102120000, true))
+
+	plan, err := NewPlanner(db, migrations).PlanDown(ctx, "", 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{20240102120000}, planVersions(plan))
+
+	var buf bytes.Buffer
+	require.NoError(t, plan.Encode(&buf))
+	decoded, err := DecodePlan(&buf)
+	require.NoError(t, err)
+	require.NoError(t, db.ExecutePlan(ctx, decoded))
+
+	baseline, _, err := db.queryImportedBaseline(ctx, DefaultPackageName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20240101120000), baseline, "the baseline moves to the previous migration")
+
+	status, err := db.InspectMigrations(ctx, migrations)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240102120000, 20240103120000}, status.Pending.Versions())
+}
@@ -0,0 +1,315 @@
+package rockhopper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/c9s/rockhopper/v2/pkg/dialect"
+)
+
+// ProgressTableName is the core table that records how far a non-transactional
+// migration got. A row exists only while such a migration is in flight or was
+// interrupted; it is removed once the migration is recorded as applied.
+const ProgressTableName = "rockhopper_migration_progress"
+
+// Migration progress status values stored in the status column.
+const (
+	// ProgressRunning means the statement at StatementIndex was being executed.
+	// A row left in this state was interrupted by a crash.
+	ProgressRunning = "running"
+
+	// ProgressDirty means the statement at StatementIndex failed. The statements
+	// before it stay applied, and the next up resumes from it.
+	ProgressDirty = "dirty"
+
+	// ProgressFailed means an operator marked the migration as failed with
+	// repair. Up refuses to resume it until it is repaired clean.
+	ProgressFailed = "failed"
+
+	// ProgressClean is the repair target that clears the recorded progress, so
+	// the next up runs the migration again from its first statement.
+	ProgressClean = "clean"
+)
+
+// MigrationProgress is the recorded progress of a partially applied
+// non-transactional migration.
+type MigrationProgress struct {
+	Package string
+	Version int64
+
+	// StatementIndex is the 0-based index of the first statement that has not
+	// completed. The statements before it are applied.
+	StatementIndex int
+
+	Status string
+	Error  string
+}
+
+// IsDirty reports whether the migration stopped halfway, either by failing or
+// by being interrupted.
+func (p *MigrationProgress) IsDirty() bool {
+	return p != nil && p.Status != ""
+}
+
+func (p *MigrationProgress) String() string {
+	return fmt.Sprintf("%s at statement #%d", p.Status, p.StatementIndex+1)
+}
+
+// DirtyMigrationError is returned when up finds a migration that an operator
+// marked as failed. It has to be repaired before it can run again.
+type DirtyMigrationError struct {
+	Migration *Migration
+	Progress  *MigrationProgress
+}
+
+func (e *DirtyMigrationError) Error() string {
+	return fmt.Sprintf("migration %s is marked %s; fix the database by hand, then run `rockhopper repair %s %d --mark clean`",
+		e.Migration.location(), e.Progress, e.Migration.Package, e.Migration.Version)
+}
+
+// migrationProgressSchema describes the statement progress table.
+func migrationProgressSchema(tableName string) dialect.Schema {
+	return dialect.Schema{
+		Table: tableName,
+		Columns: []dialect.Column{
+			{Name: "id", Type: dialect.ColSerial, PrimaryKey: true},
+			{Name: "package", Type: dialect.ColVarchar, Size: packageColumnSize, NotNull: true, Default: "'main'"},
+			{Name: "version_id", Type: dialect.ColBigInt, NotNull: true},
+			{Name: "statement_index", Type: dialect.ColBigInt, NotNull: true, Default: "0"},
+			{Name: "status", Type: dialect.ColVarchar, Size: 32, NotNull: true, Default: "'running'"},
+			{Name: "error", Type: dialect.ColText},
+			{Name: "updated_at", Type: dialect.ColTimestamp, NotNull: true, Default: dialect.DefaultNow},
+		},
+		Unique: [][]string{{"package", "version_id"}},
+	}
+}
+
+func (db *DB) createProgressTable(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, db.dialect.CreateTable(migrationProgressSchema(ProgressTableName)))
+	return err
+}
+
+// LoadMigrationProgress loads the recorded progress of a migration. It returns
+// (nil, nil) when the migration has no progress row.
+func (db *DB) LoadMigrationProgress(ctx context.Context, pkgName string, version int64) (*MigrationProgress, error) {
+	q, args := db.dialect.Select(ProgressTableName,
+		[]string{"statement_index", "status", "error"},
+		[]dialect.Col{
+			{Name: "package", Val: pkgName},
+			{Name: "version_id", Val: version},
+		},
+		dialect.SelectOpt{})
+
+	p := &MigrationProgress{Package: pkgName, Version: version}
+
+	var errMsg sql.NullString
+	if err := db.QueryRowContext(ctx, q, args...).Scan(&p.StatementIndex, &p.Status, &errMsg); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "failed to load migration progress")
+	}
+
+	p.Error = errMsg.String
+	return p, nil
+}
+
+// LoadMigrationProgressByPackage loads the recorded progress of every dirty
+// migration in a package, keyed by version.
+func (db *DB) LoadMigrationProgressByPackage(ctx context.Context, pkgName string) (map[int64]*MigrationProgress, error) {
+	q, args := db.dialect.Select(ProgressTableName,
+		[]string{"version_id", "statement_index", "status", "error"},
+		[]dialect.Col{{Name: "package", Val: pkgName}},
+		dialect.SelectOpt{})
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load migration progress")
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	progress := make(map[int64]*MigrationProgress)
+	for rows.Next() {
+		p := &MigrationProgress{Package: pkgName}
+
+		var errMsg sql.NullString
+		if err := rows.Scan(&p.Version, &p.StatementIndex, &p.Status, &errMsg); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+
+		p.Error = errMsg.String
+		progress[p.Version] = p
+	}
+
+	return progress, rows.Err()
+}
+
+// saveMigrationProgress records the progress of a migration, inserting the row
+// on the first call and updating it afterwards. It writes through exec, the
+// connection the statements of the migration run on.
+func (db *DB) saveMigrationProgress(ctx context.Context, exec SQLExecutor, p *MigrationProgress, exists bool) error {
+	keys := []dialect.Col{
+		{Name: "package", Val: p.Package},
+		{Name: "version_id", Val: p.Version},
+	}
+
+	var q string
+	var args []any
+	if exists {
+		q, args = db.dialect.Update(ProgressTableName,
+			[]dialect.Col{
+				{Name: "statement_index", Val: p.StatementIndex},
+				{Name: "status", Val: p.Status},
+				{Name: "error", Val: p.Error},
+			},
+			keys,
+			dialect.UpdateOpt{NowCols: []string{"updated_at"}})
+	} else {
+		q, args = db.dialect.Insert(ProgressTableName, append(keys,
+			dialect.Col{Name: "statement_index", Val: p.StatementIndex},
+			dialect.Col{Name: "status", Val: p.Status},
+			dialect.Col{Name: "error", Val: p.Error},
+		))
+	}
+
+	if _, err := exec.ExecContext(ctx, q, args...); err != nil {
+		return errors.Wrap(err, "failed to save migration progress")
+	}
+
+	return nil
+}
+
+func (db *DB) deleteMigrationProgress(ctx context.Context, exec SQLExecutor, pkgName string, version int64) error {
+	q, args := db.dialect.Delete(ProgressTableName, []dialect.Col{
+		{Name: "package", Val: pkgName},
+		{Name: "version_id", Val: version},
+	})
+	if _, err := exec.ExecContext(ctx, q, args...); err != nil {
+		return errors.Wrap(err, "failed to delete migration progress")
+	}
+
+	return nil
+}
+
+// RepairMigration resolves the recorded progress of a dirty migration. Marking
+// it ProgressClean removes the progress, so the next up runs the migration from
+// its first statement; use it after undoing the partial changes by hand.
+// Marking it ProgressFailed keeps the progress but stops up from resuming it.
+func (db *DB) RepairMigration(ctx context.Context, pkgName string, version int64, status string) error {
+	p, err := db.LoadMigrationProgress(ctx, pkgName, version)
+	if err != nil {
+		return err
+	}
+
+	if p == nil {
+		return fmt.Errorf("migration %s:%d has no recorded progress, nothing to repair", pkgName, version)
+	}
+
+	switch status {
+	case ProgressClean:
+		return db.deleteMigrationProgress(ctx, db, pkgName, version)
+
+	case ProgressFailed:
+		p.Status = ProgressFailed
+		return db.saveMigrationProgress(ctx, db, p, true)
+	}
+
+	return fmt.Errorf("unsupported repair status %q, expecting %q or %q", status, ProgressClean, ProgressFailed)
+}
+
+// runUpTracked applies a non-transactional statement migration one statement
+// at a time and records its progress after each statement. When a previous run
+// stopped halfway, it resumes from the first incomplete statement instead of
+// re-running the statements that are already applied.
+func (m *Migration) runUpTracked(ctx context.Context, db *DB, startTime time.Time) (int, error) {
+	progress, err := db.LoadMigrationProgress(ctx, m.Package, m.Version)
+	if err != nil {
+		return 0, err
+	}
+
+	executed := 0
+	exists := progress != nil
+	start := 0
+	if exists {
+		if progress.Status == ProgressFailed {
+			return 0, &DirtyMigrationError{Migration: m, Progress: progress}
+		}
+
+		start = progress.StatementIndex
+		log.Warnf("resuming %s migration %s from statement #%d", progress.Status, m.location(), start+1)
+	} else {
+		progress = &MigrationProgress{Package: m.Package, Version: m.Version}
+	}
+
+	err = db.withServerCancel(ctx, db.DB, func(exec SQLExecutor) error {
+		i := -1
+		for stmt, err := range m.upStatementSeq(db) {
+			if err != nil {
+				return errors.Wrapf(err, "up migration failed: %s", m.location())
+			}
+
+			// the statements before start were applied by the previous run
+			i++
+			if i < start {
+				continue
+			}
+
+			if isNoOpSQL(stmt.SQL) {
+				log.Debugf("skipping empty SQL statement #%d", i+1)
+				continue
+			}
+
+			progress.StatementIndex = i
+			progress.Status = ProgressRunning
+			progress.Error = ""
+			if err := db.saveMigrationProgress(ctx, exec, progress, exists); err != nil {
+				return err
+			}
+
+			exists = true
+
+			if err := executeStatement(ctx, exec, &stmt); err != nil {
+				err = errors.Wrap(err, stmt.describe(i))
+				if interruptErr := interrupted(ctx, i, stmt.describe(i)); interruptErr != nil {
+					err = interruptErr
+				}
+
+				// an interrupted statement is recorded as well, the next up
+				// resumes from it
+				progress.Status = ProgressDirty
+				progress.Error = err.Error()
+				if err2 := db.saveMigrationProgress(context.WithoutCancel(ctx), exec, progress, true); err2 != nil {
+					log.WithError(err2).Errorf("unable to record dirty migration %s", m.location())
+				}
+
+				return errors.Wrapf(err, "up migration failed: %s", m.location())
+			}
+
+			executed++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return executed, err
+	}
+
+	if err := db.insertAppliedVersion(ctx, db.DB, m, time.Since(startTime)); err != nil {
+		return executed, errors.Wrapf(err, "up migration failed: %s", m.location())
+	}
+
+	if exists {
+		return executed, db.deleteMigrationProgress(ctx, db.DB, m.Package, m.Version)
+	}
+
+	return executed, nil
+}
@@ -0,0 +1,112 @@
+package rockhopper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newNonTxMigration(version int64, stmts ...string) *Migration {
+	m := &Migration{
+		Package: "main",
+		Version: version,
+		Source:  "migrations/main/non_tx.sql",
+		UseTx:   false,
+	}
+
+	for _, s := range stmts {
+		m.UpStatements = append(m.UpStatements, Statement{Direction: DirectionUp, SQL: s})
+	}
+
+	return m
+}
+
+// TestRunUpTracked_ResumesFromFailedStatement guards that a non-transactional
+// migration failing halfway records its progress, and that the next up resumes
+// from the failed statement instead of re-running the applied ones.
+func TestRunUpTracked_ResumesFromFailedStatement(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	m := newNonTxMigration(20240101000000,
+		"CREATE TABLE a (id INT)",
+		"INSERT INTO missing (id) VALUES (1)",
+		"CREATE TABLE b (id INT)",
+	)
+
+	err := m.Up(ctx, db)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "statement #2")
+
+	progress, err := db.LoadMigrationProgress(ctx, "main", m.Version)
+	require.NoError(t, err)
+	require.NotNil(t, progress)
+	assert.Equal(t, ProgressDirty, progress.Status)
+	assert.Equal(t, 1, progress.StatementIndex)
+	assert.NotEmpty(t, progress.Error)
+
+	// the migration is not recorded as applied
+	_, err = db.LoadMigration(ctx, m)
+	require.NoError(t, err)
+	assert.Nil(t, m.Record)
+
+	// fix the cause; re-running CREATE TABLE a would fail, so this only passes
+	// when up resumes from statement #2.
+	_, err = db.ExecContext(ctx, "CREATE TABLE missing (id INT)")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Up(ctx, db))
+
+	_, err = db.LoadMigration(ctx, m)
+	require.NoError(t, err)
+	if assert.NotNil(t, m.Record) {
+		assert.True(t, m.Record.IsApplied)
+	}
+
+	progress, err = db.LoadMigrationProgress(ctx, "main", m.Version)
+	require.NoError(t, err)
+	assert.Nil(t, progress, "progress must be cleared once the migration is applied")
+}
+
+func TestRepairMigration(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	m := newNonTxMigration(20240101000000,
+		"CREATE TABLE a (id INT)",
+		"INSERT INTO missing (id) VALUES (1)",
+	)
+	require.Error(t, m.Up(ctx, db))
+
+	t.Run("failed blocks resume", func(t *testing.T) {
+		require.NoError(t, db.RepairMigration(ctx, "main", m.Version, ProgressFailed))
+
+		err := m.Up(ctx, db)
+		var dirtyErr *DirtyMigrationError
+		if assert.ErrorAs(t, err, &dirtyErr) {
+			assert.Equal(t, ProgressFailed, dirtyErr.Progress.Status)
+			assert.Contains(t, err.Error(), "repair")
+		}
+	})
+
+	t.Run("clean re-runs from the first statement", func(t *testing.T) {
+		require.NoError(t, db.RepairMigration(ctx, "main", m.Version, ProgressClean))
+
+		progress, err := db.LoadMigrationProgressByPackage(ctx, "main")
+		require.NoError(t, err)
+		assert.Empty(t, progress)
+
+		_, err = db.ExecContext(ctx, "DROP TABLE a")
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx, "CREATE TABLE missing (id INT)")
+		require.NoError(t, err)
+
+		require.NoError(t, m.Up(ctx, db))
+	})
+
+	t.Run("nothing to repair", func(t *testing.T) {
+		assert.Error(t, db.RepairMigration(ctx, "main", m.Version, ProgressClean))
+	})
+}
@@ -0,0 +1,159 @@
+package rockhopper
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/c9s/rockhopper/v2/pkg/dialect"
+)
+
+// versionIndex is the index of the version table every record lookup goes
+// through.
+func versionIndex(tableName string) dialect.IndexDef {
+	return dialect.IndexDef{
+		Name:    tableName + "_package_version_idx",
+		Columns: []string{"package", "version_id"},
+	}
+}
+
+// createVersionIndex is the VersionRockhopperV5 core upgrade. Dialects that
+// do not render indexes, like ClickHouse, which orders its tables by the
+// primary key instead, skip it.
+func (db *DB) createVersionIndex(ctx context.Context) error {
+	alterer, ok := db.dialect.(dialect.SchemaAlterer)
+	if !ok {
+		log.Debugf("dialect %s can not create indexes, skipping the version table index", db.driverName)
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, alterer.CreateIndex(db.tableName, versionIndex(db.tableName)))
+	return err
+}
+
+// packageRecords are the records of a package, indexed by version.
+type packageRecords struct {
+	// records are in descending id order.
+	records []MigrationRecord
+
+	// latest is the latest record of each version.
+	latest map[int64]*MigrationRecord
+
+	// baseline is the highest imported baseline version, 0 when there is none.
+	baseline     int64
+	baselineTime time.Time
+}
+
+// loadPackageRecords loads every record of a package in one query.
+func (db *DB) loadPackageRecords(ctx context.Context, pkgName string) (*packageRecords, error) {
+	audit, err := db.hasAuditColumns(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cols := []string{"id", "version_id", "tstamp", "is_applied", "source_file"}
+	if audit {
+		cols = append(cols, auditColumnNames...)
+	}
+
+	q, args := db.dialect.Select(db.tableName, cols,
+		[]dialect.Col{{Name: "package", Val: pkgName}},
+		dialect.SelectOpt{OrderBy: []dialect.Order{{Col: "id", Desc: true}}})
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load the migration records of package %s", pkgName)
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.WithError(err).Error("row close error")
+		}
+	}()
+
+	pr := &packageRecords{latest: map[int64]*MigrationRecord{}}
+	for rows.Next() {
+		var record MigrationRecord
+		var sourceFile string
+		var durationMs int64
+		dests := []any{&record.ID, &record.VersionID, &record.Time, &record.IsApplied, &sourceFile}
+		if audit {
+			dests = append(dests, record.auditDests(&durationMs)...)
+		}
+
+		if err := rows.Scan(dests...); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+
+		record.Package = pkgName
+		record.Duration = time.Duration(durationMs) * time.Millisecond
+		pr.records = append(pr.records, record)
+
+		if sourceFile == baselineSourceFile && record.VersionID > pr.baseline {
+			pr.baseline = record.VersionID
+			pr.baselineTime = record.Time
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read the next row")
+	}
+
+	// the rows are in descending id order, the first one of a version is its latest state
+	for i := range pr.records {
+		r := &pr.records[i]
+		if _, ok := pr.latest[r.VersionID]; !ok {
+			pr.latest[r.VersionID] = r
+		}
+	}
+
+	return pr, nil
+}
+
+// load sets the record of m like LoadMigration does, and resets it to nil when
+// m has no record.
+func (pr *packageRecords) load(m *Migration) error {
+	m.Record = nil
+
+	if r, ok := pr.latest[m.Version]; ok {
+		record := *r
+		m.Record = &record
+		return nil
+	}
+
+	if m.SquashedFrom > 0 {
+		return checkSquashedRecords(m, pr.records)
+	}
+
+	if pr.baseline > 0 && m.Version <= pr.baseline {
+		m.Record = importedBaselineRecord(m, pr.baselineTime)
+	}
+
+	return nil
+}
+
+// LoadMigrations loads the records of the migrations like LoadMigration, with
+// one query per package instead of one per migration. The Record field of a
+// migration without a record is reset to nil.
+func (db *DB) LoadMigrations(ctx context.Context, migrations MigrationSlice) error {
+	byPackage := map[string]*packageRecords{}
+	for _, m := range migrations {
+		pr, ok := byPackage[m.Package]
+		if !ok {
+			var err error
+			if pr, err = db.loadPackageRecords(ctx, m.Package); err != nil {
+				return err
+			}
+
+			byPackage[m.Package] = pr
+		}
+
+		if err := pr.load(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package rockhopper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_LoadMigrations_Bulk(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	migrations := loadRequiresTestMigrations(t, map[string]string{
+		"20240101120000_create_users.sql":    "-- @package users\n-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n",
+		"20240102120000_create_invoices.sql": "-- @package billing\n-- +up\nCREATE TABLE invoices (id INT);\n-- +down\nDROP TABLE invoices;\n",
+		"20240103120000_create_posts.sql":    "-- @package users\n-- +up\nCREATE TABLE posts (id INT);\n-- +down\nDROP TABLE posts;\n",
+		"20240104120000_create_refunds.sql":  "-- @package billing\n-- +up\nCREATE TABLE refunds (id INT);\n-- +down\nDROP TABLE refunds;\n",
+	})
+	require.NoError(t, Upgrade(ctx, db, migrations))
+
+	byRef := map[string]*Migration{}
+	for _, m := range migrations {
+		byRef[m.ref().String()] = m
+	}
+
+	// billing:20240104120000 is rolled back, users:20240103120000 has a legacy
+	// rolled back record after its applied one
+	require.NoError(t, byRef["billing:20240104120000"].Down(ctx, db))
+	require.NoError(t, db.insertVersion(ctx, db, "users", "", 20240103120000, false))
+
+	for _, m := range migrations {
+		m.Record = &MigrationRecord{IsApplied: true}
+	}
+
+	require.NoError(t, db.LoadMigrations(ctx, migrations))
+
+	for _, m := range migrations {
+		want := m.Record
+		m.Record = nil
+		_, err := db.LoadMigration(ctx, m)
+		require.NoError(t, err)
+		assert.Equal(t, m.Record, want, "%s is loaded like LoadMigration does", m.ref())
+	}
+
+	assert.True(t, byRef["users:20240101120000"].Record.IsApplied)
+	assert.Equal(t, byRef["users:20240101120000"].Checksum(), byRef["users:20240101120000"].Record.Checksum)
+	assert.False(t, byRef["users:20240103120000"].Record.IsApplied)
+	assert.Nil(t, byRef["billing:20240104120000"].Record, "a stale record is reset")
+}
+
+func TestDB_LoadMigrations_ImportedBaseline(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrations := loadPlannerTestMigrations(t)
+
+	require.NoError(t, db.insertVersion(ctx, db, DefaultPackageName, baselineSourceFile, 20240102120000, true))
+	require.NoError(t, db.LoadMigrations(ctx, migrations))
+
+	if assert.NotNil(t, migrations[0].Record) {
+		assert.True(t, migrations[0].Record.IsApplied, "covered by the baseline")
+	}
+
+	assert.True(t, migrations[1].Record.IsApplied)
+	assert.Nil(t, migrations[2].Record)
+}
+
+func TestDB_Touch_CreatesVersionIndex(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	var name string
+	err := db.QueryRowContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ?`, TableName).Scan(&name)
+	require.NoError(t, err)
+	assert.Equal(t, versionIndex(TableName).Name, name)
+
+	latest, err := db.queryLatestVersion(ctx, CorePackageName)
+	require.NoError(t, err)
+	assert.Equal(t, coreMigrations[len(coreMigrations)-1].Version, latest)
+
+	// the core check runs once, a dropped version table is not recreated
+	_, err = db.ExecContext(ctx, "DROP TABLE "+TableName)
+	require.NoError(t, err)
+	require.NoError(t, db.Touch(ctx))
+
+	_, err = db.queryLatestVersion(ctx, CorePackageName)
+	assert.Error(t, err)
+}
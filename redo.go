@@ -2,12 +2,53 @@ package rockhopper
 
 import (
 	"context"
+	"errors"
+
+	log "github.com/sirupsen/logrus"
 )
 
+// Redo rolls back and re-applies m. The down and the up run in one
+// transaction when the database and the migration allow it, so a failed up
+// leaves m applied as it was. With SetAtomic, Redo returns
+// AtomicUnsupportedError instead of running them in two transactions.
 func Redo(ctx context.Context, db *DB, m *Migration) error {
-	if err := m.Down(ctx, db); err != nil {
+	redo := func() error {
+		if err := m.Down(ctx, db); err != nil {
+			return err
+		}
+
+		return m.Up(ctx, db)
+	}
+
+	if err := db.checkAtomic(m); err != nil {
+		if db.atomic {
+			return err
+		}
+
+		log.Debugf("redoing %s in two transactions: %v", m.location(), err)
+		return redo()
+	}
+
+	return db.runAtomic(ctx, redo)
+}
+
+// RedoPackage redoes the last applied migration of package pkgName. An empty
+// pkgName selects the only package of the migrations, see
+// MigrationSlice.ForPackage.
+func RedoPackage(ctx context.Context, db *DB, migrations MigrationSlice, pkgName string) error {
+	migrations, err := migrations.ForPackage(pkgName)
+	if err != nil {
 		return err
 	}
 
-	return m.Up(ctx, db)
+	_, lastAppliedMigration, err := db.FindLastAppliedMigration(ctx, migrations)
+	if err != nil {
+		return err
+	}
+
+	if lastAppliedMigration == nil {
+		return errors.New("no migration has been applied yet")
+	}
+
+	return Redo(ctx, db, lastAppliedMigration)
 }
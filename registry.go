@@ -18,7 +18,7 @@ type RegistryKey struct {
 var registeredGoMigrations = map[RegistryKey]*Migration{}
 
 // AddMigration registers a migration to the global map
-func AddMigration(up, down TransactionHandler) {
+func AddMigration(up, down TransactionHandler, opts ...MigrationOption) {
 	pc, filename, _, _ := runtime.Caller(1)
 
 	funcName := runtime.FuncForPC(pc).Name()
@@ -29,11 +29,11 @@ func AddMigration(up, down TransactionHandler) {
 
 	lastDot := strings.LastIndexByte(funcName[lastSlash:], '.') + lastSlash
 	packageName := funcName[:lastDot]
-	AddNamedMigration(packageName, filename, up, down)
+	AddNamedMigration(packageName, filename, up, down, opts...)
 }
 
 // AddNamedMigration registers a migration to the global map with a given name
-func AddNamedMigration(packageName, filename string, up, down TransactionHandler) {
+func AddNamedMigration(packageName, filename string, up, down TransactionHandler, opts ...MigrationOption) {
 	v, err := FileNumericComponent(filename)
 	if err != nil {
 		log.Panic(err)
@@ -50,6 +50,10 @@ func AddNamedMigration(packageName, filename string, up, down TransactionHandler
 		UseTx:   true,
 	}
 
+	for _, opt := range opts {
+		opt(migration)
+	}
+
 	key := RegistryKey{Package: packageName, Version: v}
 	if existing, ok := registeredGoMigrations[key]; ok {
 		panic(fmt.Sprintf("failed to add migration %q: version conflicts with %q", filename, existing.Source))
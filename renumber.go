@@ -0,0 +1,197 @@
+package rockhopper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Rename describes one migration file that renumber moves to a new version.
+type Rename struct {
+	Migration *Migration
+
+	OldVersion, NewVersion int64
+	OldSource, NewSource   string
+
+	// OldDownSource and NewDownSource are set for a migration in the two-file
+	// layout, whose .down.sql file is renamed too.
+	OldDownSource, NewDownSource string
+}
+
+// PlanRenumber finds, for each package, the pending migrations whose version is
+// below the highest applied version (see OutOfOrderError) and assigns them
+// fresh timestamp versions above every known migration, keeping their relative
+// order. The first new version is now, or one second after the highest known
+// version when that is later. The database is only read.
+func PlanRenumber(ctx context.Context, db *DB, migrations MigrationSlice, now time.Time) ([]Rename, error) {
+	var highest int64
+	for _, m := range migrations {
+		if m.Version > highest {
+			highest = m.Version
+		}
+	}
+
+	next := now.Truncate(time.Second)
+	if t, err := time.ParseInLocation(VersionIdTimestampFormat, strconv.FormatInt(highest, 10), now.Location()); err == nil && !next.After(t) {
+		next = t.Add(time.Second)
+	}
+
+	migrationMap := migrations.MapByPackage()
+
+	var pkgNames []string
+	for pkgName := range migrationMap {
+		pkgNames = append(pkgNames, pkgName)
+	}
+	sort.Strings(pkgNames)
+
+	var renames []Rename
+	for _, pkgName := range pkgNames {
+		pkgMigrations := migrationMap[pkgName].Sort()
+
+		status, err := db.InspectMigrations(ctx, pkgMigrations)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range status.OutOfOrder {
+			if m.Registered {
+				return nil, fmt.Errorf("can not renumber registered go migration %s, rename it by hand", m.location())
+			}
+
+			newVersion, err := strconv.ParseInt(next.Format(VersionIdTimestampFormat), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			next = next.Add(time.Second)
+
+			rename := Rename{
+				Migration:  m,
+				OldVersion: m.Version,
+				NewVersion: newVersion,
+				OldSource:  m.Source,
+				NewSource:  renumberedSource(m.Source, m.Version, newVersion),
+			}
+
+			if m.DownSource != "" {
+				rename.OldDownSource = m.DownSource
+				rename.NewDownSource = renumberedSource(m.DownSource, m.Version, newVersion)
+			}
+
+			renames = append(renames, rename)
+		}
+	}
+
+	return renames, nil
+}
+
+// renumberedSource replaces the version prefix of a migration filename.
+func renumberedSource(source string, oldVersion, newVersion int64) string {
+	base := strings.Replace(filepath.Base(source), strconv.FormatInt(oldVersion, 10), strconv.FormatInt(newVersion, 10), 1)
+	return filepath.Join(filepath.Dir(source), base)
+}
+
+// ApplyRenumber renames the migration files planned by PlanRenumber and updates
+// the migrations in place. When dumper is not nil, the compiled go files of the
+// renamed migrations are regenerated under their new names. When a step fails,
+// the files renamed, removed or compiled before it and the migrations are
+// restored, so that a failed renumber leaves the directory as it found it.
+func ApplyRenumber(renames []Rename, dumper *GoMigrationDumper) (err error) {
+	// a taken name stops the renumber before any file is moved
+	for _, r := range renames {
+		if _, err := os.Stat(r.NewSource); err == nil {
+			return fmt.Errorf("failed to renumber %s: %s already exists", r.OldSource, r.NewSource)
+		}
+
+		if r.OldDownSource != "" {
+			if _, err := os.Stat(r.NewDownSource); err == nil {
+				return fmt.Errorf("failed to renumber %s: %s already exists", r.OldDownSource, r.NewDownSource)
+			}
+		}
+	}
+
+	var undo fileUndo
+	defer func() {
+		if err != nil {
+			undo.revert("renumber")
+		}
+	}()
+
+	rename := func(from, to string) error {
+		if err := os.Rename(from, to); err != nil {
+			return errors.Wrapf(err, "failed to renumber %s", from)
+		}
+
+		undo.push(func() error { return os.Rename(to, from) })
+		return nil
+	}
+
+	for _, r := range renames {
+		m := r.Migration
+		version, source, downSource := m.Version, m.Source, m.DownSource
+		undo.push(func() error {
+			m.Version, m.Source, m.DownSource = version, source, downSource
+			return nil
+		})
+
+		var oldGoFile string
+		if dumper != nil {
+			oldGoFile = dumper.MigrationFilename(m)
+		}
+
+		if err := rename(r.OldSource, r.NewSource); err != nil {
+			return err
+		}
+
+		if r.OldDownSource != "" {
+			if err := rename(r.OldDownSource, r.NewDownSource); err != nil {
+				return err
+			}
+
+			m.DownSource = r.NewDownSource
+		}
+
+		m.Version = r.NewVersion
+		m.Source = r.NewSource
+
+		if dumper == nil {
+			continue
+		}
+
+		compiled, err := os.ReadFile(oldGoFile)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to read compiled migration %s", oldGoFile)
+		}
+
+		if err := os.Remove(oldGoFile); err != nil {
+			return errors.Wrapf(err, "failed to remove compiled migration %s", oldGoFile)
+		}
+
+		undo.push(func() error { return os.WriteFile(oldGoFile, compiled, 0644) })
+
+		// a failed dump may leave the new file behind
+		newGoFile := dumper.MigrationFilename(m)
+		undo.push(func() error {
+			if err := os.Remove(newGoFile); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			return nil
+		})
+
+		if err := dumper.DumpMigration(m); err != nil {
+			return errors.Wrapf(err, "failed to compile renumbered migration %s", r.NewSource)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package rockhopper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenumber(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "migrations")
+	require.NoError(t, os.MkdirAll(outputDir, 0755))
+
+	writeTestMigrationFile(t, dir, "20240101000000_a.sql",
+		"-- +up\nCREATE TABLE a (id INT);\n-- +down\nDROP TABLE a;\n")
+	writeTestMigrationFile(t, dir, "20240102000000_b.sql",
+		"-- +up\nCREATE TABLE b (id INT);\n-- +down\nDROP TABLE b;\n")
+	writeTestMigrationFile(t, dir, "20240102120000_c.sql",
+		"-- +up\nCREATE TABLE c (id INT);\n-- +down\nDROP TABLE c;\n")
+	writeTestMigrationFile(t, dir, "20240103000000_d.sql",
+		"-- +up\nCREATE TABLE d (id INT);\n-- +down\nDROP TABLE d;\n")
+
+	loader := &SqlMigrationLoader{}
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+	require.Len(t, migrations, 4)
+
+	dumper := &GoMigrationDumper{Dir: outputDir}
+	require.NoError(t, dumper.Dump(migrations))
+
+	// b and c were merged in from another branch after d had been applied
+	db := openTestDB(t)
+	require.NoError(t, UpMigrations(ctx, db, MigrationSlice{migrations[0], migrations[3]}))
+
+	// a clock behind the highest version must not produce versions below it
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	renames, err := PlanRenumber(ctx, db, migrations, now)
+	require.NoError(t, err)
+	require.Len(t, renames, 2)
+
+	assert.Equal(t, int64(20240102000000), renames[0].OldVersion)
+	assert.Equal(t, int64(20240103000001), renames[0].NewVersion)
+	assert.Equal(t, filepath.Join(dir, "20240103000001_b.sql"), renames[0].NewSource)
+	assert.Equal(t, int64(20240102120000), renames[1].OldVersion)
+	assert.Equal(t, int64(20240103000002), renames[1].NewVersion, "relative order is kept")
+
+	require.NoError(t, ApplyRenumber(renames, dumper))
+
+	assert.NoFileExists(t, filepath.Join(dir, "20240102000000_b.sql"))
+	assert.FileExists(t, filepath.Join(dir, "20240103000001_b.sql"))
+	assert.NoFileExists(t, filepath.Join(outputDir, "main_20240102000000_b.go"))
+	assert.FileExists(t, filepath.Join(outputDir, "main_20240103000001_b.go"))
+
+	reloaded, err := loader.Load(dir)
+	require.NoError(t, err)
+	reloaded = reloaded.SortAndConnect()
+
+	status, err := db.InspectMigrations(ctx, reloaded)
+	require.NoError(t, err)
+	assert.Empty(t, status.OutOfOrder)
+	assert.Equal(t, []int64{20240103000001, 20240103000002}, status.Pending.Versions())
+}
+
+func TestApplyRenumber_RevertsOnFailure(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "migrations")
+	require.NoError(t, os.MkdirAll(outputDir, 0755))
+
+	writeTestMigrationFile(t, dir, "20240101000000_a.sql",
+		"-- +up\nCREATE TABLE a (id INT);\n-- +down\nDROP TABLE a;\n")
+	writeTestMigrationFile(t, dir, "20240102000000_b.sql",
+		"-- +up\nCREATE TABLE b (id INT);\n-- +down\nDROP TABLE b;\n")
+	writeTestMigrationFile(t, dir, "20240102120000_c.sql",
+		"-- +up\nCREATE TABLE c (id INT);\n-- +down\nDROP TABLE c;\n")
+	writeTestMigrationFile(t, dir, "20240103000000_d.sql",
+		"-- +up\nCREATE TABLE d (id INT);\n-- +down\nDROP TABLE d;\n")
+
+	migrations, err := (&SqlMigrationLoader{}).Load(dir)
+	require.NoError(t, err)
+
+	dumper := &GoMigrationDumper{Dir: outputDir}
+	require.NoError(t, dumper.Dump(migrations))
+
+	db := openTestDB(t)
+	require.NoError(t, UpMigrations(ctx, db, MigrationSlice{migrations[0], migrations[3]}))
+
+	renames, err := PlanRenumber(ctx, db, migrations, time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local))
+	require.NoError(t, err)
+	require.Len(t, renames, 2)
+
+	compiledB, err := os.ReadFile(filepath.Join(outputDir, "main_20240102000000_b.go"))
+	require.NoError(t, err)
+
+	// c goes away after the plan, its rename fails after b was renumbered
+	require.NoError(t, os.Remove(renames[1].OldSource))
+
+	assert.ErrorContains(t, ApplyRenumber(renames, dumper), "failed to renumber "+renames[1].OldSource)
+
+	assert.FileExists(t, filepath.Join(dir, "20240102000000_b.sql"))
+	assert.NoFileExists(t, filepath.Join(dir, "20240103000001_b.sql"))
+	assert.NoFileExists(t, filepath.Join(outputDir, "main_20240103000001_b.go"))
+
+	restored, err := os.ReadFile(filepath.Join(outputDir, "main_20240102000000_b.go"))
+	require.NoError(t, err)
+	assert.Equal(t, compiledB, restored)
+
+	assert.Equal(t, int64(20240102000000), renames[0].Migration.Version)
+	assert.Equal(t, renames[0].OldSource, renames[0].Migration.Source)
+}
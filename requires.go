@@ -0,0 +1,251 @@
+package rockhopper
+
+import (
+	"container/heap"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationRef identifies a migration of a package.
+type MigrationRef struct {
+	Package string
+	Version int64
+}
+
+func (r MigrationRef) String() string {
+	return fmt.Sprintf("%s:%d", r.Package, r.Version)
+}
+
+func (m *Migration) ref() MigrationRef {
+	return MigrationRef{Package: m.Package, Version: m.Version}
+}
+
+// MigrationOption configures a registered Go migration.
+type MigrationOption func(m *Migration)
+
+// Requires declares that the migration runs after the migration version of
+// package pkgName, like the "-- @requires pkg:version" annotation.
+func Requires(pkgName string, version int64) MigrationOption {
+	return func(m *Migration) {
+		m.Requires = append(m.Requires, MigrationRef{Package: pkgName, Version: version})
+	}
+}
+
+var requiresRefRegExp = regexp.MustCompile(`^(?:([\w.\-/]+):)?(\d+)$`)
+
+// matchRequires parses the migrations of a "-- @requires pkg:version ..."
+// annotation. A version without a package refers to the package of the
+// migration, which is filled in by the loader.
+func matchRequires(line string) ([]MigrationRef, error) {
+	_, args, _ := strings.Cut(line, "@requires")
+
+	fields := strings.FieldsFunc(args, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(fields) == 0 {
+		return nil, errors.New("required migration not found")
+	}
+
+	var refs []MigrationRef
+	for _, field := range fields {
+		matches := requiresRefRegExp.FindStringSubmatch(field)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid required migration %q, expecting <package>:<version>", field)
+		}
+
+		version, err := strconv.ParseInt(matches[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		refs = append(refs, MigrationRef{Package: matches[1], Version: version})
+	}
+
+	return refs, nil
+}
+
+// UnmetRequirementError is returned when a migration to apply requires a
+// migration that is neither applied nor planned before it.
+type UnmetRequirementError struct {
+	Migration *Migration
+	Requires  MigrationRef
+}
+
+func (e *UnmetRequirementError) Error() string {
+	return fmt.Sprintf("migration %s requires %s, which is neither applied nor part of this run",
+		e.Migration.location(), e.Requires)
+}
+
+// RequiredMigrationError is returned when a migration to roll back is required
+// by an applied migration that is not rolled back.
+type RequiredMigrationError struct {
+	Migration  MigrationRef
+	RequiredBy *Migration
+}
+
+func (e *RequiredMigrationError) Error() string {
+	return fmt.Sprintf("migration %s can not be rolled back, the applied migration %s requires it; roll that one back first",
+		e.Migration, e.RequiredBy.location())
+}
+
+// DependencyCycleError is returned when migrations require each other, through
+// their requirements and the version order of their packages.
+type DependencyCycleError struct {
+	// Cycle lists the migrations of the cycle, each one runs after the next,
+	// and the last one after the first.
+	Cycle MigrationSlice
+}
+
+func (e *DependencyCycleError) Error() string {
+	var refs []string
+	for _, m := range e.Cycle {
+		refs = append(refs, m.ref().String())
+	}
+
+	refs = append(refs, e.Cycle[0].ref().String())
+
+	return fmt.Sprintf("migration dependency cycle, each migration runs after the next one: %s; remove one of the '-- @requires' annotations",
+		strings.Join(refs, " -> "))
+}
+
+// sortByRequires orders the migrations so that each one comes after the lower
+// versions of its package and after the migrations it requires. Among the
+// migrations that can come next the lowest version goes first, so migrations
+// without requirements keep their version order.
+func sortByRequires(migrations MigrationSlice) (MigrationSlice, error) {
+	index := make(map[MigrationRef]int, len(migrations))
+	for i, m := range migrations {
+		index[m.ref()] = i
+	}
+
+	// after[i] are the migrations that migration i runs after
+	after := make([][]int, len(migrations))
+
+	byPackage := map[string][]int{}
+	for i, m := range migrations {
+		byPackage[m.Package] = append(byPackage[m.Package], i)
+
+		for _, req := range m.Requires {
+			if j, ok := index[req]; ok {
+				after[i] = append(after[i], j)
+			}
+		}
+	}
+
+	for _, indexes := range byPackage {
+		sort.Slice(indexes, func(a, b int) bool {
+			return migrations[indexes[a]].Version < migrations[indexes[b]].Version
+		})
+
+		for k := 1; k < len(indexes); k++ {
+			after[indexes[k]] = append(after[indexes[k]], indexes[k-1])
+		}
+	}
+
+	waiting := make([]int, len(migrations))
+	before := make([][]int, len(migrations))
+	for i, deps := range after {
+		waiting[i] = len(deps)
+		for _, j := range deps {
+			before[j] = append(before[j], i)
+		}
+	}
+
+	ready := &migrationHeap{migrations: migrations}
+	for i := range migrations {
+		if waiting[i] == 0 {
+			ready.indexes = append(ready.indexes, i)
+		}
+	}
+
+	heap.Init(ready)
+
+	sorted := make(MigrationSlice, 0, len(migrations))
+	for ready.Len() > 0 {
+		i := heap.Pop(ready).(int)
+		sorted = append(sorted, migrations[i])
+
+		for _, j := range before[i] {
+			waiting[j]--
+			if waiting[j] == 0 {
+				heap.Push(ready, j)
+			}
+		}
+	}
+
+	if len(sorted) < len(migrations) {
+		return nil, &DependencyCycleError{Cycle: findCycle(migrations, after, waiting)}
+	}
+
+	return sorted, nil
+}
+
+// findCycle walks the migrations left waiting by sortByRequires, each of them
+// waits for another waiting one, until it reaches a migration twice.
+func findCycle(migrations MigrationSlice, after [][]int, waiting []int) MigrationSlice {
+	start := -1
+	for i := range migrations {
+		if waiting[i] > 0 {
+			start = i
+			break
+		}
+	}
+
+	visited := map[int]int{}
+	var path []int
+	for i := start; ; {
+		if pos, ok := visited[i]; ok {
+			path = path[pos:]
+			break
+		}
+
+		visited[i] = len(path)
+		path = append(path, i)
+
+		for _, j := range after[i] {
+			if waiting[j] > 0 {
+				i = j
+				break
+			}
+		}
+	}
+
+	var cycle MigrationSlice
+	for _, i := range path {
+		cycle = append(cycle, migrations[i])
+	}
+
+	return cycle
+}
+
+// migrationHeap pops the migration with the lowest version, then package name.
+type migrationHeap struct {
+	migrations MigrationSlice
+	indexes    []int
+}
+
+func (h *migrationHeap) Len() int { return len(h.indexes) }
+
+func (h *migrationHeap) Less(a, b int) bool {
+	ma, mb := h.migrations[h.indexes[a]], h.migrations[h.indexes[b]]
+	if ma.Version != mb.Version {
+		return ma.Version < mb.Version
+	}
+
+	return ma.Package < mb.Package
+}
+
+func (h *migrationHeap) Swap(a, b int) { h.indexes[a], h.indexes[b] = h.indexes[b], h.indexes[a] }
+
+func (h *migrationHeap) Push(x any) { h.indexes = append(h.indexes, x.(int)) }
+
+func (h *migrationHeap) Pop() any {
+	i := h.indexes[len(h.indexes)-1]
+	h.indexes = h.indexes[:len(h.indexes)-1]
+	return i
+}
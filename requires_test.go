@@ -0,0 +1,154 @@
+package rockhopper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_matchRequires(t *testing.T) {
+	refs, err := matchRequires("@requires users:20240116231445, billing:20240101000000 20240102000000")
+	require.NoError(t, err)
+	assert.Equal(t, []MigrationRef{
+		{Package: "users", Version: 20240116231445},
+		{Package: "billing", Version: 20240101000000},
+		{Package: "", Version: 20240102000000},
+	}, refs)
+
+	_, err = matchRequires("@requires")
+	assert.Error(t, err)
+
+	_, err = matchRequires("@requires users:latest")
+	assert.Error(t, err)
+}
+
+func TestSqlMigrationLoader_Requires(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_create_invoices.sql",
+		"-- @package billing\n-- @requires users:20240102120000\n-- @requires 20231201000000\n-- +up\nCREATE TABLE invoices (id INT);\n-- +down\nDROP TABLE invoices;\n")
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+	assert.Equal(t, []MigrationRef{
+		{Package: "users", Version: 20240102120000},
+		{Package: "billing", Version: 20231201000000},
+	}, migrations[0].Requires, "a version without a package is in the package of the migration")
+}
+
+func loadRequiresTestMigrations(t *testing.T, files map[string]string) MigrationSlice {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		writeTestMigrationFile(t, dir, name, content)
+	}
+
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+	return migrations
+}
+
+func planRefs(plan *Plan) (refs []string) {
+	for _, s := range plan.Steps {
+		refs = append(refs, MigrationRef{Package: s.Package, Version: s.Version}.String())
+	}
+
+	return refs
+}
+
+func TestPlanner_Requires(t *testing.T) {
+	ctx := context.Background()
+
+	// billing has the lower version, but its foreign key needs the users table
+	migrations := loadRequiresTestMigrations(t, map[string]string{
+		"20240101120000_create_invoices.sql": "-- @package billing\n-- @requires users:20240102120000\n-- +up\nCREATE TABLE invoices (id INT, user_id INT REFERENCES users (id));\n-- +down\nDROP TABLE invoices;\n",
+		"20240102120000_create_users.sql":    "-- @package users\n-- +up\nCREATE TABLE users (id INT PRIMARY KEY);\n-- +down\nDROP TABLE users;\n",
+		"20240103120000_create_refunds.sql":  "-- @package billing\n-- +up\nCREATE TABLE refunds (id INT);\n-- +down\nDROP TABLE refunds;\n",
+	})
+
+	t.Run("up runs the required migration first", func(t *testing.T) {
+		db := openTestDB(t)
+
+		plan, err := NewPlanner(db, migrations).PlanUp(ctx, 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"users:20240102120000", "billing:20240101120000", "billing:20240103120000"}, planRefs(plan))
+	})
+
+	t.Run("a requirement neither applied nor planned", func(t *testing.T) {
+		db := openTestDB(t)
+
+		var unmetErr *UnmetRequirementError
+		_, err := NewPlanner(db, migrations.FilterPackage([]string{"billing"})).PlanUp(ctx, 0, 0)
+		if assert.ErrorAs(t, err, &unmetErr) {
+			assert.Equal(t, MigrationRef{Package: "users", Version: 20240102120000}, unmetErr.Requires)
+		}
+
+		require.NoError(t, Upgrade(ctx, db, migrations.FilterPackage([]string{"users"})))
+
+		plan, err := NewPlanner(db, migrations.FilterPackage([]string{"billing"})).PlanUp(ctx, 0, 0)
+		require.NoError(t, err, "the requirement is applied")
+		assert.Equal(t, []string{"billing:20240101120000", "billing:20240103120000"}, planRefs(plan))
+	})
+
+	t.Run("down rolls back in reverse dependency order", func(t *testing.T) {
+		db := openTestDB(t)
+		require.NoError(t, Upgrade(ctx, db, migrations))
+
+		planner := NewPlanner(db, migrations)
+
+		plan, err := planner.PlanDownAll(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"billing:20240103120000", "billing:20240101120000", "users:20240102120000"}, planRefs(plan))
+
+		var requiredErr *RequiredMigrationError
+		_, err = planner.PlanAlign(ctx, "users", 0)
+		if assert.ErrorAs(t, err, &requiredErr) {
+			assert.Equal(t, "billing", requiredErr.RequiredBy.Package)
+		}
+
+		require.NoError(t, Align(ctx, db, 0, migrations.FilterPackage([]string{"billing"})))
+
+		plan, err = planner.PlanAlign(ctx, "users", 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"users:20240102120000"}, planRefs(plan))
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		db := openTestDB(t)
+
+		cyclic := loadRequiresTestMigrations(t, map[string]string{
+			"20240101120000_create_invoices.sql": "-- @package billing\n-- @requires users:20240102120000\n-- +up\nSELECT 1;\n-- +down\nSELECT 1;\n",
+			"20240102120000_create_users.sql":    "-- @package users\n-- +up\nSELECT 1;\n-- +down\nSELECT 1;\n",
+			"20240103120000_add_user_plan.sql":   "-- @package users\n-- @requires billing:20240101120000\n-- +up\nSELECT 1;\n-- +down\nSELECT 1;\n",
+			"20240104120000_create_plans.sql":    "-- @package billing\n-- +up\nSELECT 1;\n-- +down\nSELECT 1;\n",
+		})
+
+		// billing:20240101120000 needs users:20240102120000, which needs nothing;
+		// users:20240103120000 needs billing:20240101120000; no cycle yet
+		_, err := NewPlanner(db, cyclic).PlanUp(ctx, 0, 0)
+		require.NoError(t, err)
+
+		cyclic[0].Requires = append(cyclic[0].Requires, MigrationRef{Package: "users", Version: 20240103120000})
+
+		var cycleErr *DependencyCycleError
+		_, err = NewPlanner(db, cyclic).PlanUp(ctx, 0, 0)
+		if assert.ErrorAs(t, err, &cycleErr) {
+			assert.Len(t, cycleErr.Cycle, 2)
+			assert.Contains(t, err.Error(), "billing:20240101120000 -> users:20240103120000 -> billing:20240101120000")
+		}
+	})
+}
+
+func TestAddNamedMigration_Requires(t *testing.T) {
+	key := RegistryKey{Package: "requires_test", Version: 20240101120000}
+	t.Cleanup(func() { delete(registeredGoMigrations, key) })
+
+	AddNamedMigration(key.Package, "20240101120000_create_invoices.go", nil, nil, Requires("users", 20240102120000))
+
+	assert.Equal(t, []MigrationRef{{Package: "users", Version: 20240102120000}}, registeredGoMigrations[key].Requires)
+}
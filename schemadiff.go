@@ -0,0 +1,486 @@
+package rockhopper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/c9s/rockhopper/v2/pkg/dialect"
+)
+
+// DefaultSchemaDiffName is the descriptive name of a generated schema diff
+// migration file when none is given.
+const DefaultSchemaDiffName = "schema_diff"
+
+// internalTableNames are the tables managed by rockhopper or the database
+// itself, which the schema inspection skips.
+var internalTableNames = map[string]bool{
+	TableName:              true,
+	ProgressTableName:      true,
+	MigrationLogTableName:  true,
+	DataMigrationTableName: true,
+	legacyGooseTableName:   true,
+	"sqlite_sequence":      true,
+}
+
+// InspectSchema reads the tables, columns, indexes and foreign keys of the
+// database through the dialect's catalog queries. The tables are sorted by
+// name, and rockhopper's own tables are skipped.
+func (db *DB) InspectSchema(ctx context.Context) ([]dialect.TableDef, error) {
+	introspector, ok := db.dialect.(dialect.Introspector)
+	if !ok {
+		return nil, fmt.Errorf("schema introspection is not supported by the %s driver", db.driverName)
+	}
+
+	tableNames, err := db.getTableNames(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list tables")
+	}
+
+	sort.Strings(tableNames)
+
+	var tables []dialect.TableDef
+	for _, tableName := range tableNames {
+		if internalTableNames[tableName] {
+			continue
+		}
+
+		table, err := db.inspectTable(ctx, introspector, tableName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to inspect table %s", tableName)
+		}
+
+		tables = append(tables, *table)
+	}
+
+	return tables, nil
+}
+
+func (db *DB) inspectTable(ctx context.Context, introspector dialect.Introspector, tableName string) (*dialect.TableDef, error) {
+	table := &dialect.TableDef{Name: tableName}
+
+	err := db.queryRows(ctx, introspector.ColumnsQuery(), tableName, func(rows *sql.Rows) error {
+		var c dialect.ColumnDef
+		var def sql.NullString
+		if err := rows.Scan(&c.Name, &c.Type, &c.NotNull, &def, &c.PrimaryKey); err != nil {
+			return err
+		}
+
+		c.Default, c.HasDefault = def.String, def.Valid
+		table.Columns = append(table.Columns, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.queryRows(ctx, introspector.IndexesQuery(), tableName, func(rows *sql.Rows) error {
+		var name, column string
+		var unique bool
+		if err := rows.Scan(&name, &unique, &column); err != nil {
+			return err
+		}
+
+		if n := len(table.Indexes); n > 0 && table.Indexes[n-1].Name == name {
+			table.Indexes[n-1].Columns = append(table.Indexes[n-1].Columns, column)
+		} else {
+			table.Indexes = append(table.Indexes, dialect.IndexDef{Name: name, Unique: unique, Columns: []string{column}})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.queryRows(ctx, introspector.ForeignKeysQuery(), tableName, func(rows *sql.Rows) error {
+		var name, column, refTable, refColumn string
+		if err := rows.Scan(&name, &column, &refTable, &refColumn); err != nil {
+			return err
+		}
+
+		if n := len(table.ForeignKeys); n > 0 && table.ForeignKeys[n-1].Name == name {
+			fk := &table.ForeignKeys[n-1]
+			fk.Columns = append(fk.Columns, column)
+			fk.RefColumns = append(fk.RefColumns, refColumn)
+		} else {
+			table.ForeignKeys = append(table.ForeignKeys, dialect.ForeignKeyDef{
+				Name:       name,
+				Columns:    []string{column},
+				RefTable:   refTable,
+				RefColumns: []string{refColumn},
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+func (db *DB) queryRows(ctx context.Context, q string, arg any, scan func(rows *sql.Rows) error) error {
+	rows, err := db.QueryContext(ctx, q, arg)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ExecSchemaFile executes the DDL statements of a plain .sql file, e.g. the
+// desired state of a schema diff applied to a scratch database. The file uses
+// the migration statement syntax without the -- +up / -- +down annotations.
+func (db *DB) ExecSchemaFile(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	parser := MigrationParser{Dialect: db.driverName}
+	chunk, err := parser.ParseString("-- +up\n" + string(data))
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse schema file %s", path)
+	}
+
+	for i, stmt := range chunk.UpStmts {
+		if isNoOpSQL(stmt.SQL) {
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, stmt.SQL); err != nil {
+			// the line numbers count the -- +up line prepended above
+			return errors.Wrapf(err, "failed to execute statement #%d at %s:%d", i+1, path, stmt.Line-1)
+		}
+	}
+
+	return nil
+}
+
+// SchemaDiff holds the statements that turn one schema into another, and the
+// statements that turn it back.
+type SchemaDiff struct {
+	Up   []string
+	Down []string
+
+	// Warnings lists the changes the dialect can not apply in place, which are
+	// left out of the statements.
+	Warnings []string
+}
+
+// Empty reports whether there is no statement to run, i.e. the schemas are the
+// same apart from the changes reported in Warnings.
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Up) == 0
+}
+
+// Template returns a migration template with the diff statements for
+// CreateWithTemplate.
+func (d *SchemaDiff) Template() *template.Template {
+	return template.Must(template.New("schema-diff.sql-migration").Funcs(template.FuncMap{
+		"up":       func() []string { return d.Up },
+		"down":     func() []string { return d.Down },
+		"warnings": func() []string { return d.Warnings },
+	}).Parse(schemaDiffMigrationTemplate))
+}
+
+const schemaDiffMigrationTemplate = `{{range warnings}}-- WARNING: {{.}}
+{{end}}-- +up
+{{range up}}{{.}};
+{{end}}
+-- +down
+{{range down}}{{.}};
+{{end}}`
+
+// schemaChange is one up step and the steps that undo it. The down steps of
+// every change are run in reverse change order.
+type schemaChange struct {
+	up, down []string
+}
+
+// DiffSchema computes the statements that turn the current schema into the
+// desired one with the DDL of the given dialect.
+func DiffSchema(d SQLDialect, current, desired []dialect.TableDef) (*SchemaDiff, error) {
+	alterer, ok := d.(dialect.SchemaAlterer)
+	if !ok {
+		return nil, errors.New("schema diff is not supported by this dialect")
+	}
+
+	diff := &SchemaDiff{}
+	currentTables := mapTableDefs(current)
+	desiredTables := mapTableDefs(desired)
+
+	var createdTables, droppedTables []dialect.TableDef
+	var fkDrops, indexDrops, columnAdds, columnAlters, columnDrops, indexCreates, fkAdds []schemaChange
+
+	for _, want := range desired {
+		have, ok := currentTables[want.Name]
+		if !ok {
+			createdTables = append(createdTables, want)
+			continue
+		}
+
+		haveColumns := mapColumnDefs(have.Columns)
+		wantColumns := mapColumnDefs(want.Columns)
+
+		for _, c := range want.Columns {
+			hc, ok := haveColumns[c.Name]
+			if !ok {
+				columnAdds = append(columnAdds, schemaChange{
+					up:   []string{alterer.AddColumnDef(want.Name, c)},
+					down: []string{alterer.DropColumn(want.Name, c.Name)},
+				})
+				continue
+			}
+
+			if hc.PrimaryKey != c.PrimaryKey {
+				diff.Warnings = append(diff.Warnings, fmt.Sprintf("primary key of table %s changed, it can not be altered in place", want.Name))
+			}
+
+			if columnDefEqual(hc, c) {
+				continue
+			}
+
+			up, supported := alterer.AlterColumn(want.Name, hc, c)
+			down, _ := alterer.AlterColumn(want.Name, c, hc)
+			if !supported {
+				diff.Warnings = append(diff.Warnings, fmt.Sprintf("column %s.%s changed from %q to %q, it can not be altered in place", want.Name, c.Name, columnSignature(hc), columnSignature(c)))
+				continue
+			}
+
+			columnAlters = append(columnAlters, schemaChange{up: up, down: down})
+		}
+
+		for _, c := range have.Columns {
+			if _, ok := wantColumns[c.Name]; !ok {
+				columnDrops = append(columnDrops, schemaChange{
+					up:   []string{alterer.DropColumn(have.Name, c.Name)},
+					down: []string{alterer.AddColumnDef(have.Name, c)},
+				})
+			}
+		}
+
+		haveIndexes := mapIndexDefs(have.Indexes)
+		wantIndexes := mapIndexDefs(want.Indexes)
+
+		for _, idx := range have.Indexes {
+			if w, ok := wantIndexes[idx.Name]; !ok || !indexDefEqual(idx, w) {
+				indexDrops = append(indexDrops, schemaChange{
+					up:   []string{alterer.DropIndex(have.Name, idx.Name)},
+					down: []string{alterer.CreateIndex(have.Name, idx)},
+				})
+			}
+		}
+
+		for _, idx := range want.Indexes {
+			if h, ok := haveIndexes[idx.Name]; !ok || !indexDefEqual(h, idx) {
+				indexCreates = append(indexCreates, schemaChange{
+					up:   []string{alterer.CreateIndex(want.Name, idx)},
+					down: []string{alterer.DropIndex(want.Name, idx.Name)},
+				})
+			}
+		}
+
+		// foreign keys are matched by what they reference, SQLite does not name them
+		haveFKs := mapForeignKeyDefs(have.ForeignKeys)
+		wantFKs := mapForeignKeyDefs(want.ForeignKeys)
+
+		for _, fk := range have.ForeignKeys {
+			if _, ok := wantFKs[foreignKeySignature(fk)]; ok {
+				continue
+			}
+
+			up, supported := alterer.DropForeignKey(have.Name, fk)
+			down, _ := alterer.AddForeignKey(have.Name, fk)
+			if !supported {
+				diff.Warnings = append(diff.Warnings, fmt.Sprintf("foreign key %s of table %s was removed, it can not be dropped in place", foreignKeySignature(fk), have.Name))
+				continue
+			}
+
+			fkDrops = append(fkDrops, schemaChange{up: []string{up}, down: []string{down}})
+		}
+
+		for _, fk := range want.ForeignKeys {
+			if _, ok := haveFKs[foreignKeySignature(fk)]; ok {
+				continue
+			}
+
+			up, supported := alterer.AddForeignKey(want.Name, fk)
+			down, _ := alterer.DropForeignKey(want.Name, fk)
+			if !supported {
+				diff.Warnings = append(diff.Warnings, fmt.Sprintf("foreign key %s of table %s was added, it can not be added in place", foreignKeySignature(fk), want.Name))
+				continue
+			}
+
+			fkAdds = append(fkAdds, schemaChange{up: []string{up}, down: []string{down}})
+		}
+	}
+
+	for _, have := range current {
+		if _, ok := desiredTables[have.Name]; !ok {
+			droppedTables = append(droppedTables, have)
+		}
+	}
+
+	var changes []schemaChange
+	changes = append(changes, fkDrops...)
+	changes = append(changes, indexDrops...)
+
+	// referenced tables are created first and dropped last
+	for _, t := range sortTableDefsByReference(createdTables) {
+		changes = append(changes, schemaChange{
+			up:   createTableStatements(alterer, t),
+			down: []string{alterer.DropTable(t.Name)},
+		})
+	}
+
+	changes = append(changes, columnAdds...)
+	changes = append(changes, columnAlters...)
+	changes = append(changes, columnDrops...)
+	changes = append(changes, indexCreates...)
+	changes = append(changes, fkAdds...)
+
+	sortedDrops := sortTableDefsByReference(droppedTables)
+	for i := len(sortedDrops) - 1; i >= 0; i-- {
+		t := sortedDrops[i]
+		changes = append(changes, schemaChange{
+			up:   []string{alterer.DropTable(t.Name)},
+			down: createTableStatements(alterer, t),
+		})
+	}
+
+	for _, c := range changes {
+		diff.Up = append(diff.Up, c.up...)
+	}
+
+	for i := len(changes) - 1; i >= 0; i-- {
+		diff.Down = append(diff.Down, changes[i].down...)
+	}
+
+	return diff, nil
+}
+
+func createTableStatements(alterer dialect.SchemaAlterer, t dialect.TableDef) []string {
+	stmts := []string{alterer.CreateTableDef(t)}
+	for _, idx := range t.Indexes {
+		stmts = append(stmts, alterer.CreateIndex(t.Name, idx))
+	}
+	return stmts
+}
+
+// sortTableDefsByReference orders the tables so that a table comes after the
+// tables it references. Tables in a reference cycle keep their name order.
+func sortTableDefsByReference(tables []dialect.TableDef) []dialect.TableDef {
+	pending := mapTableDefs(tables)
+	sorted := make([]dialect.TableDef, 0, len(tables))
+
+	for len(pending) > 0 {
+		progressed := false
+		for _, t := range tables {
+			if _, ok := pending[t.Name]; !ok {
+				continue
+			}
+
+			ready := true
+			for _, fk := range t.ForeignKeys {
+				if _, waiting := pending[fk.RefTable]; waiting && fk.RefTable != t.Name {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				sorted = append(sorted, t)
+				delete(pending, t.Name)
+				progressed = true
+			}
+		}
+
+		if !progressed {
+			for _, t := range tables {
+				if _, ok := pending[t.Name]; ok {
+					sorted = append(sorted, t)
+					delete(pending, t.Name)
+				}
+			}
+		}
+	}
+
+	return sorted
+}
+
+func mapTableDefs(tables []dialect.TableDef) map[string]dialect.TableDef {
+	m := make(map[string]dialect.TableDef, len(tables))
+	for _, t := range tables {
+		m[t.Name] = t
+	}
+	return m
+}
+
+func mapColumnDefs(columns []dialect.ColumnDef) map[string]dialect.ColumnDef {
+	m := make(map[string]dialect.ColumnDef, len(columns))
+	for _, c := range columns {
+		m[c.Name] = c
+	}
+	return m
+}
+
+func mapIndexDefs(indexes []dialect.IndexDef) map[string]dialect.IndexDef {
+	m := make(map[string]dialect.IndexDef, len(indexes))
+	for _, idx := range indexes {
+		m[idx.Name] = idx
+	}
+	return m
+}
+
+func mapForeignKeyDefs(fks []dialect.ForeignKeyDef) map[string]dialect.ForeignKeyDef {
+	m := make(map[string]dialect.ForeignKeyDef, len(fks))
+	for _, fk := range fks {
+		m[foreignKeySignature(fk)] = fk
+	}
+	return m
+}
+
+func columnDefEqual(a, b dialect.ColumnDef) bool {
+	return strings.EqualFold(a.Type, b.Type) &&
+		a.NotNull == b.NotNull &&
+		a.HasDefault == b.HasDefault &&
+		a.Default == b.Default
+}
+
+func columnSignature(c dialect.ColumnDef) string {
+	s := c.Type
+	if c.NotNull {
+		s += " NOT NULL"
+	}
+	if c.HasDefault {
+		s += " DEFAULT " + c.Default
+	}
+	return s
+}
+
+func indexDefEqual(a, b dialect.IndexDef) bool {
+	return a.Unique == b.Unique && strings.Join(a.Columns, ",") == strings.Join(b.Columns, ",")
+}
+
+func foreignKeySignature(fk dialect.ForeignKeyDef) string {
+	return fmt.Sprintf("(%s) -> %s(%s)", strings.Join(fk.Columns, ", "), fk.RefTable, strings.Join(fk.RefColumns, ", "))
+}
@@ -0,0 +1,105 @@
+package rockhopper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDiffSchema generates a migration from the difference between a live
+// database and a desired DDL file, then checks that its up reaches the desired
+// schema and its down restores the original one.
+func TestDiffSchema(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	db := openTestDB(t)
+	_, err := db.ExecContext(ctx, `CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(64) NOT NULL)`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT)`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `CREATE INDEX idx_users_name ON users (name)`)
+	require.NoError(t, err)
+
+	writeTestMigrationFile(t, dir, "schema.sql", `
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    email VARCHAR(128) NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+CREATE TABLE comments (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    body TEXT,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX idx_comments_user ON comments (user_id);
+`)
+
+	scratch := openTestDB(t)
+	require.NoError(t, scratch.ExecSchemaFile(ctx, filepath.Join(dir, "schema.sql")))
+
+	current, err := db.InspectSchema(ctx)
+	require.NoError(t, err)
+	desired, err := scratch.InspectSchema(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, desired, 2, "rockhopper tables must not be inspected")
+	assert.Equal(t, "comments", desired[0].Name)
+	if assert.Len(t, desired[0].ForeignKeys, 1) {
+		assert.Equal(t, "users", desired[0].ForeignKeys[0].RefTable)
+	}
+
+	diff, err := DiffSchema(db.dialect, current, desired)
+	require.NoError(t, err)
+	assert.Empty(t, diff.Warnings)
+	assert.Equal(t, []string{
+		"DROP INDEX idx_users_name",
+		"CREATE TABLE comments (\n    id INTEGER,\n    user_id INTEGER NOT NULL,\n    body TEXT,\n    PRIMARY KEY(id),\n    FOREIGN KEY (user_id) REFERENCES users (id)\n)",
+		"CREATE INDEX idx_comments_user ON comments (user_id)",
+		"ALTER TABLE users ADD COLUMN email VARCHAR(128) NOT NULL DEFAULT ''",
+		"CREATE UNIQUE INDEX idx_users_email ON users (email)",
+		"DROP TABLE posts",
+	}, diff.Up)
+
+	migrationsDir := filepath.Join(dir, "migrations")
+	require.NoError(t, os.MkdirAll(migrationsDir, 0755))
+	require.NoError(t, CreateWithTemplate(migrationsDir, diff.Template(), DefaultSchemaDiffName, "sql"))
+
+	migrations, err := (&SqlMigrationLoader{}).Load(migrationsDir)
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+
+	require.NoError(t, migrations[0].Up(ctx, db))
+
+	upgraded, err := db.InspectSchema(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, desired, upgraded)
+
+	require.NoError(t, migrations[0].Down(ctx, db))
+
+	restored, err := db.InspectSchema(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, current, restored)
+
+	t.Run("sqlite column changes are reported as warnings", func(t *testing.T) {
+		altered := openTestDB(t)
+		_, err := altered.ExecContext(ctx, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`)
+		require.NoError(t, err)
+
+		alteredSchema, err := altered.InspectSchema(ctx)
+		require.NoError(t, err)
+
+		diff, err := DiffSchema(db.dialect, current[1:], alteredSchema)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"DROP INDEX idx_users_name"}, diff.Up)
+		if assert.Len(t, diff.Warnings, 1) {
+			assert.Contains(t, diff.Warnings[0], "users.name")
+		}
+	})
+}
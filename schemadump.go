@@ -0,0 +1,208 @@
+package rockhopper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/c9s/rockhopper/v2/pkg/dialect"
+)
+
+const schemaDumpHeader = "-- Schema dump generated by rockhopper. DO NOT EDIT.\n"
+
+// DumpSchema renders the schema of the database as canonical DDL: one
+// statement per object, ordered deterministically, so that the dump only
+// changes when the schema does. rockhopper's own tables are left out.
+//
+// SQLite objects come from sqlite_master, MySQL tables from SHOW CREATE TABLE
+// and PostgreSQL tables are rendered from the catalog introspection.
+func (db *DB) DumpSchema(ctx context.Context) (string, error) {
+	var stmts []string
+	var err error
+
+	switch db.driverName {
+	case DialectSQLite3:
+		stmts, err = db.dumpSqliteSchema(ctx)
+	case DialectMySQL:
+		stmts, err = db.dumpMySQLSchema(ctx)
+	case DialectPostgres:
+		stmts, err = db.dumpCatalogSchema(ctx)
+	default:
+		return "", fmt.Errorf("schema dump is not supported by the %s driver", db.driverName)
+	}
+
+	if err != nil {
+		return "", errors.Wrap(err, "failed to dump schema")
+	}
+
+	var b strings.Builder
+	b.WriteString(schemaDumpHeader)
+	for _, stmt := range stmts {
+		b.WriteString("\n" + strings.TrimSpace(stmt) + ";\n")
+	}
+
+	return b.String(), nil
+}
+
+// WriteSchemaFile writes the schema dump to path.
+func (db *DB) WriteSchemaFile(ctx context.Context, path string) error {
+	dump, err := db.DumpSchema(ctx)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, []byte(dump), 0644)
+}
+
+// StaleSchemaFileError is returned by CheckSchemaFile when the schema file does
+// not match the database.
+type StaleSchemaFileError struct {
+	Path string
+}
+
+func (e *StaleSchemaFileError) Error() string {
+	return fmt.Sprintf("schema file %s is stale, run 'rockhopper schema dump' to update it", e.Path)
+}
+
+// CheckSchemaFile compares the schema file at path with a fresh dump of the
+// database, and returns a *StaleSchemaFileError when they differ.
+func (db *DB) CheckSchemaFile(ctx context.Context, path string) error {
+	dump, err := db.DumpSchema(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &StaleSchemaFileError{Path: path}
+	} else if err != nil {
+		return err
+	}
+
+	if string(data) != dump {
+		return &StaleSchemaFileError{Path: path}
+	}
+
+	return nil
+}
+
+// dumpSqliteSchema lists the stored DDL of tables, views, indexes and triggers,
+// in that order, each group sorted by table and object name.
+func (db *DB) dumpSqliteSchema(ctx context.Context) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT tbl_name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'view' THEN 1 WHEN 'index' THEN 2 ELSE 3 END, tbl_name, name`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var stmts []string
+	for rows.Next() {
+		var tableName, ddl string
+		if err := rows.Scan(&tableName, &ddl); err != nil {
+			return nil, err
+		}
+
+		if internalTableNames[tableName] {
+			continue
+		}
+
+		stmts = append(stmts, ddl)
+	}
+
+	return stmts, rows.Err()
+}
+
+// autoIncrementRegExp matches the AUTO_INCREMENT counter of SHOW CREATE TABLE,
+// which changes with the data and not with the schema.
+var autoIncrementRegExp = regexp.MustCompile(`\s+AUTO_INCREMENT=\d+`)
+
+func (db *DB) dumpMySQLSchema(ctx context.Context) ([]string, error) {
+	tableNames, err := db.getTableNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(tableNames)
+
+	var stmts []string
+	for _, tableName := range tableNames {
+		if internalTableNames[tableName] {
+			continue
+		}
+
+		ddl, err := db.showCreateTable(ctx, tableName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to show create table %s", tableName)
+		}
+
+		stmts = append(stmts, autoIncrementRegExp.ReplaceAllString(ddl, ""))
+	}
+
+	return stmts, nil
+}
+
+// showCreateTable returns the second column of SHOW CREATE TABLE, which holds
+// the DDL of both tables and views (views return two more columns).
+func (db *DB) showCreateTable(ctx context.Context, tableName string) (string, error) {
+	rows, err := db.QueryContext(ctx, "SHOW CREATE TABLE `"+tableName+"`")
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	if !rows.Next() {
+		return "", sql.ErrNoRows
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	if err := rows.Scan(dest...); err != nil {
+		return "", err
+	}
+
+	return values[1].String, nil
+}
+
+// dumpCatalogSchema renders each table with its indexes from the catalog
+// introspection, which already orders both by name.
+func (db *DB) dumpCatalogSchema(ctx context.Context) ([]string, error) {
+	alterer, ok := db.dialect.(dialect.SchemaAlterer)
+	if !ok {
+		return nil, fmt.Errorf("schema dump is not supported by the %s driver", db.driverName)
+	}
+
+	tables, err := db.InspectSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmts []string
+	for _, t := range tables {
+		stmts = append(stmts, createTableStatements(alterer, t)...)
+	}
+
+	return stmts, nil
+}
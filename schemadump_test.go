@@ -0,0 +1,47 @@
+package rockhopper
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpSchema(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	// created out of order to check that the dump does not depend on it
+	for _, q := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE INDEX idx_users_name ON users (name)`,
+		`CREATE TABLE accounts (id INTEGER PRIMARY KEY)`,
+		`CREATE VIEW user_names AS SELECT name FROM users`,
+	} {
+		_, err := db.ExecContext(ctx, q)
+		require.NoError(t, err)
+	}
+
+	dump, err := db.DumpSchema(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, schemaDumpHeader+
+		"\nCREATE TABLE accounts (id INTEGER PRIMARY KEY);\n"+
+		"\nCREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);\n"+
+		"\nCREATE VIEW user_names AS SELECT name FROM users;\n"+
+		"\nCREATE INDEX idx_users_name ON users (name);\n", dump)
+	assert.NotContains(t, dump, TableName, "rockhopper tables must not be dumped")
+
+	path := filepath.Join(t.TempDir(), "schema.sql")
+
+	var staleErr *StaleSchemaFileError
+	assert.ErrorAs(t, db.CheckSchemaFile(ctx, path), &staleErr, "a missing schema file is stale")
+
+	require.NoError(t, db.WriteSchemaFile(ctx, path))
+	assert.NoError(t, db.CheckSchemaFile(ctx, path))
+
+	_, err = db.ExecContext(ctx, `ALTER TABLE accounts ADD COLUMN email TEXT`)
+	require.NoError(t, err)
+	assert.ErrorAs(t, db.CheckSchemaFile(ctx, path), &staleErr)
+}
@@ -0,0 +1,357 @@
+package rockhopper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSquashName is the descriptive name of a squashed migration file when
+// none is given.
+const DefaultSquashName = "squashed_baseline"
+
+// Squash collapses the migrations of a package whose versions fall in the
+// inclusive range [from, to] into a single migration. The new migration takes
+// the version of the last migration in the range, runs the up statements of
+// every migration in order, and runs their down statements in reverse
+// migration order. It returns the squashed migration and the migrations it
+// replaces.
+//
+// The squashed migration requires what the migrations required outside of
+// the range, and keeps their '-- +batch' size, which must be the same. It is
+// irreversible, without down statements, when one of the migrations can not
+// be rolled back.
+//
+// A database that already applied the whole range has the last version
+// recorded, so it treats the squashed migration as applied.
+func Squash(migrations MigrationSlice, pkgName string, from, to int64) (*Migration, MigrationSlice, error) {
+	if from > to {
+		return nil, nil, fmt.Errorf("invalid squash range: %d is greater than %d", from, to)
+	}
+
+	var squashed MigrationSlice
+	for _, m := range migrations {
+		if m.Package == pkgName && m.Version >= from && m.Version <= to {
+			squashed = append(squashed, m)
+		}
+	}
+
+	if len(squashed) < 2 {
+		return nil, nil, fmt.Errorf("package %q has %d migration(s) in range %d-%d, nothing to squash", pkgName, len(squashed), from, to)
+	}
+
+	squashed = squashed.Sort()
+	if err := squashed.Parse(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, m := range squashed {
+		if m.Stream {
+			return nil, nil, fmt.Errorf("migration %s is a '-- +stream' migration, it can not be squashed", m.location())
+		}
+	}
+
+	tail := squashed.Tail()
+	result := &Migration{
+		Name:         DefaultSquashName,
+		Package:      pkgName,
+		Version:      tail.Version,
+		UseTx:        squashed.Head().UseTx,
+		BatchSize:    squashed.Head().BatchSize,
+		SquashedFrom: squashed.Head().Version,
+	}
+
+	for _, m := range squashed {
+		if m.UpFn != nil || m.DownFn != nil {
+			return nil, nil, fmt.Errorf("can not squash go migration %s", m.location())
+		}
+
+		if m.SquashedFrom > 0 && m.SquashedFrom < result.SquashedFrom {
+			result.SquashedFrom = m.SquashedFrom
+		}
+
+		// a single transaction flag covers the whole file, so mixing the two
+		// would silently change how some of the statements run.
+		if m.UseTx != result.UseTx {
+			return nil, nil, fmt.Errorf("can not squash transactional and non-transactional (-- !txn) migrations together: %s", m.location())
+		}
+
+		if m.BatchSize != result.BatchSize {
+			return nil, nil, fmt.Errorf("can not squash migrations with different '-- +batch' sizes together: %s", m.location())
+		}
+
+		result.UpStatements = append(result.UpStatements, withFileLintIgnore(m.UpStatements, m.Chunk)...)
+	}
+
+	// the requirements of the originals, except the originals themselves
+	required := map[MigrationRef]bool{}
+	for _, m := range squashed {
+		for _, req := range m.Requires {
+			inRange := req.Package == pkgName && req.Version >= result.SquashedFrom && req.Version <= result.Version
+			if !inRange && !required[req] {
+				required[req] = true
+				result.Requires = append(result.Requires, req)
+			}
+		}
+	}
+
+	// the down of a range with a migration that can not be rolled back would
+	// roll back only part of it
+	for _, m := range squashed {
+		if !m.Reversible() {
+			result.Irreversible = true
+			return result, squashed, nil
+		}
+	}
+
+	for i := len(squashed) - 1; i >= 0; i-- {
+		result.DownStatements = append(result.DownStatements, withFileLintIgnore(squashed[i].DownStatements, squashed[i].Chunk)...)
+	}
+
+	return result, squashed, nil
+}
+
+// withFileLintIgnore returns copies of the statements that also suppress the
+// lint rules the "-- +lint-ignore" annotation of their file suppressed, since
+// the squashed file has a header of its own.
+func withFileLintIgnore(stmts []Statement, chunk *MigrationScriptChunk) []Statement {
+	if chunk == nil || len(chunk.LintIgnore) == 0 {
+		return stmts
+	}
+
+	copies := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		stmt.LintIgnore = append([]string(nil), stmt.LintIgnore...)
+		for _, rule := range chunk.LintIgnore {
+			if !sliceContains(stmt.LintIgnore, rule) {
+				stmt.LintIgnore = append(stmt.LintIgnore, rule)
+			}
+		}
+
+		copies[i] = stmt
+	}
+
+	return copies
+}
+
+// SquashedFrom declares that the migration squashes the versions from version
+// up to its own, like the "-- @squashed <from> <to>" annotation.
+func SquashedFrom(version int64) MigrationOption {
+	return func(m *Migration) {
+		m.SquashedFrom = version
+	}
+}
+
+// WriteSquashedMigration writes the squashed migration into dir as a SQL
+// migration file and returns its path. The file declares the covered range
+// with a "-- @squashed <from> <to>" annotation, followed by its "-- @requires"
+// and "-- +batch" annotations, and "-- +irreversible" instead of a down block
+// when it can not be rolled back.
+func WriteSquashedMigration(dir string, m *Migration) (string, error) {
+	name := m.Name
+	if name == "" {
+		name = DefaultSquashName
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%d_%s.sql", m.Version, snakeCase(name)))
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("failed to write squashed migration: %s already exists", path)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- @package %s\n", m.Package)
+	fmt.Fprintf(&b, "-- @squashed %d %d\n", m.SquashedFrom, m.Version)
+	if len(m.Requires) > 0 {
+		refs := make([]string, len(m.Requires))
+		for i, ref := range m.Requires {
+			refs[i] = ref.String()
+		}
+
+		fmt.Fprintf(&b, "-- @requires %s\n", strings.Join(refs, " "))
+	}
+
+	if m.BatchSize > 0 {
+		fmt.Fprintf(&b, "-- +batch %d\n", m.BatchSize)
+	}
+	if !m.UseTx {
+		b.WriteString("-- !txn\n")
+	}
+
+	if m.Irreversible {
+		b.WriteString("-- +irreversible\n")
+	}
+
+	b.WriteString("-- +up\n")
+	writeSquashedStatements(&b, m.UpStatements)
+
+	if !m.Irreversible {
+		b.WriteString("\n-- +down\n")
+		writeSquashedStatements(&b, m.DownStatements)
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", errors.Wrap(err, "failed to write squashed migration")
+	}
+
+	m.Source = path
+	return path, nil
+}
+
+// writeSquashedStatements renders the statements so that they parse back into
+// the same statements, with their "-- +lint-ignore" annotations. A statement
+// the lexer would not split back as is (e.g. a procedure body) is wrapped in a
+// -- +begin / -- +end block.
+func writeSquashedStatements(b *strings.Builder, stmts []Statement) {
+	for _, stmt := range stmts {
+		sql := strings.TrimSpace(stmt.SQL)
+		if isNoOpSQL(sql) {
+			continue
+		}
+
+		if len(stmt.LintIgnore) > 0 {
+			b.WriteString("-- +lint-ignore " + strings.Join(stmt.LintIgnore, " ") + "\n")
+		}
+
+		if !needsStatementBlock(sql) {
+			b.WriteString(sql + "\n")
+			continue
+		}
+
+		b.WriteString("-- +begin\n" + sql + "\n-- +end\n")
+	}
+}
+
+// squashDialects are the dialects a squashed statement must lex the same in,
+// the squashed file is parsed with the dialect of whoever loads it.
+var squashDialects = []string{"", DialectMySQL, DialectPostgres, DialectClickHouse, DialectSQLite3}
+
+// needsStatementBlock reports whether sql has to be wrapped in a -- +begin /
+// -- +end block to parse back into the same single statement.
+func needsStatementBlock(sql string) bool {
+	for _, dialectName := range squashDialects {
+		if !lexesAsStatement(sql, dialectName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lexesAsStatement feeds sql to the lexer the way the parser does and reports
+// whether it comes back as exactly the same single statement.
+func lexesAsStatement(sql, dialectName string) bool {
+	lexer := newSQLLexer(dialectName)
+
+	var stmts []lexedStatement
+	for i, line := range strings.Split(sql, "\n") {
+		// the parser takes these lines as annotations, or skips them
+		if lexer.inCode() && (strings.HasPrefix(line, "--") || matchEmptyLines.MatchString(line)) {
+			return false
+		}
+
+		stmts = append(stmts, lexer.feed(line, i+1)...)
+	}
+
+	return len(stmts) == 1 && stmts[0].SQL == sql && lexer.pending() == "" && lexer.inCode()
+}
+
+// ArchiveMigrations moves the source files of the given migrations into
+// archiveDir, which the loader does not scan. It returns the new paths of the
+// migration files. When a move fails, the files moved before it are moved
+// back.
+func ArchiveMigrations(archiveDir string, migrations MigrationSlice) (archived []string, err error) {
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create archive directory")
+	}
+
+	var undo fileUndo
+	defer func() {
+		if err != nil {
+			undo.revert("archive")
+		}
+	}()
+
+	move := func(from string) (string, error) {
+		to := filepath.Join(archiveDir, filepath.Base(from))
+		if err := os.Rename(from, to); err != nil {
+			return "", errors.Wrapf(err, "failed to archive %s", from)
+		}
+
+		undo.push(func() error { return os.Rename(to, from) })
+		return to, nil
+	}
+
+	for _, m := range migrations {
+		dest, err := move(m.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		if m.DownSource != "" {
+			if _, err := move(m.DownSource); err != nil {
+				return nil, err
+			}
+		}
+
+		archived = append(archived, dest)
+	}
+
+	return archived, nil
+}
+
+// RestoreArchivedMigrations moves the files ArchiveMigrations moved into
+// archiveDir back to their sources, e.g. when the squashed migration that
+// replaces them could not be written.
+func RestoreArchivedMigrations(archiveDir string, migrations MigrationSlice) error {
+	for _, m := range migrations {
+		for _, source := range []string{m.Source, m.DownSource} {
+			if source == "" {
+				continue
+			}
+
+			if err := os.Rename(filepath.Join(archiveDir, filepath.Base(source)), source); err != nil {
+				return errors.Wrapf(err, "failed to restore %s", source)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkSquashedRange is called when a squashed migration has no record of its
+// own. Applying it on top of a database that applied only part of the range
+// would re-run the statements that are already applied, so that is reported as
+// an error instead of a pending migration.
+func (db *DB) checkSquashedRange(ctx context.Context, m *Migration) error {
+	records, err := db.LoadMigrationRecordsByPackage(ctx, m.Package)
+	if err != nil {
+		return err
+	}
+
+	return checkSquashedRecords(m, records)
+}
+
+// checkSquashedRecords checks the range of the squashed migration m against
+// the records of its package, in descending id order.
+func checkSquashedRecords(m *Migration, records []MigrationRecord) error {
+	seen := make(map[int64]bool)
+	for _, r := range records {
+		// records are in descending id order, the first one of a version is its latest state
+		if seen[r.VersionID] {
+			continue
+		}
+
+		seen[r.VersionID] = true
+
+		if r.IsApplied && r.VersionID >= m.SquashedFrom && r.VersionID < m.Version {
+			return fmt.Errorf("squashed migration %s covers versions %d-%d, but the database applied only part of the range (version %d is applied); apply the original migrations before switching to the squashed file",
+				m.location(), m.SquashedFrom, m.Version, r.VersionID)
+		}
+	}
+
+	return nil
+}
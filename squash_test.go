@@ -0,0 +1,299 @@
+package rockhopper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestMigrationFile(t testing.TB, dir, filename, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, filename), []byte(content), 0644))
+}
+
+func statementSQLs(stmts []Statement) (sqls []string) {
+	for _, stmt := range stmts {
+		sqls = append(sqls, stmt.SQL)
+	}
+
+	return sqls
+}
+
+func TestSquash(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	writeTestMigrationFile(t, dir, "20240101000000_a.sql",
+		"-- +up\nCREATE TABLE a (id INT);\n-- +down\nDROP TABLE a;\n")
+	writeTestMigrationFile(t, dir, "20240102000000_b.sql",
+		"-- +up\nCREATE TABLE b (id INT);\n-- +begin\nINSERT INTO b (id) VALUES (1);\nINSERT INTO b (id) VALUES (2);\n-- +end\n-- +down\nDROP TABLE b;\n")
+	writeTestMigrationFile(t, dir, "20240103000000_c.sql",
+		"-- +up\nCREATE TABLE c (id INT);\n-- +down\nDROP TABLE c;\n")
+	writeTestMigrationFile(t, dir, "20240104000000_d.sql",
+		"-- +up\nCREATE TABLE d (id INT);\n-- +down\nDROP TABLE d;\n")
+
+	loader := &SqlMigrationLoader{}
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+	require.Len(t, migrations, 4)
+
+	// a database that applied the whole range before the squash
+	db := openTestDB(t)
+	require.NoError(t, UpMigrations(ctx, db, migrations[:3]))
+
+	squashed, originals, err := Squash(migrations, DefaultPackageName, 20240101000000, 20240103000000)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240101000000, 20240102000000, 20240103000000}, originals.Versions())
+	assert.Equal(t, int64(20240103000000), squashed.Version)
+	assert.Equal(t, int64(20240101000000), squashed.SquashedFrom)
+	assert.Len(t, squashed.UpStatements, 4)
+	if assert.Len(t, squashed.DownStatements, 3) {
+		assert.Equal(t, "DROP TABLE c;", squashed.DownStatements[0].SQL, "down statements run in reverse migration order")
+		assert.Equal(t, "DROP TABLE a;", squashed.DownStatements[2].SQL)
+	}
+
+	_, err = ArchiveMigrations(filepath.Join(dir, "archive"), originals)
+	require.NoError(t, err)
+
+	path, err := WriteSquashedMigration(dir, squashed)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "20240103000000_squashed_baseline.sql"), path)
+
+	reloaded, err := loader.Load(dir)
+	require.NoError(t, err)
+	require.Equal(t, []int64{20240103000000, 20240104000000}, reloaded.Versions())
+
+	head := reloaded.Head()
+	assert.Equal(t, int64(20240101000000), head.SquashedFrom)
+	assert.Equal(t, statementSQLs(squashed.UpStatements), statementSQLs(head.UpStatements), "the squashed file must parse back into the same statements")
+	assert.Equal(t, statementSQLs(squashed.DownStatements), statementSQLs(head.DownStatements))
+
+	t.Run("fully migrated database is up to date", func(t *testing.T) {
+		reloaded = reloaded.SortAndConnect()
+		status, err := db.InspectMigrations(ctx, reloaded)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{20240104000000}, status.Pending.Versions())
+		assert.Empty(t, status.OutOfOrder)
+
+		_, last, err := db.FindLastAppliedMigration(ctx, reloaded)
+		require.NoError(t, err)
+		assert.Equal(t, head, last)
+	})
+
+	t.Run("fresh database applies the squashed migration", func(t *testing.T) {
+		fresh := openTestDB(t)
+		require.NoError(t, Up(ctx, fresh, reloaded.Head(), 0))
+
+		_, err := fresh.ExecContext(ctx, "SELECT COUNT(*) FROM b")
+		assert.NoError(t, err)
+	})
+
+	t.Run("partially migrated database is rejected", func(t *testing.T) {
+		partial := openTestDB(t)
+		require.NoError(t, UpMigrations(ctx, partial, MigrationSlice{newTestMigration(20240101000000, "CREATE TABLE a (id INT)", "DROP TABLE a")}))
+
+		_, err := partial.InspectMigrations(ctx, reloaded)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "only part of the range")
+		}
+	})
+}
+
+func TestSquash_RejectsMixedTransactionModes(t *testing.T) {
+	a := newTestMigration(20240101000000, "CREATE TABLE a (id INT)", "DROP TABLE a")
+	b := newTestMigration(20240102000000, "CREATE TABLE b (id INT)", "DROP TABLE b")
+	b.UseTx = false
+
+	_, _, err := Squash(MigrationSlice{a, b}, "main", 20240101000000, 20240102000000)
+	assert.Error(t, err)
+}
+
+func TestSquash_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	writeTestMigrationFile(t, dir, "20240101000000_a.sql", "-- +lint-ignore drop-table\n"+
+		"-- +up\n"+
+		"CREATE TABLE a (id INT, note TEXT);\n"+
+		"INSERT INTO a (id, note) VALUES (1, 'a; b');\n"+
+		"INSERT INTO a (id, note) VALUES (2, 'multi\n"+
+		"-- line');\n"+
+		"-- +down\n"+
+		"DROP TABLE a; -- no longer used\n")
+	writeTestMigrationFile(t, dir, "20240102000000_b.sql", "-- +up\n"+
+		"-- +lint-ignore drop-column\n"+
+		"ALTER TABLE a ADD COLUMN b INT NOT NULL DEFAULT 0;\n"+
+		"-- +begin\n"+
+		"CREATE TRIGGER a_b AFTER INSERT ON a BEGIN UPDATE a SET b = 1 WHERE id = NEW.id; END;\n"+
+		"-- +end\n"+
+		"-- +down\n"+
+		"DROP TRIGGER a_b;\n"+
+		"-- +lint-ignore drop-column\n"+
+		"ALTER TABLE a DROP COLUMN b;\n")
+
+	loader := &SqlMigrationLoader{}
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+
+	squashed, originals, err := Squash(migrations, DefaultPackageName, 20240101000000, 20240102000000)
+	require.NoError(t, err)
+
+	_, err = ArchiveMigrations(filepath.Join(dir, "archive"), originals)
+	require.NoError(t, err)
+
+	path, err := WriteSquashedMigration(dir, squashed)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(content), "-- +begin"), "only the trigger needs a block")
+
+	reloaded, err := loader.Load(dir)
+	require.NoError(t, err)
+	require.Len(t, reloaded, 1)
+
+	assert.Equal(t, withoutLocations(squashed.UpStatements), withoutLocations(reloaded[0].UpStatements))
+	assert.Equal(t, withoutLocations(squashed.DownStatements), withoutLocations(reloaded[0].DownStatements))
+	assert.Equal(t, []string{"drop-table"}, reloaded[0].UpStatements[0].LintIgnore, "the lint rules of the file are kept")
+	assert.Equal(t, []string{"drop-column"}, reloaded[0].DownStatements[1].LintIgnore)
+	assert.Equal(t, []string{"drop-table"}, reloaded[0].DownStatements[2].LintIgnore)
+
+	db := openTestDB(t)
+	require.NoError(t, reloaded[0].Up(ctx, db))
+	require.NoError(t, reloaded[0].Down(ctx, db))
+}
+
+// withoutLocations returns the statements without their file and line, which
+// change when they are squashed.
+func withoutLocations(stmts []Statement) []Statement {
+	copies := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		stmt.File, stmt.Line = "", 0
+		copies[i] = stmt
+	}
+
+	return copies
+}
+
+func TestSquash_RequiresAndBatch(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTestMigrationFile(t, dir, "20240101000000_users.sql",
+		"-- @package users\n-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n")
+	writeTestMigrationFile(t, dir, "20240102000000_a.sql",
+		"-- @requires users:20240101000000\n-- +batch 50\n-- +up\nCREATE TABLE a (id INT);\n-- +down\nDROP TABLE a;\n")
+	writeTestMigrationFile(t, dir, "20240103000000_b.sql",
+		"-- @requires 20240102000000 users:20240101000000\n-- +batch 50\n-- +up\nCREATE TABLE b (id INT);\n-- +down\nDROP TABLE b;\n")
+
+	loader := &SqlMigrationLoader{}
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+
+	squashed, originals, err := Squash(migrations, DefaultPackageName, 20240102000000, 20240103000000)
+	require.NoError(t, err)
+	assert.Equal(t, []MigrationRef{{Package: "users", Version: 20240101000000}}, squashed.Requires, "the requirements inside the range are left out")
+	assert.Equal(t, 50, squashed.BatchSize)
+
+	_, err = ArchiveMigrations(filepath.Join(dir, "archive"), originals)
+	require.NoError(t, err)
+
+	_, err = WriteSquashedMigration(dir, squashed)
+	require.NoError(t, err)
+
+	reloaded, err := loader.Load(dir)
+	require.NoError(t, err)
+
+	head := reloaded.FilterPackage([]string{DefaultPackageName}).Head()
+	assert.Equal(t, squashed.Requires, head.Requires)
+	assert.Equal(t, 50, head.BatchSize)
+
+	t.Run("different batch sizes", func(t *testing.T) {
+		b := migrations[2]
+		b.BatchSize = 10
+		_, _, err := Squash(migrations, DefaultPackageName, 20240102000000, 20240103000000)
+		assert.ErrorContains(t, err, "different '-- +batch' sizes")
+	})
+}
+
+func TestSquash_Irreversible(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTestMigrationFile(t, dir, "20240101000000_a.sql",
+		"-- +up\nCREATE TABLE a (id INT);\n-- +down\nDROP TABLE a;\n")
+	writeTestMigrationFile(t, dir, "20240102000000_b.sql",
+		"-- +irreversible\n-- +up\nCREATE TABLE b (id INT);\n")
+
+	loader := &SqlMigrationLoader{}
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+
+	squashed, originals, err := Squash(migrations, DefaultPackageName, 20240101000000, 20240102000000)
+	require.NoError(t, err)
+	assert.True(t, squashed.Irreversible)
+	assert.Empty(t, squashed.DownStatements, "a down of part of the range is dropped")
+
+	_, err = ArchiveMigrations(filepath.Join(dir, "archive"), originals)
+	require.NoError(t, err)
+
+	_, err = WriteSquashedMigration(dir, squashed)
+	require.NoError(t, err)
+
+	reloaded, err := loader.Load(dir)
+	require.NoError(t, err)
+	require.Len(t, reloaded, 1)
+	assert.True(t, reloaded[0].Irreversible)
+	assert.False(t, reloaded[0].Reversible())
+}
+
+func TestArchiveMigrations_Restore(t *testing.T) {
+	dir := t.TempDir()
+	archiveDir := filepath.Join(dir, "archive")
+
+	writeTestMigrationFile(t, dir, "20240101000000_a.sql",
+		"-- +up\nCREATE TABLE a (id INT);\n-- +down\nDROP TABLE a;\n")
+	writeTestMigrationFile(t, dir, "20240102000000_b.sql",
+		"-- +up\nCREATE TABLE b (id INT);\n-- +down\nDROP TABLE b;\n")
+
+	migrations, err := (&SqlMigrationLoader{}).Load(dir)
+	require.NoError(t, err)
+
+	// b goes away, its move fails after a was archived
+	content, err := os.ReadFile(migrations[1].Source)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(migrations[1].Source))
+
+	_, err = ArchiveMigrations(archiveDir, migrations)
+	assert.ErrorContains(t, err, "failed to archive "+migrations[1].Source)
+	assert.FileExists(t, migrations[0].Source, "the archived files are moved back")
+	assert.NoFileExists(t, filepath.Join(archiveDir, "20240101000000_a.sql"))
+
+	require.NoError(t, os.WriteFile(migrations[1].Source, content, 0644))
+
+	archived, err := ArchiveMigrations(archiveDir, migrations)
+	require.NoError(t, err)
+	assert.Len(t, archived, 2)
+	assert.NoFileExists(t, migrations[0].Source)
+
+	require.NoError(t, RestoreArchivedMigrations(archiveDir, migrations))
+	assert.FileExists(t, migrations[0].Source)
+	assert.FileExists(t, migrations[1].Source)
+	assert.NoFileExists(t, archived[1])
+}
+
+func TestSquashedFrom(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	require.NoError(t, UpMigrations(ctx, db, MigrationSlice{newTestMigration(20240101000000, "CREATE TABLE a (id INT)", "DROP TABLE a")}))
+
+	// a compiled squashed migration checks its range like a squashed file
+	m := newTestMigration(20240102000000, "CREATE TABLE a (id INT); CREATE TABLE b (id INT)", "DROP TABLE b; DROP TABLE a")
+	SquashedFrom(20240101000000)(m)
+
+	_, err := db.InspectMigrations(ctx, MigrationSlice{m})
+	assert.ErrorContains(t, err, "only part of the range")
+}
@@ -0,0 +1,316 @@
+package rockhopper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// streamProgressInterval is how often the progress of a streamed migration is
+// logged.
+const streamProgressInterval = 10 * time.Second
+
+// streamedUp is what the parse of a '-- +stream' script keeps of its up
+// statements: their hash for the checksum, and which of them commit
+// implicitly.
+type streamedUp struct {
+	hash    hash.Hash
+	commits statementCommits
+}
+
+// readStreamFile parses a '-- +stream' script without keeping its up
+// statements: it checks the whole file before anything runs, hashes the up
+// statements for the checksum and classifies them for checkImplicitCommits.
+// The chunk holds the down statements only.
+func readStreamFile(path, dialectName string, section Direction) (*MigrationScriptChunk, *streamedUp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "ERROR %v: failed to open SQL migration file", filepath.Base(path))
+	}
+
+	defer f.Close()
+
+	initialState := start
+	if section == DirectionUp {
+		initialState = stateUp
+	}
+
+	parser := MigrationParser{Dialect: dialectName}
+	chunk := &MigrationScriptChunk{}
+	up := &streamedUp{hash: sha256.New()}
+	err = parser.parseFunc(f, initialState, chunk, func(stmt Statement) error {
+		if stmt.Direction == DirectionUp {
+			up.hash.Write([]byte(stmt.SQL))
+			up.hash.Write([]byte{0})
+			up.commits.add(stmt.SQL)
+			return nil
+		}
+
+		stmt.File = path
+		chunk.DownStmts = append(chunk.DownStmts, stmt)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "%s: failed to parse SQL migration file", filepath.Base(path))
+	}
+
+	return chunk, up, nil
+}
+
+// streamChecksum completes the checksum of a stream migration, the same as
+// Checksum of the statements kept in memory.
+func streamChecksum(h hash.Hash, downStmts []Statement) string {
+	h.Write([]byte{0})
+	for _, stmt := range downStmts {
+		h.Write([]byte(stmt.SQL))
+		h.Write([]byte{0})
+	}
+
+	h.Write([]byte{0})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// setStreamChecksum sets the checksum of a stream migration from the hash of
+// its up statements, up is nil for other migrations.
+func (m *Migration) setStreamChecksum(up *streamedUp) {
+	if up != nil {
+		m.checksum = streamChecksum(up.hash, m.DownStatements)
+		m.streamCommits = &up.commits
+	}
+}
+
+// StreamSourceChangedError is returned when the file of a stream migration no
+// longer has the statements it was parsed or planned with, e.g. when it was
+// edited between 'up --plan' and 'apply'.
+type StreamSourceChangedError struct {
+	Migration *Migration
+}
+
+func (e *StreamSourceChangedError) Error() string {
+	return fmt.Sprintf("the source of stream migration %s changed since it was parsed or planned; load the migrations or compute the plan again",
+		e.Migration.location())
+}
+
+// readStreamSource reads the source of a stream migration again, with its
+// down statements, which a migration decoded from a plan does not have.
+func (m *Migration) readStreamSource(dialectName string) (*streamedUp, []Statement, error) {
+	var section Direction
+	pair := SqlMigrationPairFilenamePattern.FindStringSubmatch(filepath.Base(m.Source))
+	if pair != nil {
+		section = DirectionUp
+	}
+
+	chunk, up, err := readStreamFile(m.Source, dialectName, section)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	downStmts := chunk.DownStmts
+	if pair != nil {
+		downSource := m.DownSource
+		if downSource == "" {
+			// a plan keeps the up file only, the down file is next to it
+			downSource = filepath.Join(filepath.Dir(m.Source), pair[1]+"_"+pair[2]+".down.sql")
+			if _, err := os.Stat(downSource); err != nil {
+				downSource = ""
+			}
+		}
+
+		if downSource != "" {
+			downChunk, err := readMigrationFile(downSource, dialectName, DirectionDown)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			downStmts = downChunk.DownStmts
+		}
+	}
+
+	return up, downStmts, nil
+}
+
+// checkStreamSource returns StreamSourceChangedError when the source of a
+// stream migration decoded from a plan changed since the plan was computed.
+func (db *DB) checkStreamSource(m *Migration) error {
+	up, downStmts, err := m.readStreamSource(db.driverName)
+	if err != nil {
+		return err
+	}
+
+	if m.checksum != "" && streamChecksum(up.hash, downStmts) != m.checksum {
+		return &StreamSourceChangedError{Migration: m}
+	}
+
+	// the checksum of the statements streamed later includes them
+	m.DownStatements = downStmts
+	m.streamCommits = &up.commits
+	return nil
+}
+
+// upStatementSeq yields the up statements of the migration. A stream
+// migration reads them from its file while they run, and fails with
+// StreamSourceChangedError after the last one when they are not the
+// statements of its checksum, so that its version is not recorded.
+func (m *Migration) upStatementSeq(db *DB) iter.Seq2[Statement, error] {
+	if !m.Stream {
+		return statementSeq(m.UpStatements)
+	}
+
+	return func(yield func(Statement, error) bool) {
+		f, err := os.Open(m.Source)
+		if err != nil {
+			yield(Statement{}, errors.Wrapf(err, "ERROR %v: failed to open SQL migration file", filepath.Base(m.Source)))
+			return
+		}
+
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			yield(Statement{}, err)
+			return
+		}
+
+		progress := &streamProgress{m: m, r: f, size: info.Size(), start: time.Now(), last: time.Now()}
+
+		dialectName := db.driverName
+		if m.lazy != nil {
+			dialectName = m.lazy.dialect
+		}
+
+		h := sha256.New()
+		for stmt, err := range m.streamUp(progress, dialectName) {
+			if err != nil {
+				yield(Statement{}, errors.Wrapf(err, "%s: failed to parse SQL migration file", filepath.Base(m.Source)))
+				return
+			}
+
+			h.Write([]byte(stmt.SQL))
+			h.Write([]byte{0})
+
+			stmt.File = m.Source
+			if !yield(stmt, nil) {
+				return
+			}
+
+			progress.statement()
+		}
+
+		progress.report("streamed")
+
+		if m.checksum != "" && streamChecksum(h, m.DownStatements) != m.checksum {
+			yield(Statement{}, &StreamSourceChangedError{Migration: m})
+		}
+	}
+}
+
+// streamUp parses the up statements of a stream migration from r, the content
+// of its source.
+func (m *Migration) streamUp(r io.Reader, dialectName string) iter.Seq2[Statement, error] {
+	parser := MigrationParser{Dialect: dialectName}
+	if SqlMigrationPairFilenamePattern.MatchString(filepath.Base(m.Source)) {
+		return parser.StreamSection(r, DirectionUp)
+	}
+
+	return parser.Stream(r, DirectionUp)
+}
+
+// streamedUpStatements yields the up statements of a stream migration read
+// from its source, for the checks that do not run them, like the lint rules.
+func (m *Migration) streamedUpStatements(dialectName string) iter.Seq2[Statement, error] {
+	return func(yield func(Statement, error) bool) {
+		f, err := os.Open(m.Source)
+		if err != nil {
+			yield(Statement{}, errors.Wrapf(err, "ERROR %v: failed to open SQL migration file", filepath.Base(m.Source)))
+			return
+		}
+
+		defer f.Close()
+
+		for stmt, err := range m.streamUp(f, dialectName) {
+			if err != nil {
+				yield(Statement{}, errors.Wrapf(err, "%s: failed to parse SQL migration file", filepath.Base(m.Source)))
+				return
+			}
+
+			stmt.File = m.Source
+			if !yield(stmt, nil) {
+				return
+			}
+		}
+	}
+}
+
+// statementSeq yields the statements of a slice.
+func statementSeq(stmts []Statement) iter.Seq2[Statement, error] {
+	return func(yield func(Statement, error) bool) {
+		for _, stmt := range stmts {
+			if !yield(stmt, nil) {
+				return
+			}
+		}
+	}
+}
+
+// streamProgress counts the bytes read and the statements run of a stream
+// migration and logs them every streamProgressInterval.
+type streamProgress struct {
+	m *Migration
+	r io.Reader
+
+	size, read int64
+	statements int
+	start      time.Time
+	last       time.Time
+}
+
+func (p *streamProgress) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	return n, err
+}
+
+func (p *streamProgress) statement() {
+	p.statements++
+
+	if time.Since(p.last) >= streamProgressInterval {
+		p.last = time.Now()
+		p.report("streaming")
+	}
+}
+
+func (p *streamProgress) report(action string) {
+	percent := 100.0
+	if p.size > 0 {
+		percent = float64(p.read) * 100 / float64(p.size)
+	}
+
+	log.Infof("%s %s: %d statements, %s of %s read (%.1f%%) in %s",
+		action, p.m.location(), p.statements, formatBytes(p.read), formatBytes(p.size), percent,
+		time.Since(p.start).Truncate(time.Millisecond))
+}
+
+// formatBytes formats a size with a binary unit, e.g. 1.5 GiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,197 @@
+package rockhopper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationParser_Stream(t *testing.T) {
+	script := "-- +stream\n-- +up\nINSERT INTO t VALUES (1);\nINSERT INTO t VALUES (2);\n-- +down\nDELETE FROM t;\n"
+
+	var sqls []string
+	for stmt, err := range (&MigrationParser{}).Stream(strings.NewReader(script), DirectionUp) {
+		require.NoError(t, err)
+		sqls = append(sqls, stmt.SQL)
+	}
+
+	assert.Equal(t, []string{"INSERT INTO t VALUES (1);", "INSERT INTO t VALUES (2);"}, sqls)
+
+	for stmt, err := range (&MigrationParser{}).Stream(strings.NewReader(script), DirectionUp) {
+		require.NoError(t, err)
+		assert.Equal(t, "INSERT INTO t VALUES (1);", stmt.SQL)
+		break
+	}
+
+	var lastErr error
+	for _, err := range (&MigrationParser{}).Stream(strings.NewReader("-- +up\nINSERT INTO t VALUES (1);\nINSERT INTO t VALUES (2)\n"), DirectionUp) {
+		lastErr = err
+	}
+
+	assert.ErrorContains(t, lastErr, "missing semicolon")
+
+	_, err := (&MigrationParser{}).ParseString("-- +up\nINSERT INTO t VALUES (1);\n-- +stream\n")
+	assert.ErrorContains(t, err, "'-- +stream' must come before the first statement")
+}
+
+func writeStreamTestMigration(t *testing.T, dir string, rows int, header string) {
+	t.Helper()
+
+	var b strings.Builder
+	b.WriteString(header)
+	b.WriteString("-- +up\nCREATE TABLE seeds (id INT);\n")
+	for i := 1; i <= rows; i++ {
+		fmt.Fprintf(&b, "INSERT INTO seeds (id) VALUES (%d);\n", i)
+	}
+
+	b.WriteString("-- +down\nDROP TABLE seeds;\n")
+	writeTestMigrationFile(t, dir, "20240101120000_seed.sql", b.String())
+}
+
+func countSeeds(t *testing.T, db *DB) (n int) {
+	t.Helper()
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM seeds").Scan(&n))
+	return n
+}
+
+func TestStreamMigration(t *testing.T) {
+	ctx := context.Background()
+	loader := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3})
+
+	plainDir := t.TempDir()
+	writeStreamTestMigration(t, plainDir, 100, "")
+	plain, err := loader.Load(plainDir)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	writeStreamTestMigration(t, dir, 100, "-- +stream\n")
+	migrations, err := loader.Load(dir)
+	require.NoError(t, err)
+
+	m := migrations[0]
+	assert.True(t, m.Stream)
+	assert.Nil(t, m.UpStatements, "the up statements are not kept in memory")
+	assert.Len(t, m.DownStatements, 1)
+	assert.Equal(t, plain[0].Checksum(), m.Checksum(), "the checksum is the one of the same statements kept in memory")
+
+	db := openTestDB(t)
+	plan, err := NewPlanner(db, migrations).PlanUp(ctx, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, plan.Steps, 1)
+	assert.True(t, plan.Steps[0].Stream)
+	assert.Empty(t, plan.Steps[0].Statements)
+
+	require.NoError(t, db.ExecutePlan(ctx, plan))
+	assert.Equal(t, 100, countSeeds(t, db))
+
+	_, err = db.LoadMigration(ctx, m)
+	require.NoError(t, err)
+	assert.Equal(t, m.Checksum(), m.Record.Checksum)
+
+	require.NoError(t, m.Down(ctx, db))
+	_, err = db.Exec("SELECT COUNT(*) FROM seeds")
+	assert.Error(t, err, "rolled back with the down statements")
+}
+
+func TestStreamMigration_ResumesWithoutTransaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeStreamTestMigration(t, dir, 10, "-- +stream\n-- !txn\n")
+
+	migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Scan(dir)
+	require.NoError(t, err)
+
+	// a previous run stopped after the table and the first 4 rows
+	db := openTestDB(t)
+	_, err = db.Exec("CREATE TABLE seeds (id INT)")
+	require.NoError(t, err)
+	for i := 1; i <= 4; i++ {
+		_, err = db.Exec("INSERT INTO seeds (id) VALUES (?)", i)
+		require.NoError(t, err)
+	}
+
+	m := migrations[0]
+	require.NoError(t, db.saveMigrationProgress(ctx, db, &MigrationProgress{
+		Package: m.Package, Version: m.Version, StatementIndex: 5, Status: ProgressDirty,
+	}, false))
+
+	require.NoError(t, m.Up(ctx, db))
+	assert.Equal(t, 10, countSeeds(t, db))
+}
+
+func TestStreamMigration_CheckedBeforeRunning(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeTestMigrationFile(t, dir, "20240101120000_seed.sql",
+		"-- +stream\n-- +up\nCREATE TABLE seeds (id INT);\nINSERT INTO seeds (id) VALUES (1)\n")
+
+	migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Scan(dir)
+	require.NoError(t, err)
+
+	db := openTestDB(t)
+	assert.ErrorContains(t, migrations[0].Up(ctx, db), "missing semicolon")
+
+	_, err = db.Exec("SELECT COUNT(*) FROM seeds")
+	assert.Error(t, err, "nothing of the file runs")
+}
+
+func Test_formatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "2.0 GiB", formatBytes(2<<30))
+}
+
+func TestStreamMigration_SourceChanged(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeStreamTestMigration(t, dir, 10, "-- +stream\n")
+
+	migrations, err := NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Scan(dir)
+	require.NoError(t, err)
+
+	db := openTestDB(t)
+	plan, err := NewPlanner(db, migrations).PlanUp(ctx, 0, 0)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, plan.Encode(&buf))
+	require.NoError(t, migrations.Parse())
+
+	// the file is edited between the plan and its run
+	writeStreamTestMigration(t, dir, 20, "-- +stream\n")
+
+	var changed *StreamSourceChangedError
+
+	decoded, err := DecodePlan(&buf)
+	require.NoError(t, err)
+	assert.ErrorAs(t, db.ExecutePlan(ctx, decoded), &changed)
+	_, err = db.Exec("SELECT COUNT(*) FROM seeds")
+	assert.Error(t, err, "nothing of the plan runs")
+
+	// the migration parsed before the edit fails after streaming the new file
+	assert.ErrorAs(t, migrations[0].Up(ctx, db), &changed)
+	_, err = db.Exec("SELECT COUNT(*) FROM seeds")
+	assert.Error(t, err, "the streamed statements are rolled back")
+
+	_, err = db.LoadMigration(ctx, migrations[0])
+	require.NoError(t, err)
+	assert.Nil(t, migrations[0].Record, "the version is not recorded")
+
+	// a plan of the edited file runs
+	migrations, err = NewSqlMigrationLoader(&Config{Driver: DialectSQLite3}).Scan(dir)
+	require.NoError(t, err)
+	plan, err = NewPlanner(db, migrations).PlanUp(ctx, 0, 0)
+	require.NoError(t, err)
+
+	buf.Reset()
+	require.NoError(t, plan.Encode(&buf))
+	decoded, err = DecodePlan(&buf)
+	require.NoError(t, err)
+	require.NoError(t, db.ExecutePlan(ctx, decoded))
+	assert.Equal(t, 20, countSeeds(t, db))
+}
@@ -0,0 +1,135 @@
+package rockhopper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SyncTarget is the exact set of applied migrations a sync converges to. The
+// packages it does not mention are left as they are.
+type SyncTarget struct {
+	// Cutoffs selects, per package, every migration at or below a version.
+	// A cutoff of 0 selects none.
+	Cutoffs map[string]int64
+
+	// Versions lists the migrations to apply explicitly, every other
+	// migration of their packages is rolled back.
+	Versions []MigrationRef
+}
+
+// ParseMigrationRef parses "<package>:<version>", or a bare version with an
+// empty package.
+func ParseMigrationRef(s string) (MigrationRef, error) {
+	matches := requiresRefRegExp.FindStringSubmatch(s)
+	if matches == nil {
+		return MigrationRef{}, fmt.Errorf("invalid migration %q, expecting <package>:<version>", s)
+	}
+
+	version, err := strconv.ParseInt(matches[2], 10, 64)
+	if err != nil {
+		return MigrationRef{}, err
+	}
+
+	return MigrationRef{Package: matches[1], Version: version}, nil
+}
+
+// PlanSync diffs the target against the applied versions of its packages. It
+// plans the rollback of the applied migrations outside the target in
+// descending order, then the migrations of the target that are not applied
+// in ascending order. Unlike align, it reconciles the gaps left by
+// out-of-order migrations too.
+func (p *Planner) PlanSync(ctx context.Context, target SyncTarget) (*Plan, error) {
+	desired := map[MigrationRef]string{}
+	packages := map[string]bool{}
+
+	for pkgName, cutoff := range target.Cutoffs {
+		packages[pkgName] = true
+		for _, m := range p.migrations {
+			if m.Package == pkgName && m.Version <= cutoff {
+				desired[m.ref()] = fmt.Sprintf("at or below the sync version %d", cutoff)
+			}
+		}
+	}
+
+	for _, ref := range target.Versions {
+		packages[ref.Package] = true
+		desired[ref] = "listed in the sync target"
+	}
+
+	var names []string
+	for pkgName := range packages {
+		names = append(names, pkgName)
+	}
+
+	sort.Strings(names)
+
+	known := map[MigrationRef]*Migration{}
+	for _, m := range p.migrations {
+		known[m.ref()] = m
+	}
+
+	for ref := range desired {
+		if known[ref] == nil {
+			return nil, fmt.Errorf("migration %s of the sync target is not found", ref)
+		}
+	}
+
+	var extra, missing MigrationSlice
+	downReasons := map[*Migration]string{}
+	upReasons := map[*Migration]string{}
+
+	for _, pkgName := range names {
+		migrations := p.migrations.FilterPackage([]string{pkgName})
+		if _, err := p.db.InspectMigrations(ctx, migrations); err != nil {
+			return nil, err
+		}
+
+		// the records tell the applied versions whose file is gone, except for
+		// an imported baseline, which stands for the lower versions
+		records, err := p.db.LoadMigrationRecordsByPackage(ctx, pkgName)
+		if err != nil {
+			return nil, err
+		}
+
+		baseline, _, err := p.db.queryImportedBaseline(ctx, pkgName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range records {
+			ref := MigrationRef{Package: r.Package, Version: r.VersionID}
+			if r.IsApplied && r.VersionID != baseline && known[ref] == nil && desired[ref] == "" {
+				return nil, fmt.Errorf("applied migration %s is not in the sync target and can not be rolled back: its file is not found", ref)
+			}
+		}
+
+		for _, m := range migrations {
+			applied := m.Record != nil && m.Record.IsApplied
+			reason, ok := desired[m.ref()]
+
+			switch {
+			case applied && !ok:
+				extra = append(extra, m)
+				downReasons[m] = "applied, not in the sync target"
+
+			case !applied && ok:
+				missing = append(missing, m)
+				upReasons[m] = "pending, " + reason
+			}
+		}
+	}
+
+	plan := &Plan{CreatedAt: time.Now()}
+	if err := p.addDownSteps(ctx, plan, extra, downReasons); err != nil {
+		return nil, err
+	}
+
+	if err := p.addUpSteps(ctx, plan, missing, upReasons); err != nil {
+		return nil, err
+	}
+
+	return plan, plan.addPreconditions(ctx, p.db)
+}
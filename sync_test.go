@@ -0,0 +1,97 @@
+package rockhopper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMigrationRef(t *testing.T) {
+	ref, err := ParseMigrationRef("users:20240116231445")
+	require.NoError(t, err)
+	assert.Equal(t, MigrationRef{Package: "users", Version: 20240116231445}, ref)
+
+	ref, err = ParseMigrationRef("20240116231445")
+	require.NoError(t, err)
+	assert.Equal(t, MigrationRef{Version: 20240116231445}, ref)
+
+	_, err = ParseMigrationRef("users")
+	assert.Error(t, err)
+}
+
+func TestPlanner_PlanSync(t *testing.T) {
+	ctx := context.Background()
+
+	migrations := loadRequiresTestMigrations(t, map[string]string{
+		"20240101120000_create_users.sql": "-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;\n",
+		"20240102120000_create_posts.sql": "-- +up\nCREATE TABLE posts (id INT);\n-- +down\nDROP TABLE posts;\n",
+		"20240103120000_create_tags.sql":  "-- +up\nCREATE TABLE tags (id INT);\n-- +down\nDROP TABLE tags;\n",
+		"20240104120000_create_likes.sql": "-- +up\nCREATE TABLE likes (id INT);\n-- +down\nDROP TABLE likes;\n",
+	})
+
+	appliedVersions := func(db *DB) (versions []int64) {
+		for _, m := range migrations {
+			m.Record = nil
+			_, err := db.LoadMigration(ctx, m)
+			require.NoError(t, err)
+			if m.Record != nil && m.Record.IsApplied {
+				versions = append(versions, m.Version)
+			}
+		}
+		return versions
+	}
+
+	// 20240102120000 was left behind by an out-of-order merge
+	db := openTestDB(t)
+	require.NoError(t, UpMigrations(ctx, db, MigrationSlice{migrations[0], migrations[2], migrations[3]}))
+
+	t.Run("cutoff", func(t *testing.T) {
+		plan, err := NewPlanner(db, migrations).PlanSync(ctx, SyncTarget{
+			Cutoffs: map[string]int64{DefaultPackageName: 20240103120000},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"main:20240104120000", "main:20240102120000"}, planRefs(plan))
+		assert.Equal(t, DirectionDown, plan.Steps[0].Direction)
+		assert.Equal(t, DirectionUp, plan.Steps[1].Direction)
+	})
+
+	t.Run("explicit versions", func(t *testing.T) {
+		plan, err := NewPlanner(db, migrations).PlanSync(ctx, SyncTarget{
+			Versions: []MigrationRef{
+				{Package: DefaultPackageName, Version: 20240101120000},
+				{Package: DefaultPackageName, Version: 20240102120000},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"main:20240104120000", "main:20240103120000", "main:20240102120000"}, planRefs(plan),
+			"the extra versions are rolled back newest first")
+
+		require.NoError(t, db.ExecutePlan(ctx, plan))
+		assert.Equal(t, []int64{20240101120000, 20240102120000}, appliedVersions(db))
+
+		plan, err = NewPlanner(db, migrations).PlanSync(ctx, SyncTarget{
+			Versions: []MigrationRef{
+				{Package: DefaultPackageName, Version: 20240101120000},
+				{Package: DefaultPackageName, Version: 20240102120000},
+			},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, plan.Steps, "in sync")
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		_, err := NewPlanner(db, migrations).PlanSync(ctx, SyncTarget{
+			Versions: []MigrationRef{{Package: DefaultPackageName, Version: 20240105120000}},
+		})
+		assert.ErrorContains(t, err, "main:20240105120000")
+	})
+
+	t.Run("applied version without a file", func(t *testing.T) {
+		_, err := NewPlanner(db, migrations[1:]).PlanSync(ctx, SyncTarget{
+			Cutoffs: map[string]int64{DefaultPackageName: 20240104120000},
+		})
+		assert.ErrorContains(t, err, "main:20240101120000")
+	})
+}
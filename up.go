@@ -50,31 +50,21 @@ func UpBySteps(ctx context.Context, db *DB, m *Migration, steps int, callbacks .
 	return nil
 }
 
+// Upgrade applies the pending migrations of every package, a migration after
+// the migrations it requires. Like the forward walk it replaced, it skips the
+// pending migrations below an applied migration of their package; plan with
+// Planner.AllowOutOfOrder to apply them, or without SkipOutOfOrder to refuse
+// them with OutOfOrderError.
 func Upgrade(ctx context.Context, db *DB, migrations MigrationSlice) error {
-	migrationMap := migrations.MapByPackage()
-	for _, pkgMigrations := range migrationMap {
-		pkgMigrations = pkgMigrations.Sort().Connect()
+	planner := NewPlanner(db, migrations)
+	planner.SkipOutOfOrder = true
 
-		_, lastAppliedMigration, err := db.FindLastAppliedMigration(ctx, pkgMigrations)
-		if err != nil {
-			return err
-		}
-
-		startMigration := pkgMigrations.Head()
-		if lastAppliedMigration != nil {
-			startMigration = lastAppliedMigration.Next
-		}
-
-		err = Up(ctx, db, startMigration, 0, func(m *Migration) {
-			// log.Infof("migration %d is applied", m.Version)
-		})
-
-		if err != nil {
-			return err
-		}
+	plan, err := planner.PlanUp(ctx, 0, 0)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return db.ExecutePlan(ctx, plan)
 }
 
 // UpgradeFromGo runs the migration upgrades from the registered go-code migration
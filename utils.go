@@ -3,6 +3,8 @@ package rockhopper
 import (
 	"regexp"
 	"strings"
+
+	log "github.com/sirupsen/logrus"
 )
 
 var (
@@ -47,3 +49,21 @@ func previewSQL(s string) string {
 
 	return s + strings.Repeat(" ", width-len(s))
 }
+
+// fileUndo collects the steps that revert the file changes of an operation,
+// so that a failure halfway leaves the files as they were.
+type fileUndo []func() error
+
+func (u *fileUndo) push(fn func() error) {
+	*u = append(*u, fn)
+}
+
+// revert runs the steps in reverse order. A step that fails is logged and the
+// others still run, the error of the operation is the one returned.
+func (u fileUndo) revert(operation string) {
+	for i := len(u) - 1; i >= 0; i-- {
+		if err := u[i](); err != nil {
+			log.WithError(err).Errorf("failed to revert the %s, restore the migration files by hand", operation)
+		}
+	}
+}
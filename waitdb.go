@@ -0,0 +1,136 @@
+package rockhopper
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/c9s/rockhopper/v2/pkg/driver"
+)
+
+const (
+	// waitInitialBackoff is the delay before the second ping of WaitForDB, it
+	// doubles after every failed ping up to waitMaxBackoff.
+	waitInitialBackoff = 250 * time.Millisecond
+	waitMaxBackoff     = 10 * time.Second
+
+	// waitPingTimeout bounds a single ping, so that a connection attempt that
+	// hangs, e.g. on a firewall dropping packets, does not use up the wait.
+	waitPingTimeout = 5 * time.Second
+)
+
+// SetWaitForDB makes Touch wait up to timeout for the database to accept
+// connections, see WaitForDB. Useful when the migrations run in a container
+// that may start before the database.
+func (db *DB) SetWaitForDB(timeout time.Duration) {
+	db.waitForDB = timeout
+}
+
+// WaitForDB pings the database until it accepts connections, for up to the
+// timeout set with SetWaitForDB or the waitForDB config field, and returns
+// nil right away without one. The pings back off exponentially with jitter.
+// Transient errors, like a refused connection, are retried, while the errors
+// retrying can not fix, like bad credentials or an unknown database, are
+// returned right away.
+func (db *DB) WaitForDB(ctx context.Context) error {
+	if db.waitForDB <= 0 {
+		return nil
+	}
+
+	return waitForDB(ctx, db.waitForDB, db.describeDSN(), db.PingContext, db.isPermanentConnectError)
+}
+
+// describeDSN names the database in logs and errors, with its password masked.
+func (db *DB) describeDSN() string {
+	if db.dsn == "" {
+		return db.driverName
+	}
+
+	return maskDsnPassword(db.dsn)
+}
+
+// isPermanentConnectError reports whether retrying can not fix a connection
+// error of the database.
+func (db *DB) isPermanentConnectError(err error) bool {
+	switch db.driverName {
+	case DialectMySQL:
+		return driver.PermanentMySQLError != nil && driver.PermanentMySQLError(err)
+	case DialectPostgres:
+		return driver.PermanentPostgresError != nil && driver.PermanentPostgresError(err)
+	}
+
+	return false
+}
+
+func waitForDB(
+	ctx context.Context, timeout time.Duration, dsn string,
+	ping func(ctx context.Context) error, permanent func(err error) bool,
+) error {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancelPing := context.WithTimeout(waitCtx, waitPingTimeout)
+		err := ping(pingCtx)
+		cancelPing()
+
+		// a ping cut short by the end of the wait reports the error before it
+		if err != nil && waitCtx.Err() != nil && lastErr != nil {
+			err = lastErr
+		}
+
+		if err == nil {
+			if attempt > 1 {
+				log.Infof("database %s is ready after %d attempts", dsn, attempt)
+			}
+
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+
+		if permanent(err) {
+			return fmt.Errorf("database %s refused the connection, not retrying: %w", dsn, err)
+		}
+
+		notReady := fmt.Errorf("database %s is not ready after %s and %d attempts: %w", dsn, timeout, attempt, err)
+		remaining := timeout - time.Since(start)
+		if waitCtx.Err() != nil || remaining <= 0 {
+			return notReady
+		}
+
+		backoff := min(waitBackoff(attempt), remaining)
+		log.WithError(err).Warnf("database %s is not ready, attempt %d, retrying in %s", dsn, attempt, backoff.Round(time.Millisecond))
+
+		lastErr = err
+
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+
+			return notReady
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// waitBackoff returns the delay after the given failed attempt: it doubles
+// from waitInitialBackoff up to waitMaxBackoff, with a random half of it as
+// jitter, so that the jobs started together do not ping in lockstep.
+func waitBackoff(attempt int) time.Duration {
+	backoff := waitMaxBackoff
+	if attempt < 16 {
+		backoff = min(waitInitialBackoff<<(attempt-1), waitMaxBackoff)
+	}
+
+	return backoff/2 + rand.N(backoff/2)
+}
@@ -0,0 +1,104 @@
+package rockhopper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errConnRefused  = errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")
+	errAccessDenied = errors.New("Error 1045: Access denied for user 'root'")
+)
+
+func isTestAccessDenied(err error) bool {
+	return errors.Is(err, errAccessDenied)
+}
+
+func Test_waitForDB(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		attempts := 0
+		err := waitForDB(ctx, 10*time.Second, "app", func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return errConnRefused
+			}
+
+			return nil
+		}, isTestAccessDenied)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("fails fast on permanent errors", func(t *testing.T) {
+		attempts := 0
+		err := waitForDB(ctx, 10*time.Second, "app", func(ctx context.Context) error {
+			attempts++
+			return errAccessDenied
+		}, isTestAccessDenied)
+
+		assert.ErrorIs(t, err, errAccessDenied)
+		assert.ErrorContains(t, err, "database app refused the connection, not retrying")
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		err := waitForDB(ctx, 300*time.Millisecond, "app", func(ctx context.Context) error {
+			return errConnRefused
+		}, isTestAccessDenied)
+
+		assert.ErrorIs(t, err, errConnRefused)
+		assert.ErrorContains(t, err, "database app is not ready after 300ms and ")
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		err := waitForDB(ctx, 10*time.Second, "app", func(ctx context.Context) error {
+			cancel()
+			return errConnRefused
+		}, isTestAccessDenied)
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func Test_waitBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 40; attempt++ {
+		ceiling := min(waitInitialBackoff<<min(attempt-1, 15), waitMaxBackoff)
+		backoff := waitBackoff(attempt)
+		assert.GreaterOrEqual(t, backoff, ceiling/2, "attempt %d", attempt)
+		assert.Less(t, backoff, ceiling, "attempt %d", attempt)
+	}
+}
+
+func TestDB_WaitForDB(t *testing.T) {
+	dialect, err := LoadDialect("sqlite3")
+	require.NoError(t, err)
+
+	db, err := Open("sqlite3", dialect, ":memory:", TableName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.SetWaitForDB(time.Second)
+	assert.NoError(t, db.WaitForDB(context.Background()))
+	assert.NoError(t, db.Touch(context.Background()))
+}
+
+func Test_maskDsnPassword(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"root:secret@tcp(db:3306)/app":                      "root:******@tcp(db:3306)/app",
+		"postgres://app:secret@db:5432/app?sslmode=disable": "postgres://app:xxxxx@db:5432/app?sslmode=disable",
+		"postgres://db:5432/app":                            "postgres://db:5432/app",
+		"host=db user=app password=secret dbname=app":       "host=db user=app password=****** dbname=app",
+		"host=db password='se cret' dbname=app":             "host=db password=****** dbname=app",
+	} {
+		assert.Equal(t, want, maskDsnPassword(dsn), dsn)
+	}
+}